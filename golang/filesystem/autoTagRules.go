@@ -0,0 +1,309 @@
+package filesystem
+
+// auto-tagging rules are stored per manager and tag files that match every condition
+// of a rule. they run after a scan (startUp) and after every rescan (loadTreeData), and
+// can be re-run over the whole manager with a preview. rules only ever add tags, and
+// each tag only once per file: a tag the user removes again stays removed.
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TagRule tags a file with Tag when all of its non-empty conditions match.
+// PathGlob is relative to the manager root and supports "**".
+type TagRule struct {
+	ID            string `json:"id"`
+	Tag           string `json:"tag"`
+	Category      string `json:"category,omitempty"`
+	PathGlob      string `json:"pathGlob,omitempty"`
+	MinSize       int64  `json:"minSize,omitempty"`
+	MaxSize       int64  `json:"maxSize,omitempty"`
+	OlderThanDays int    `json:"olderThanDays,omitempty"`
+	NewerThanDays int    `json:"newerThanDays,omitempty"`
+	NameRegex     string `json:"nameRegex,omitempty"`
+	Keyword       string `json:"keyword,omitempty"`
+
+	nameRe *regexp.Regexp
+}
+
+// TagRuleChange is one file that a rule run tags (or would tag, in a preview)
+type TagRuleChange struct {
+	FilePath string   `json:"file_path"`
+	FileName string   `json:"file_name"`
+	Added    []string `json:"added"`
+	Rules    []string `json:"rules"`
+}
+
+// validate normalises the rule and compiles its regex
+func (rule *TagRule) validate() error {
+	rule.Tag = normalizeTag(rule.Tag)
+	if rule.Tag == "" {
+		return fmt.Errorf("rule has no tag")
+	}
+	if rule.Category == "" && rule.PathGlob == "" && rule.MinSize == 0 && rule.MaxSize == 0 &&
+		rule.OlderThanDays == 0 && rule.NewerThanDays == 0 && rule.NameRegex == "" && rule.Keyword == "" {
+		return fmt.Errorf("rule has no conditions")
+	}
+	if rule.MinSize < 0 || rule.MaxSize < 0 || (rule.MaxSize > 0 && rule.MinSize > rule.MaxSize) {
+		return fmt.Errorf("invalid size range %d-%d", rule.MinSize, rule.MaxSize)
+	}
+	if rule.OlderThanDays < 0 || rule.NewerThanDays < 0 {
+		return fmt.Errorf("ages must not be negative")
+	}
+	if rule.PathGlob != "" && !validGlob(rule.PathGlob) {
+		return fmt.Errorf("invalid path glob %q", rule.PathGlob)
+	}
+	rule.nameRe = nil
+	if rule.NameRegex != "" {
+		re, err := regexp.Compile(rule.NameRegex)
+		if err != nil {
+			return fmt.Errorf("invalid name regex: %w", err)
+		}
+		rule.nameRe = re
+	}
+	return nil
+}
+
+func (rule *TagRule) needsStat() bool {
+	return rule.MinSize > 0 || rule.MaxSize > 0 || rule.OlderThanDays > 0 || rule.NewerThanDays > 0
+}
+
+// matches evaluates the rule, stat is only called for size and age conditions
+func (rule *TagRule) matches(c *Folder, file *File, stat func() os.FileInfo, now time.Time) bool {
+	if rule.Category != "" && !strings.EqualFold(GetCategory(file.Name), rule.Category) {
+		return false
+	}
+	if rule.PathGlob != "" && !matchGlob(rule.PathGlob, relativeToComposite(c, file.Path)) {
+		return false
+	}
+	if rule.NameRegex != "" {
+		if rule.nameRe == nil {
+			if err := rule.validate(); err != nil {
+				return false
+			}
+		}
+		if !rule.nameRe.MatchString(file.Name) {
+			return false
+		}
+	}
+	if rule.Keyword != "" {
+		found := false
+		for _, kw := range file.Keywords {
+			if strings.EqualFold(kw.GetKeyword(), rule.Keyword) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if rule.needsStat() {
+		info := stat()
+		if info == nil {
+			return false
+		}
+		if rule.MinSize > 0 && info.Size() < rule.MinSize {
+			return false
+		}
+		if rule.MaxSize > 0 && info.Size() > rule.MaxSize {
+			return false
+		}
+		age := now.Sub(info.ModTime())
+		if rule.OlderThanDays > 0 && age < time.Duration(rule.OlderThanDays)*24*time.Hour {
+			return false
+		}
+		if rule.NewerThanDays > 0 && age > time.Duration(rule.NewerThanDays)*24*time.Hour {
+			return false
+		}
+	}
+	return true
+}
+
+// applyTagRules runs every rule of the manager over its files. with preview set nothing
+// is changed, the returned list shows what would be tagged.
+func applyTagRules(c *Folder, preview bool) []TagRuleChange {
+	changes := []TagRuleChange{}
+	if len(c.TagRules) == 0 {
+		return changes
+	}
+	now := time.Now()
+
+	var walk func(f *Folder)
+	walk = func(f *Folder) {
+		for _, file := range f.Files {
+			var info os.FileInfo
+			statted := false
+			stat := func() os.FileInfo {
+				if !statted {
+					statted = true
+					if fi, err := os.Stat(file.Path); err == nil {
+						info = fi
+					}
+				}
+				return info
+			}
+
+			var change *TagRuleChange
+			for _, rule := range c.TagRules {
+				if containsString(file.RuleTags, rule.Tag) || hasMatchingTag(file.Tags, rule.Tag) ||
+					!rule.matches(c, file, stat, now) {
+					continue
+				}
+				if change == nil {
+					change = &TagRuleChange{FilePath: file.Path, FileName: file.Name}
+				}
+				if !containsString(change.Added, rule.Tag) {
+					change.Added = append(change.Added, rule.Tag)
+				}
+				change.Rules = append(change.Rules, rule.ID)
+			}
+			if change == nil {
+				continue
+			}
+			if !preview {
+				file.Tags = append(file.Tags, change.Added...)
+				file.RuleTags = append(file.RuleTags, change.Added...)
+			}
+			changes = append(changes, *change)
+		}
+		for _, sub := range f.Subfolders {
+			walk(sub)
+		}
+	}
+	walk(c)
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].FilePath < changes[j].FilePath
+	})
+	return changes
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// addTagRule validates rule, gives it an id and appends it to the manager
+func addTagRule(c *Folder, rule *TagRule) error {
+	if err := rule.validate(); err != nil {
+		return err
+	}
+	highest := 0
+	for _, r := range c.TagRules {
+		if n, err := strconv.Atoi(r.ID); err == nil && n > highest {
+			highest = n
+		}
+	}
+	rule.ID = strconv.Itoa(highest + 1)
+	c.TagRules = append(c.TagRules, rule)
+	return nil
+}
+
+func removeTagRule(c *Folder, id string) bool {
+	for i, r := range c.TagRules {
+		if r.ID == id {
+			c.TagRules = append(c.TagRules[:i], c.TagRules[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func tagRulesHandler(w http.ResponseWriter, r *http.Request) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	c := findComposite(r.URL.Query().Get("name"))
+	if c == nil {
+		http.Error(w, "No smart manager with that name", http.StatusBadRequest)
+		return
+	}
+	rules := c.TagRules
+	if rules == nil {
+		rules = []*TagRule{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(rules); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// addTagRuleHandler takes the rule as json body, apply=true also runs it right away
+func addTagRuleHandler(w http.ResponseWriter, r *http.Request) {
+	var rule TagRule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	c := findComposite(r.URL.Query().Get("name"))
+	if c == nil {
+		http.Error(w, "No smart manager with that name", http.StatusBadRequest)
+		return
+	}
+	if err := addTagRule(c, &rule); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if r.URL.Query().Get("apply") == "true" {
+		applyTagRules(c, false)
+	}
+	queueCompositeSave(c)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(rule); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+func removeTagRuleHandler(w http.ResponseWriter, r *http.Request) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	c := findComposite(r.URL.Query().Get("name"))
+	if c == nil || !removeTagRule(c, r.URL.Query().Get("id")) {
+		w.Write([]byte("false"))
+		return
+	}
+	queueCompositeSave(c)
+	w.Write([]byte("true"))
+}
+
+// applyTagRulesHandler re-runs all rules, preview=true only reports what would change
+func applyTagRulesHandler(w http.ResponseWriter, r *http.Request) {
+	preview := r.URL.Query().Get("preview") == "true"
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	c := findComposite(r.URL.Query().Get("name"))
+	if c == nil {
+		http.Error(w, "No smart manager with that name", http.StatusBadRequest)
+		return
+	}
+	changes := applyTagRules(c, preview)
+	if !preview && len(changes) > 0 {
+		queueCompositeSave(c)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(changes); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
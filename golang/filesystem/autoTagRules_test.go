@@ -0,0 +1,218 @@
+package filesystem
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	pb "github.com/COS301-SE-2025/Smart-File-Manager/golang/client/protos"
+)
+
+func TestMatchGlob(t *testing.T) {
+	cases := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"invoices/**", "invoices/2024/a.pdf", true},
+		{"/invoices/**/*.pdf", "invoices/a.pdf", true},
+		{"invoices/**/*.pdf", "invoices/2024/q1/a.pdf", true},
+		{"invoices/**/*.pdf", "invoices/2024/a.txt", false},
+		{"**/*.pdf", "a.pdf", true},
+		{"*.pdf", "sub/a.pdf", false},
+		{"invoices/*", "invoices/2024/a.pdf", false},
+		{"invoices", "invoices2/a.pdf", false},
+	}
+	for _, tc := range cases {
+		if got := matchGlob(tc.pattern, tc.name); got != tc.want {
+			t.Errorf("matchGlob(%q, %q) = %v; want %v", tc.pattern, tc.name, got, tc.want)
+		}
+	}
+	if validGlob("a/[b") {
+		t.Errorf("expected malformed pattern to be invalid")
+	}
+}
+
+// ruleManager builds a manager on disk: invoices/vat.pdf (old), invoices/other.pdf, notes.txt
+func ruleManager(t *testing.T) *Folder {
+	t.Helper()
+	tmp := chdirTemp(t)
+	root := filepath.Join(tmp, "rules")
+	if err := os.MkdirAll(filepath.Join(root, "invoices"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"invoices/vat.pdf":   "a long enough invoice body",
+		"invoices/other.pdf": "x",
+		"notes.txt":          "notes",
+	} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-90 * 24 * time.Hour)
+	os.Chtimes(filepath.Join(root, "invoices/vat.pdf"), old, old)
+
+	c, err := ConvertToObject("rules", root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.GetFile(filepath.Join(root, "invoices/vat.pdf")).Keywords = []*pb.Keyword{{Keyword: "VAT"}}
+	return c
+}
+
+func TestApplyTagRules_AllConditionsMustMatch(t *testing.T) {
+	c := ruleManager(t)
+	if err := addTagRule(c, &TagRule{Tag: "finance", Category: "Documents", PathGlob: "invoices/**", Keyword: "vat"}); err != nil {
+		t.Fatal(err)
+	}
+
+	changes := applyTagRules(c, false)
+	if len(changes) != 1 || changes[0].FileName != "vat.pdf" {
+		t.Fatalf("expected only vat.pdf to be tagged, got %+v", changes)
+	}
+	if !hasMatchingTag(c.GetFile(changes[0].FilePath).Tags, "finance") {
+		t.Fatalf("tag not applied")
+	}
+
+	// running again changes nothing
+	if again := applyTagRules(c, false); len(again) != 0 {
+		t.Fatalf("expected rules to be idempotent, got %+v", again)
+	}
+}
+
+func TestApplyTagRules_RemovedTagsStayRemoved(t *testing.T) {
+	c := ruleManager(t)
+	addTagRule(c, &TagRule{Tag: "finance", Keyword: "vat"})
+	changes := applyTagRules(c, false)
+	if len(changes) != 1 {
+		t.Fatalf("expected vat.pdf to be tagged, got %+v", changes)
+	}
+	file := c.GetFile(changes[0].FilePath)
+
+	// the user takes the tag off again, the next run (a rescan) must not bring it back
+	file.RemoveTag("finance")
+	if again := applyTagRules(c, false); len(again) != 0 || len(file.Tags) != 0 {
+		t.Fatalf("a removed rule tag was re-added: %+v", again)
+	}
+	nodes := compositeToJsonStorageFormat(c, nil)
+	restored := &File{Name: file.Name, Path: file.Path}
+	for _, n := range nodes {
+		for _, child := range n.Children {
+			if child.Path == file.Path {
+				applyStoredFileNode(restored, child)
+			}
+		}
+	}
+	if !containsString(restored.RuleTags, "finance") {
+		t.Fatalf("the applied rule tags should be stored, got %v", restored.RuleTags)
+	}
+
+	// rule and record follow a rename, a delete drops the rule
+	renameTagPrefix(c, "finance", "money")
+	if c.TagRules[0].Tag != "money" || !containsString(file.RuleTags, "money") {
+		t.Fatalf("rename did not reach the rule: %q %v", c.TagRules[0].Tag, file.RuleTags)
+	}
+	if again := applyTagRules(c, false); len(again) != 0 {
+		t.Fatalf("a renamed rule re-added its tag: %+v", again)
+	}
+	deleteTag(c, "money")
+	if len(c.TagRules) != 0 || len(file.RuleTags) != 0 {
+		t.Fatalf("delete should drop the rule and its record: %+v %v", c.TagRules, file.RuleTags)
+	}
+}
+
+func TestApplyTagRules_SizeAgeAndRegex(t *testing.T) {
+	c := ruleManager(t)
+	addTagRule(c, &TagRule{Tag: "big", MinSize: 10})
+	addTagRule(c, &TagRule{Tag: "stale", OlderThanDays: 30})
+	addTagRule(c, &TagRule{Tag: "text", NameRegex: `\.txt$`})
+
+	changes := applyTagRules(c, true)
+	added := map[string][]string{}
+	for _, ch := range changes {
+		added[ch.FileName] = ch.Added
+	}
+	if len(added["vat.pdf"]) != 2 {
+		t.Errorf("vat.pdf should be big and stale, got %v", added["vat.pdf"])
+	}
+	if len(added["notes.txt"]) != 1 || added["notes.txt"][0] != "text" {
+		t.Errorf("notes.txt should only be text, got %v", added["notes.txt"])
+	}
+	if _, ok := added["other.pdf"]; ok {
+		t.Errorf("other.pdf should not match any rule")
+	}
+
+	// preview does not touch the tree
+	for _, ch := range changes {
+		if len(c.GetFile(ch.FilePath).Tags) != 0 {
+			t.Fatalf("preview must not tag %s", ch.FileName)
+		}
+	}
+}
+
+func TestAddTagRule_Validation(t *testing.T) {
+	c := &Folder{Name: "v", Path: "/v"}
+	bad := []*TagRule{
+		{Tag: "", Category: "Documents"},
+		{Tag: "x"},
+		{Tag: "x", NameRegex: "("},
+		{Tag: "x", MinSize: 10, MaxSize: 5},
+		{Tag: "x", PathGlob: "[a"},
+	}
+	for _, r := range bad {
+		if err := addTagRule(c, r); err == nil {
+			t.Errorf("expected %+v to be rejected", r)
+		}
+	}
+	addTagRule(c, &TagRule{Tag: "a", Category: "Documents"})
+	addTagRule(c, &TagRule{Tag: "b", Category: "Images"})
+	if c.TagRules[1].ID != "2" {
+		t.Fatalf("expected sequential ids, got %q", c.TagRules[1].ID)
+	}
+	if !removeTagRule(c, "1") || removeTagRule(c, "1") {
+		t.Fatalf("remove should succeed once")
+	}
+}
+
+func TestTagRuleHandlers_PersistAndApply(t *testing.T) {
+	c := ruleManager(t)
+	orig := Composites
+	defer func() { Composites = orig }()
+	Composites = []*Folder{c}
+
+	body, _ := json.Marshal(TagRule{Tag: "finance", PathGlob: "invoices/*.pdf"})
+	rr := httptest.NewRecorder()
+	addTagRuleHandler(rr, httptest.NewRequest("POST", "/addTagRule?name=rules", bytes.NewReader(body)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	applyTagRulesHandler(rr, httptest.NewRequest("GET", "/applyTagRules?name=rules&preview=true", nil))
+	var preview []TagRuleChange
+	json.NewDecoder(rr.Body).Decode(&preview)
+	if len(preview) != 2 || len(findFilesByTag(c, "finance")) != 0 {
+		t.Fatalf("preview should list 2 files without tagging, got %+v", preview)
+	}
+
+	rr = httptest.NewRecorder()
+	applyTagRulesHandler(rr, httptest.NewRequest("GET", "/applyTagRules?name=rules", nil))
+	if len(findFilesByTag(c, "finance")) != 2 {
+		t.Fatalf("expected both invoices tagged")
+	}
+
+	stored := readStoredTree(t, "rules")
+	if len(stored.TagRules) != 1 || stored.TagRules[0].PathGlob != "invoices/*.pdf" {
+		t.Fatalf("rule not persisted: %+v", stored.TagRules)
+	}
+	fresh, _ := ConvertToObject("rules", c.Path)
+	mergeDirectoryTreeToComposite(fresh, &stored)
+	if len(fresh.TagRules) != 1 {
+		t.Fatalf("rule not restored")
+	}
+}
@@ -67,6 +67,8 @@ type returnStruct struct {
 	FilePath string   `json:"file_path"`
 	FileName string   `json:"file_name"`
 	FileTags []string `json:"file_tags,omitempty"`
+	// tags the file gets from folders tagged with inherit
+	InheritedTags []string `json:"inherited_tags,omitempty"`
 }
 
 var ObjectMap = map[string]map[string]object{}
@@ -114,7 +116,9 @@ type DeleteStruct struct {
 	FilePath string `json:"file_path"`
 }
 
-// BulkAddTags adds tags to files in bulk
+// BulkAddTags adds tags to files in bulk. a tag is stored even when a more specific tag
+// on the file already implies it (client/acme next to client/acme/invoices), so it stays
+// when the specific one is removed. the tag tree counts such a file once per node.
 func BulkAddTags(item *Folder, bulkList []TagsStruct) error {
 	for _, tagItem := range bulkList {
 		for _, tag := range tagItem.Tags {
@@ -179,7 +183,7 @@ func BulkAddTagHandler(w http.ResponseWriter, r *http.Request) {
 			if err := json.NewEncoder(w).Encode(root); err != nil {
 				http.Error(w, "Failed to encode response", http.StatusInternalServerError)
 			}
-			saveCompositeDetails(folder)
+			queueCompositeSave(folder)
 			return
 		}
 	}
@@ -207,6 +211,13 @@ func BulkRemoveTagHandler(w http.ResponseWriter, r *http.Request) {
 	// Find the corresponding Folder by name
 	for _, folder := range Composites {
 		if folder.Name == name {
+			var paths []string
+			for _, item := range bulkList {
+				paths = append(paths, item.FilePath)
+			}
+			if !guardLocks(w, r, "bulk remove tags", lockBlockers(folder, paths, false)) {
+				return
+			}
 			if err := BulkRemoveTags(folder, bulkList); err != nil {
 				http.Error(w, fmt.Sprintf("Failed to remove tags: %v", err), http.StatusInternalServerError)
 				return
@@ -225,7 +236,7 @@ func BulkRemoveTagHandler(w http.ResponseWriter, r *http.Request) {
 			if err := json.NewEncoder(w).Encode(root); err != nil {
 				http.Error(w, "Failed to encode response", http.StatusInternalServerError)
 			}
-			saveCompositeDetails(folder)
+			queueCompositeSave(folder)
 			return
 		}
 	}
@@ -260,18 +271,31 @@ func BulkDeleteFolderHandler(w http.ResponseWriter, r *http.Request) {
 	//delete all folders in list
 	for _, folder := range Composites {
 		if folder.Name == name {
-			err := folder.RemoveMultipleSubfolders(filePaths)
+			// the whole batch is refused when anything in it is locked
+			if !guardLocks(w, r, "bulk delete folders", lockBlockers(folder, filePaths, true)) {
+				return
+			}
+			snapshotBefore("bulk delete")
+			// each folder leaves the tree only once it is gone from disk
 			for _, path := range filePaths {
-				if err[path] != nil {
-					fmt.Println("Error removing file:", path, "Error:", err[path])
+				sub := folder.GetSubfolder(path)
+				if sub == nil || sub == folder {
+					fmt.Println("Error removing file:", path, "Error:", fmt.Errorf("folder not found: %s", path))
 					continue
 				}
+				reprotect := unprotectForDelete(folder, path)
 				err := os.RemoveAll(path)
+				reprotect()
 				if err != nil {
+					queueCompositeSave(folder)
 					http.Error(w, fmt.Sprintf("Failed to remove folder %s: %v", path, err), http.StatusInternalServerError)
 					return
 				}
+				if err := folder.RemoveSubfolder(path); err != nil {
+					fmt.Println("Error removing file:", path, "Error:", err)
+				}
 			}
+			queueCompositeSave(folder)
 			children := GoSidecreateDirectoryJSONStructure(folder)
 
 			root := DirectoryTreeJson{
@@ -319,19 +343,36 @@ func BulkDeleteFileHandler(w http.ResponseWriter, r *http.Request) {
 	//delete all folders in list
 	for _, folder := range Composites {
 		if folder.Name == name {
-			err := folder.RemoveMultipleFiles(filePaths)
-
+			if !guardLocks(w, r, "bulk delete files", lockBlockers(folder, filePaths, true)) {
+				return
+			}
+			snapshotBefore("bulk delete")
+			// each file leaves the tree only once it is gone from disk, its sidecar goes with it
 			for _, path := range filePaths {
-				if err[path] != nil {
-					fmt.Println("Error removing file:", path, "Error:", err[path])
+				file := folder.GetFile(path)
+				if file == nil {
+					fmt.Println("Error removing file:", path, "Error:", fmt.Errorf("file not found: %s", path))
 					continue
 				}
+				sidecar := file.Sidecar
+				reprotect := unprotectForDelete(folder, path)
 				err := os.RemoveAll(path)
+				reprotect()
 				if err != nil {
+					queueCompositeSave(folder)
 					http.Error(w, fmt.Sprintf("Failed to remove files %s: %v", path, err), http.StatusInternalServerError)
 					return
 				}
+				if err := folder.RemoveFileOrderPreserving(path); err != nil {
+					fmt.Println("Error removing file:", path, "Error:", err)
+				}
+				if err := removeSidecar(sidecar); err != nil {
+					queueCompositeSave(folder)
+					http.Error(w, fmt.Sprintf("Failed to remove sidecar %s: %v", sidecar, err), http.StatusInternalServerError)
+					return
+				}
 			}
+			queueCompositeSave(folder)
 			children := GoSidecreateDirectoryJSONStructure(folder)
 
 			root := DirectoryTreeJson{
@@ -379,12 +420,15 @@ func ReturnTypeHandler(w http.ResponseWriter, r *http.Request) {
 					})
 				}
 			} else if types == "TAGS" {
+				inherited := inheritedFileTags(c)
 				for k := range ObjectMap[name] {
-					if len(c.GetFile(k).Tags) > 0 {
+					file := c.GetFile(k)
+					if len(file.Tags) > 0 || len(inherited[file]) > 0 {
 						returnList = append(returnList, returnStruct{
-							FilePath: k,
-							FileName: c.GetFile(k).Name,
-							FileTags: c.GetFile(k).Tags,
+							FilePath:      k,
+							FileName:      file.Name,
+							FileTags:      file.Tags,
+							InheritedTags: inherited[file],
 						})
 					}
 				}
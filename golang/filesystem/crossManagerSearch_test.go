@@ -0,0 +1,80 @@
+package filesystem
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	pb "github.com/COS301-SE-2025/Smart-File-Manager/golang/client/protos"
+)
+
+func crossManagers() []*Folder {
+	work := &Folder{Name: "work", Path: "/work", Files: []*File{
+		{Name: "invoice_2023.pdf", Path: "/work/invoice_2023.pdf", Keywords: []*pb.Keyword{{Keyword: "tax", Score: 1}}},
+		{Name: "invoice.pdf", Path: "/work/invoice.pdf"},
+	}}
+	home := &Folder{Name: "home", Path: "/home", Files: []*File{
+		{Name: "invoice.pdf", Path: "/home/invoice.pdf", Keywords: []*pb.Keyword{{Keyword: "tab", Score: 1}}},
+		{Name: "holiday.jpg", Path: "/home/photos/holiday.jpg"},
+	}}
+	// nested inside home, its files must not show up twice
+	photos := &Folder{Name: "photos", Path: "/home/photos", Files: []*File{
+		{Name: "holiday.jpg", Path: "/home/photos/holiday.jpg"},
+	}}
+	return []*Folder{work, home, photos}
+}
+
+func TestSearchHandler_AllManagers(t *testing.T) {
+	orig := Composites
+	defer func() { Composites = orig }()
+	Composites = crossManagers()
+
+	res := decodePage(t, "all", func(rr *httptest.ResponseRecorder) {
+		SearchHandler(rr, httptest.NewRequest("GET", "/search?all=true&searchText=invoice", nil))
+	})
+	if res.Name != allManagersName || res.Total != 3 {
+		t.Fatalf("expected 3 invoices over all managers, got %d", res.Total)
+	}
+	// equal scores across managers fall back to name then path
+	want := [][2]string{{"/home/invoice.pdf", "home"}, {"/work/invoice.pdf", "work"}, {"/work/invoice_2023.pdf", "work"}}
+	for i, w := range want {
+		if res.Children[i].Path != w[0] || res.Children[i].Manager != w[1] {
+			t.Fatalf("hit %d = %s (%s), want %s (%s)", i, res.Children[i].Path, res.Children[i].Manager, w[0], w[1])
+		}
+	}
+
+	// whichever manager is searched first, the file belongs to the inner one
+	for _, order := range [][]int{{0, 1, 2}, {2, 1, 0}} {
+		managers := crossManagers()
+		Composites = []*Folder{managers[order[0]], managers[order[1]], managers[order[2]]}
+		res = decodePage(t, "nested", func(rr *httptest.ResponseRecorder) {
+			SearchHandler(rr, httptest.NewRequest("GET", "/search?all=true&searchText=holiday", nil))
+		})
+		if res.Total != 1 || res.Children[0].Manager != "photos" {
+			t.Fatalf("a file in nested managers should be listed once for the inner one, got %+v", res.Children)
+		}
+	}
+
+	// a single manager search stays unlabelled
+	res = decodePage(t, "single", func(rr *httptest.ResponseRecorder) {
+		SearchHandler(rr, httptest.NewRequest("GET", "/search?compositeName=work&searchText=invoice", nil))
+	})
+	if res.Total != 2 || res.Children[0].Manager != "" {
+		t.Fatalf("unexpected single manager result %+v", res.Children)
+	}
+}
+
+func TestKeywordSearchHandler_AllManagers(t *testing.T) {
+	orig := Composites
+	defer func() { Composites = orig }()
+	Composites = crossManagers()
+
+	res := decodePage(t, "all", func(rr *httptest.ResponseRecorder) {
+		KeywordSearchHadler(rr, httptest.NewRequest("GET", "/keywordSearch?all=true&searchText=tax", nil))
+	})
+	if res.Total != 2 {
+		t.Fatalf("expected both keyword hits, got %+v", res.Children)
+	}
+	if res.Children[0].Path != "/work/invoice_2023.pdf" || res.Children[0].Manager != "work" || res.Children[1].Manager != "home" {
+		t.Fatalf("the exact keyword should rank first whatever its manager, got %+v", res.Children)
+	}
+}
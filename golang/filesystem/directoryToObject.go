@@ -26,6 +26,7 @@ func ConvertToObject(managerName, folderPath string) (*Folder, error) {
 	if err := exploreDown(root, cleanPath); err != nil {
 		return nil, fmt.Errorf("error exploring folder %q: %w", cleanPath, err)
 	}
+	root.nameIndex = buildNameIndex(root)
 
 	return root, nil
 }
@@ -65,11 +66,15 @@ func exploreDown(folder *Folder, path string) error {
 				Metadata: []*MetadataEntry{},
 				Tags:     []string{},
 				Locked:   false,
+				Identity: fileIdentity(info),
 			}
+			file.Size, file.ModTime = stampOfInfo(info)
 			folder.AddFile(file)
 		}
 	}
 
+	attachSidecars(folder)
+
 	for _, sub := range folder.Subfolders {
 		if strings.HasPrefix(sub.Name, ".") {
 			folder.LockByPath(folder.Path)
@@ -0,0 +1,211 @@
+package filesystem
+
+// tags can be mirrored to places other tools read: extended attributes (xattrTags.go)
+// and XMP sidecars (xmpSidecars.go). both are opt-in per manager, import after a scan
+// and export whenever the composite is persisted.
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+)
+
+// what wins when the external copy and the app disagree during import
+const (
+	tagConflictMerge    = "merge"    // union of both
+	tagConflictApp      = "app"      // app tags overwrite the external copy
+	tagConflictExternal = "external" // the external copy replaces app tags when it exists
+)
+
+type TagSyncSettings struct {
+	Enabled  bool   `json:"enabled"`
+	Conflict string `json:"conflict"`
+}
+
+type TagSyncResult struct {
+	Imported  int    `json:"imported"`
+	Written   int    `json:"written"`
+	Errors    int    `json:"errors"`
+	LastError string `json:"lastError,omitempty"`
+}
+
+func (res *TagSyncResult) fail(err error) {
+	res.Errors++
+	res.LastError = err.Error()
+}
+
+func (res *TagSyncResult) add(other TagSyncResult) {
+	res.Imported += other.Imported
+	res.Written += other.Written
+	res.Errors += other.Errors
+	if other.LastError != "" {
+		res.LastError = other.LastError
+	}
+}
+
+func (s *TagSyncSettings) enabled() bool {
+	return s != nil && s.Enabled
+}
+
+// resolveTagConflict returns the tags a file should carry after reading an external copy
+func resolveTagConflict(app, external []string, mode string) []string {
+	switch mode {
+	case tagConflictApp:
+		return app
+	case tagConflictExternal:
+		return external
+	default:
+		resolved := append([]string{}, app...)
+		for _, t := range external {
+			if !containsString(resolved, t) {
+				resolved = append(resolved, t)
+			}
+		}
+		return resolved
+	}
+}
+
+// applyResolvedTags sets the resolved tags and reports whether they changed
+func applyResolvedTags(file *File, external []string, mode string) bool {
+	resolved := resolveTagConflict(file.Tags, external, mode)
+	if formatXattrTags(resolved) == formatXattrTags(file.Tags) {
+		return false
+	}
+	file.Tags = resolved
+	return true
+}
+
+// importExternalTags runs after a scan, it returns true when app tags changed
+func importExternalTags(c *Folder) bool {
+	changed := false
+	if xattrSyncEnabled(c) {
+		res := importXattrTags(c)
+		logTagSyncErrors("xattr import", c, res)
+		changed = changed || res.Imported > 0
+	}
+	if c.XmpSync.enabled() {
+		res := importXmpTags(c)
+		logTagSyncErrors("xmp import", c, res)
+		changed = changed || res.Imported > 0
+	}
+	return changed
+}
+
+// tagWrite is one file's tags on their way to an external copy. it is planned under mu,
+// written without it and recorded on the file under mu again.
+type tagWrite struct {
+	file *File
+	// the file for the attribute, the sidecar for xmp
+	path string
+	// stored mode of the protected item the write needs, the file for the attribute,
+	// its folder for a new sidecar. nil when it is not write protected
+	protected *os.FileMode
+	tags      []string
+	want      string
+	err       error
+}
+
+// tagExports are the external writes one persist of a composite owes
+type tagExports struct {
+	comp  *Folder
+	xattr []tagWrite
+	xmp   []tagWrite
+}
+
+// planTagExports collects the out of date external copies, caller holds mu
+func planTagExports(c *Folder) *tagExports {
+	e := &tagExports{comp: c}
+	if xattrSyncEnabled(c) {
+		e.xattr = planXattrExport(c)
+	}
+	if c.XmpSync.enabled() {
+		e.xmp = planXmpExport(c)
+	}
+	return e
+}
+
+// write does the disk work, mu is not needed
+func (e *tagExports) write() {
+	for i := range e.xattr {
+		writeXattrExport(&e.xattr[i])
+	}
+	for i := range e.xmp {
+		writeXmpExport(&e.xmp[i])
+	}
+}
+
+// record notes the outcome on the files and logs failures, caller holds mu
+func (e *tagExports) record() {
+	if len(e.xattr) > 0 {
+		logTagSyncErrors("xattr export", e.comp, recordXattrExport(e.xattr))
+	}
+	if len(e.xmp) > 0 {
+		logTagSyncErrors("xmp export", e.comp, recordXmpExport(e.xmp))
+	}
+}
+
+// exportExternalTags runs whenever the composite is saved directly, the
+// persistence queue plans, writes and records on its own (persistQueue.go)
+func exportExternalTags(c *Folder) {
+	e := planTagExports(c)
+	e.write()
+	e.record()
+}
+
+func logTagSyncErrors(what string, c *Folder, res TagSyncResult) {
+	if res.Errors > 0 {
+		log.Printf("%s for %s: %d error(s), last: %s", what, c.Name, res.Errors, res.LastError)
+	}
+}
+
+// tagSyncHandler shows a sync setting, or changes it when enabled is given.
+// enabling runs a full import and export straight away.
+func tagSyncHandler(w http.ResponseWriter, r *http.Request, setting func(c *Folder) **TagSyncSettings,
+	unsupported string, sync func(c *Folder) TagSyncResult) {
+	q := r.URL.Query()
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	c := findComposite(q.Get("name"))
+	if c == nil {
+		http.Error(w, "No smart manager with that name", http.StatusBadRequest)
+		return
+	}
+
+	response := struct {
+		Settings TagSyncSettings `json:"settings"`
+		Result   *TagSyncResult  `json:"result,omitempty"`
+	}{}
+
+	if enabled := q.Get("enabled"); enabled != "" {
+		conflict := q.Get("conflict")
+		if conflict == "" {
+			conflict = tagConflictMerge
+		}
+		if conflict != tagConflictMerge && conflict != tagConflictApp && conflict != tagConflictExternal {
+			http.Error(w, "conflict must be merge, app or external", http.StatusBadRequest)
+			return
+		}
+		if enabled == "true" && unsupported != "" {
+			http.Error(w, unsupported, http.StatusBadRequest)
+			return
+		}
+
+		*setting(c) = &TagSyncSettings{Enabled: enabled == "true", Conflict: conflict}
+		if enabled == "true" {
+			res := sync(c)
+			response.Result = &res
+		}
+		saveCompositeDetails(c)
+	}
+
+	if s := *setting(c); s != nil {
+		response.Settings = *s
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
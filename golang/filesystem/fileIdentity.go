@@ -0,0 +1,262 @@
+package filesystem
+
+import (
+	"os"
+	"sync"
+)
+
+// files keep a stable identity (device+inode where the platform has one) and,
+// for files carrying tags or locks, a content hash. both are stored alongside
+// the path so metadata can follow a file that was renamed or moved outside the app.
+// the hash is stored with the size and modification time it was taken at and only
+// computed again once they change. saves stat and hash outside mu, the encoding of
+// the tree under mu only looks the results up.
+
+// fileStampRecord is the size and modification time of a file and its hash at that point
+type fileStampRecord struct {
+	size    int64
+	modTime int64
+	hash    string
+}
+
+// stamps of the stored files with metadata, by manager and path
+var storedStamps = struct {
+	sync.Mutex
+	byManager map[string]map[string]fileStampRecord
+}{byManager: make(map[string]map[string]fileStampRecord)}
+
+// stampRequest is a stored file whose stamp a save needs
+type stampRequest struct {
+	path     string
+	needHash bool
+	known    fileStampRecord
+}
+
+// statFileIdentity returns the identity of the file at path, or "" if it cannot be read
+func statFileIdentity(path string) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return ""
+	}
+	return fileIdentity(info)
+}
+
+// hashIfRegular only hashes real files so fake/test paths stay quiet
+func hashIfRegular(path string) string {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return ""
+	}
+	return computeFileHash(path)
+}
+
+// fileStamp returns the size and modification time stored to confirm an identity match
+func fileStamp(path string) (int64, int64) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, 0
+	}
+	return stampOfInfo(info)
+}
+
+func stampOfInfo(info os.FileInfo) (int64, int64) {
+	if !info.Mode().IsRegular() {
+		return 0, 0
+	}
+	return info.Size(), info.ModTime().UnixNano()
+}
+
+// stampRequests lists the files of c that are stored with metadata, caller holds mu
+func stampRequests(c *Folder) []stampRequest {
+	var reqs []stampRequest
+	var walk func(f *Folder)
+	walk = func(f *Folder) {
+		for _, file := range f.Files {
+			if len(file.Tags) == 0 && !file.Locked && len(file.Keywords) == 0 {
+				continue
+			}
+			reqs = append(reqs, stampRequest{
+				path:     file.Path,
+				needHash: len(file.Tags) > 0 || file.Locked,
+				known:    fileStampRecord{size: file.Size, modTime: file.ModTime, hash: file.ContentHash},
+			})
+		}
+		for _, sub := range f.Subfolders {
+			walk(sub)
+		}
+	}
+	walk(c)
+	return reqs
+}
+
+// refreshStamps stats the requested files and hashes the ones that changed since
+// their last hash. it reads the disk and does not need mu.
+func refreshStamps(name string, reqs []stampRequest) {
+	storedStamps.Lock()
+	previous := storedStamps.byManager[name]
+	storedStamps.Unlock()
+
+	fresh := make(map[string]fileStampRecord, len(reqs))
+	for _, req := range reqs {
+		size, modTime := fileStamp(req.path)
+		if modTime == 0 {
+			continue
+		}
+		rec := fileStampRecord{size: size, modTime: modTime}
+		for _, known := range []fileStampRecord{req.known, previous[req.path]} {
+			if known.hash != "" && known.size == size && known.modTime == modTime {
+				rec.hash = known.hash
+			}
+		}
+		if rec.hash == "" && req.needHash {
+			rec.hash = computeFileHash(req.path)
+		}
+		fresh[req.path] = rec
+	}
+
+	storedStamps.Lock()
+	storedStamps.byManager[name] = fresh
+	storedStamps.Unlock()
+}
+
+// storedStampsOf returns the stamps the last refresh found for a manager
+func storedStampsOf(name string) map[string]fileStampRecord {
+	storedStamps.Lock()
+	defer storedStamps.Unlock()
+	return storedStamps.byManager[name]
+}
+
+// stampOf is the stamp stored for file, the one taken at scan time without a fresher one
+func stampOf(file *File, stamps map[string]fileStampRecord) fileStampRecord {
+	if rec, ok := stamps[file.Path]; ok {
+		return rec
+	}
+	return fileStampRecord{size: file.Size, modTime: file.ModTime, hash: file.ContentHash}
+}
+
+// confirmsIdentity checks that file, found by the identity of node, is the file node
+// was stored for and not a new one that got the inode of a deleted file. a rename
+// keeps size and modification time, a file only touched since keeps its content hash.
+// nodes stored without either are not trusted.
+func confirmsIdentity(file *File, node FileNode) bool {
+	if node.ModTime != 0 {
+		if size, modTime := fileStamp(file.Path); size == node.Size && modTime == node.ModTime {
+			return true
+		}
+	}
+	if node.ContentHash == "" {
+		return false
+	}
+	if file.ContentHash == "" {
+		file.ContentHash = hashIfRegular(file.Path)
+	}
+	return file.ContentHash == node.ContentHash
+}
+
+// storedNodeHasMetadata reports whether a stored node carries anything worth re-attaching
+func storedNodeHasMetadata(node FileNode) bool {
+	return len(node.Tags) > 0 || node.Locked || len(node.Keywords) > 0
+}
+
+// applyStoredFileNode copies persisted metadata from a stored node onto a composite file
+func applyStoredFileNode(file *File, node FileNode) {
+	file.Keywords = node.Keywords
+	file.Tags = node.Tags
+	file.RuleTags = node.RuleTags
+	file.Locked = node.Locked
+	file.LockInfo = node.Lock
+	if node.OriginalMode != nil {
+		file.OriginalMode = node.OriginalMode
+	}
+	// a stored hash only describes the file while size and modification time are the same
+	if file.ContentHash == "" && node.ModTime != 0 && node.Size == file.Size && node.ModTime == file.ModTime {
+		file.ContentHash = node.ContentHash
+	}
+}
+
+// reattachOrphanedMetadata matches stored nodes whose path no longer exists against
+// files that appeared at a path the storage did not know about. identity is tried
+// first and confirmed by size and modification time or the content hash, the content
+// hash alone is only looked up when that fails.
+func reattachOrphanedMetadata(comp *Folder, orphans []FileNode, claimed map[string]struct{}) int {
+	if len(orphans) == 0 {
+		return 0
+	}
+
+	var candidates []*File
+	var collect func(f *Folder)
+	collect = func(f *Folder) {
+		for _, file := range f.Files {
+			if _, ok := claimed[file.Path]; !ok {
+				candidates = append(candidates, file)
+			}
+		}
+		for _, sub := range f.Subfolders {
+			collect(sub)
+		}
+	}
+	collect(comp)
+
+	if len(candidates) == 0 {
+		return 0
+	}
+
+	byIdentity := make(map[string]*File, len(candidates))
+	for _, file := range candidates {
+		if file.Identity == "" {
+			file.Identity = statFileIdentity(file.Path)
+		}
+		if file.Identity != "" {
+			byIdentity[file.Identity] = file
+		}
+	}
+
+	// hashes are computed once and only if some orphan needs the fallback
+	var byHash map[string]*File
+	hashCandidates := func() {
+		if byHash != nil {
+			return
+		}
+		byHash = make(map[string]*File, len(candidates))
+		for _, file := range candidates {
+			if file.ContentHash == "" {
+				file.ContentHash = hashIfRegular(file.Path)
+			}
+			if file.ContentHash != "" {
+				if _, exists := byHash[file.ContentHash]; !exists {
+					byHash[file.ContentHash] = file
+				}
+			}
+		}
+	}
+
+	reattached := 0
+	for _, orphan := range orphans {
+		var match *File
+		if orphan.Identity != "" {
+			if found := byIdentity[orphan.Identity]; found != nil && confirmsIdentity(found, orphan) {
+				match = found
+			}
+		}
+		if match == nil && orphan.ContentHash != "" {
+			hashCandidates()
+			match = byHash[orphan.ContentHash]
+		}
+		if match == nil {
+			continue
+		}
+		if _, taken := claimed[match.Path]; taken {
+			continue
+		}
+
+		applyStoredFileNode(match, orphan)
+		claimed[match.Path] = struct{}{}
+		delete(byIdentity, match.Identity)
+		if byHash != nil {
+			delete(byHash, match.ContentHash)
+		}
+		reattached++
+	}
+
+	return reattached
+}
@@ -0,0 +1,186 @@
+package filesystem
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// chdirTemp runs the test inside a temp dir so storage/ is isolated
+func chdirTemp(t *testing.T) string {
+	t.Helper()
+	tmp := t.TempDir()
+	cwd, _ := os.Getwd()
+	if err := os.Chdir(tmp); err != nil {
+		t.Fatalf("chdir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(cwd) })
+	return tmp
+}
+
+func TestReattach_RenamedFileKeepsTagsByIdentity(t *testing.T) {
+	tmp := chdirTemp(t)
+	root := filepath.Join(tmp, "managed")
+	if err := os.MkdirAll(filepath.Join(root, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	oldPath := filepath.Join(root, "report.txt")
+	if err := os.WriteFile(oldPath, []byte("quarterly numbers"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	comp, err := ConvertToObject("ident", root)
+	if err != nil {
+		t.Fatalf("ConvertToObject: %v", err)
+	}
+	if comp.GetFile(oldPath).Identity == "" {
+		t.Skip("platform does not expose inode identity")
+	}
+	comp.AddTagToFile(oldPath, "finance")
+	comp.LockByPath(oldPath)
+	saveCompositeDetails(comp)
+
+	// rename outside the app
+	newPath := filepath.Join(root, "sub", "renamed.txt")
+	if err := os.Rename(oldPath, newPath); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := ConvertToObject("ident", root)
+	if err != nil {
+		t.Fatalf("ConvertToObject: %v", err)
+	}
+	populateKeywordsFromStoredJsonFile(reloaded)
+
+	moved := reloaded.GetFile(newPath)
+	if moved == nil {
+		t.Fatalf("renamed file not found in composite")
+	}
+	if len(moved.Tags) != 1 || moved.Tags[0] != "finance" || !moved.Locked {
+		t.Fatalf("metadata not re-attached: tags=%v locked=%v", moved.Tags, moved.Locked)
+	}
+}
+
+func TestReattach_FallsBackToContentHash(t *testing.T) {
+	tmp := chdirTemp(t)
+	oldPath := filepath.Join(tmp, "old.txt")
+	newPath := filepath.Join(tmp, "copy.txt")
+	other := filepath.Join(tmp, "other.txt")
+	if err := os.WriteFile(newPath, []byte("same bytes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(other, []byte("different bytes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	comp := &Folder{
+		Name: "hash",
+		Path: tmp,
+		Files: []*File{
+			{Name: "copy.txt", Path: newPath, Identity: "1:1"},
+			{Name: "other.txt", Path: other, Identity: "1:2"},
+		},
+	}
+	orphans := []FileNode{{
+		Name:        "old.txt",
+		Path:        oldPath,
+		Tags:        []string{"keep"},
+		Identity:    "9:9", // inode changed, e.g. copied across filesystems
+		ContentHash: computeFileHash(newPath),
+	}}
+
+	if n := reattachOrphanedMetadata(comp, orphans, map[string]struct{}{}); n != 1 {
+		t.Fatalf("expected 1 re-attached file, got %d", n)
+	}
+	if got := comp.GetFile(newPath).Tags; len(got) != 1 || got[0] != "keep" {
+		t.Fatalf("expected tags on copy, got %v", got)
+	}
+	if got := comp.GetFile(other).Tags; len(got) != 0 {
+		t.Fatalf("unrelated file should not get tags, got %v", got)
+	}
+}
+
+func TestReattach_ClaimedPathsAreNotReused(t *testing.T) {
+	comp := &Folder{
+		Name:  "claimed",
+		Files: []*File{{Name: "a.txt", Path: "/x/a.txt", Identity: "1:5"}},
+	}
+	claimed := map[string]struct{}{"/x/a.txt": {}}
+	orphans := []FileNode{{Path: "/x/gone.txt", Tags: []string{"t"}, Identity: "1:5"}}
+
+	if n := reattachOrphanedMetadata(comp, orphans, claimed); n != 0 {
+		t.Fatalf("expected no re-attach onto a path that already had stored metadata, got %d", n)
+	}
+}
+
+func TestReattach_IdentityNeedsConfirmation(t *testing.T) {
+	tmp := chdirTemp(t)
+	path := filepath.Join(tmp, "new.txt")
+	if err := os.WriteFile(path, []byte("a new file on a reused inode"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	size, modTime := fileStamp(path)
+	orphan := func(node FileNode) []FileNode {
+		node.Path, node.Tags, node.Identity = filepath.Join(tmp, "deleted.txt"), []string{"stale"}, "1:5"
+		return []FileNode{node}
+	}
+	cases := []struct {
+		name string
+		node FileNode
+		want int
+	}{
+		{"nothing to confirm with", FileNode{}, 0},
+		{"other size and time", FileNode{Size: size + 1, ModTime: modTime - 1}, 0},
+		{"other content", FileNode{ContentHash: "not the hash"}, 0},
+		{"renamed", FileNode{Size: size, ModTime: modTime}, 1},
+		{"touched and renamed", FileNode{ModTime: modTime - 1, ContentHash: computeFileHash(path)}, 1},
+	}
+	for _, tc := range cases {
+		comp := &Folder{Name: "reuse", Path: tmp, Files: []*File{{Name: "new.txt", Path: path, Identity: "1:5"}}}
+		if n := reattachOrphanedMetadata(comp, orphan(tc.node), map[string]struct{}{}); n != tc.want {
+			t.Errorf("%s: expected %d re-attached, got %d", tc.name, tc.want, n)
+		}
+	}
+}
+
+func TestSave_StoredHashFollowsContentChanges(t *testing.T) {
+	tmp := chdirTemp(t)
+	root := filepath.Join(tmp, "managed")
+	os.MkdirAll(root, 0755)
+	path := filepath.Join(root, "draft.txt")
+	os.WriteFile(path, []byte("first draft"), 0644)
+
+	comp, err := ConvertToObject("stamps", root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	comp.AddTagToFile(path, "writing")
+	saveCompositeDetails(comp)
+	stored := readStoredTree(t, "stamps")
+	if stored.Children[0].ContentHash != computeFileHash(path) || stored.Children[0].ModTime == 0 {
+		t.Fatalf("expected hash and stamp of the first draft, got %+v", stored.Children[0])
+	}
+
+	// edited after the scan, the in-memory file still has the old stamp and hash
+	os.WriteFile(path, []byte("second, longer draft"), 0644)
+	saveCompositeDetails(comp)
+	stored = readStoredTree(t, "stamps")
+	size, modTime := fileStamp(path)
+	node := stored.Children[0]
+	if node.ContentHash != computeFileHash(path) || node.Size != size || node.ModTime != modTime {
+		t.Fatalf("expected hash and stamp of the second draft, got %+v", node)
+	}
+
+	// a stored hash is only taken over while the file is unchanged
+	stale := node
+	stale.ModTime--
+	fresh := &File{Path: path, Size: size, ModTime: modTime}
+	applyStoredFileNode(fresh, stale)
+	if fresh.ContentHash != "" {
+		t.Fatalf("a hash of another version must not be taken over")
+	}
+	applyStoredFileNode(fresh, node)
+	if fresh.ContentHash != node.ContentHash {
+		t.Fatalf("the hash of the same version should be taken over")
+	}
+}
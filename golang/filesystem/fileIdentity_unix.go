@@ -0,0 +1,21 @@
+//go:build !windows
+
+package filesystem
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// fileIdentity builds a device:inode key that survives renames on the same filesystem
+func fileIdentity(info os.FileInfo) string {
+	if info == nil {
+		return ""
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || st == nil {
+		return ""
+	}
+	return fmt.Sprintf("%d:%d", st.Dev, st.Ino)
+}
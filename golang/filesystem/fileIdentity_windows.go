@@ -0,0 +1,12 @@
+//go:build windows
+
+package filesystem
+
+import (
+	"os"
+)
+
+// fileIdentity has no cheap equivalent here, callers fall back to the content hash
+func fileIdentity(info os.FileInfo) string {
+	return ""
+}
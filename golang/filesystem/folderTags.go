@@ -0,0 +1,90 @@
+package filesystem
+
+// folders can be tagged like files. a folder tag added with inherit=true also applies
+// to every file beneath the folder when searching and filtering. nothing is copied onto
+// the files, so files added later pick the tag up as well.
+
+import (
+	"net/http"
+)
+
+// inheritedFileTags maps every file below an inheriting folder to the tags it inherits
+func inheritedFileTags(c *Folder) map[*File][]string {
+	result := map[*File][]string{}
+	var walk func(f *Folder, inherited []string)
+	walk = func(f *Folder, inherited []string) {
+		// copy on append so siblings never share a backing array
+		inherited = append(inherited[:len(inherited):len(inherited)], f.InheritTags...)
+		if len(inherited) > 0 {
+			for _, file := range f.Files {
+				result[file] = inherited
+			}
+		}
+		for _, sub := range f.Subfolders {
+			walk(sub, inherited)
+		}
+	}
+	walk(c, nil)
+	return result
+}
+
+// addFolderTagHandler tags a folder, inherit=true makes the tag apply to everything beneath it
+func addFolderTagHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	path := ConvertToWSLPath(r.URL.Query().Get("path"))
+	tag := normalizeTag(r.URL.Query().Get("tag"))
+	inherit := r.URL.Query().Get("inherit") == "true"
+	if name == "" || path == "" || tag == "" {
+		w.Write([]byte("false"))
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	c := findComposite(name)
+	if c == nil {
+		w.Write([]byte("false"))
+		return
+	}
+	// the root is the manager itself, its tags are not stored
+	folder := c.GetSubfolder(path)
+	if folder == nil || folder == c {
+		w.Write([]byte("false"))
+		return
+	}
+
+	folder.AddTagToSelf("", tag)
+	folder.SetTagInheritance(tag, inherit)
+	queueCompositeSave(c)
+	w.Write([]byte("true"))
+}
+
+func removeFolderTagHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	path := ConvertToWSLPath(r.URL.Query().Get("path"))
+	tag := normalizeTag(r.URL.Query().Get("tag"))
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	c := findComposite(name)
+	if c == nil {
+		w.Write([]byte("false"))
+		return
+	}
+	folder := c.GetSubfolder(path)
+	if folder == nil || folder == c {
+		w.Write([]byte("false"))
+		return
+	}
+	if !guardLocks(w, r, "remove folder tag", lockBlockers(c, []string{path}, false)) {
+		return
+	}
+	if !folder.RemoveTag(tag) {
+		w.Write([]byte("false"))
+		return
+	}
+	queueCompositeSave(c)
+	w.Write([]byte("true"))
+}
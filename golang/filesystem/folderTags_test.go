@@ -0,0 +1,133 @@
+package filesystem
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+func inheritFolder() *Folder {
+	return &Folder{
+		Name: "inherit",
+		Path: "/inherit",
+		Subfolders: []*Folder{
+			{
+				Name:  "projects",
+				Path:  "/inherit/projects",
+				Files: []*File{{Name: "plan.txt", Path: "/inherit/projects/plan.txt"}},
+				Subfolders: []*Folder{
+					{
+						Name:  "deep",
+						Path:  "/inherit/projects/deep",
+						Files: []*File{{Name: "notes.txt", Path: "/inherit/projects/deep/notes.txt"}},
+					},
+				},
+			},
+			{
+				Name:  "other",
+				Path:  "/inherit/other",
+				Files: []*File{{Name: "misc.txt", Path: "/inherit/other/misc.txt"}},
+			},
+		},
+	}
+}
+
+func TestAddTagToSelf_NormalisesAndSkipsDuplicates(t *testing.T) {
+	f := &Folder{Name: "f", Path: "/f"}
+	if !f.AddTagToSelf("", " work / q1 ") {
+		t.Fatal("expected tag to be added")
+	}
+	if f.AddTagToSelf("", "work/q1") {
+		t.Fatal("duplicate tag should not be added")
+	}
+	if len(f.Tags) != 1 || f.Tags[0] != "work/q1" {
+		t.Fatalf("unexpected tags %v", f.Tags)
+	}
+}
+
+func TestInheritedTags_ApplyToFilesBeneath(t *testing.T) {
+	c := inheritFolder()
+	projects := c.Subfolders[0]
+	projects.AddTagToSelf("", "work")
+	projects.SetTagInheritance("work", true)
+
+	files := findFilesByTag(c, "work")
+	if len(files) != 2 {
+		t.Fatalf("expected plan.txt and notes.txt, got %d files", len(files))
+	}
+
+	// a file added after tagging picks the tag up too
+	projects.Subfolders[0].AddFile(&File{Name: "later.txt", Path: "/inherit/projects/deep/later.txt"})
+	if got := len(findFilesByTag(c, "work")); got != 3 {
+		t.Fatalf("expected newly added file to inherit, got %d files", got)
+	}
+
+	// nothing was copied onto the files themselves
+	if len(projects.Files[0].Tags) != 0 {
+		t.Fatalf("inherit must not copy tags, got %v", projects.Files[0].Tags)
+	}
+}
+
+func TestInheritedTags_OnlyWhenInheritSet(t *testing.T) {
+	c := inheritFolder()
+	c.Subfolders[0].AddTagToSelf("", "work")
+
+	if got := len(findFilesByTag(c, "work")); got != 0 {
+		t.Fatalf("plain folder tag should not apply to files, got %d", got)
+	}
+
+	c.Subfolders[0].SetTagInheritance("work", true)
+	c.Subfolders[0].RemoveTag("work")
+	if len(c.Subfolders[0].InheritTags) != 0 {
+		t.Fatalf("removing the tag should drop its inheritance, got %v", c.Subfolders[0].InheritTags)
+	}
+}
+
+func TestFolderTagHandlers(t *testing.T) {
+	chdirTemp(t)
+	orig := Composites
+	defer func() { Composites = orig }()
+	Composites = []*Folder{inheritFolder()}
+
+	rr := httptest.NewRecorder()
+	addFolderTagHandler(rr, httptest.NewRequest("GET", "/addFolderTag?name=inherit&path=/inherit/projects&tag=work&inherit=true", nil))
+	if rr.Body.String() != "true" {
+		t.Fatalf("expected true, got %s", rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	addFolderTagHandler(rr, httptest.NewRequest("GET", "/addFolderTag?name=inherit&path=/inherit&tag=work", nil))
+	if rr.Body.String() != "false" {
+		t.Fatalf("tagging the manager root should be refused, got %s", rr.Body.String())
+	}
+
+	stored := readStoredTree(t, "inherit")
+	var projects *FileNode
+	for i := range stored.Children {
+		if stored.Children[i].Path == "/inherit/projects" {
+			projects = &stored.Children[i]
+		}
+	}
+	if projects == nil || len(projects.InheritTags) != 1 || projects.InheritTags[0] != "work" {
+		t.Fatalf("inherit flag not persisted: %+v", projects)
+	}
+
+	rr = httptest.NewRecorder()
+	SearchHandler(rr, httptest.NewRequest("GET", "/search?compositeName=inherit&searchText=notes&tag=work", nil))
+	var resp DirectoryTreeJson
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Children) != 1 || resp.Children[0].Name != "notes.txt" {
+		t.Fatalf("expected the inheriting notes.txt in tag filtered search, got %+v", resp.Children)
+	}
+
+	rr = httptest.NewRecorder()
+	removeFolderTagHandler(rr, httptest.NewRequest("GET", "/removeFolderTag?name=inherit&path=/inherit/projects&tag=work", nil))
+	if rr.Body.String() != "true" {
+		t.Fatalf("expected true, got %s", rr.Body.String())
+	}
+	if got := len(findFilesByTag(Composites[0], "work")); got != 0 {
+		t.Fatalf("expected no files after removing folder tag, got %d", got)
+	}
+}
@@ -0,0 +1,641 @@
+package filesystem
+
+// full-text search over file contents. every manager gets an inverted index of the
+// words in its text files (the ones keyword extraction reads), in docx/odt documents
+// and in pdfs (see pdfText.go for what is read of those), with word positions so quoted
+// phrases can be matched. the index is kept in storage/index/<manager>.json and
+// refreshed on startUp and after a tree load, only files whose size or modification
+// time changed are read again. snippets are cut from the current file
+// contents when a page of results is returned.
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+var textIndexDir = filepath.Join("storage", "index")
+
+const textIndexVersion = 1
+
+// same limit as keyword extraction
+const maxIndexedTextSize int64 = 50 * 1024 * 1024
+
+const maxSnippetsPerFile = 3
+const snippetWidth = 160
+
+// indexedDoc is one file in the index. Terms is empty for files without text, they are
+// kept so an unchanged binary file is not sniffed again on every refresh.
+type indexedDoc struct {
+	ModTime time.Time        `json:"modTime"`
+	Size    int64            `json:"size"`
+	Terms   map[string][]int `json:"terms,omitempty"`
+}
+
+type storedTextIndex struct {
+	Version int                    `json:"version"`
+	Docs    map[string]*indexedDoc `json:"docs"`
+}
+
+type textIndex struct {
+	mu    sync.RWMutex
+	docs  map[string]*indexedDoc
+	terms map[string]map[string]struct{}
+
+	// one refresh at a time per manager
+	refreshMu sync.Mutex
+}
+
+func newTextIndex() *textIndex {
+	return &textIndex{
+		docs:  make(map[string]*indexedDoc),
+		terms: make(map[string]map[string]struct{}),
+	}
+}
+
+func textIndexPath(name string) string {
+	return filepath.Join(textIndexDir, name+".json")
+}
+
+// textIndexFor returns the index of c, loading the stored one the first time.
+// caller holds mu or c is not yet in Composites.
+func textIndexFor(c *Folder) *textIndex {
+	if c.textIndex == nil {
+		c.textIndex = loadTextIndex(c.Name)
+	}
+	return c.textIndex
+}
+
+// loadTextIndex reads the stored index, a missing or outdated one starts empty
+func loadTextIndex(name string) *textIndex {
+	idx := newTextIndex()
+	data, err := os.ReadFile(textIndexPath(name))
+	if err != nil {
+		return idx
+	}
+	var stored storedTextIndex
+	if err := json.Unmarshal(data, &stored); err != nil || stored.Version != textIndexVersion {
+		log.Printf("ignoring stored text index of %s", name)
+		return idx
+	}
+	for path, doc := range stored.Docs {
+		idx.putLocked(path, doc)
+	}
+	return idx
+}
+
+// cleanupOrphanTextIndexes deletes the stored indexes of managers that are not in recs
+func cleanupOrphanTextIndexes(recs []ManagerRecord) error {
+	allowed := make(map[string]struct{}, len(recs))
+	for _, r := range recs {
+		if r.Name != "" {
+			allowed[r.Name+".json"] = struct{}{}
+		}
+	}
+	entries, err := os.ReadDir(textIndexDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	var firstErr error
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || filepath.Ext(name) != ".json" {
+			continue
+		}
+		if _, ok := allowed[name]; ok {
+			continue
+		}
+		if err := os.Remove(filepath.Join(textIndexDir, name)); err != nil && !os.IsNotExist(err) && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (idx *textIndex) save(name string) error {
+	idx.mu.RLock()
+	out, err := json.Marshal(storedTextIndex{Version: textIndexVersion, Docs: idx.docs})
+	idx.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(textIndexDir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(textIndexDir, "tmp-*.json")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(out); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), textIndexPath(name))
+}
+
+func (idx *textIndex) putLocked(path string, doc *indexedDoc) {
+	idx.dropLocked(path)
+	idx.docs[path] = doc
+	for term := range doc.Terms {
+		paths := idx.terms[term]
+		if paths == nil {
+			paths = make(map[string]struct{})
+			idx.terms[term] = paths
+		}
+		paths[path] = struct{}{}
+	}
+}
+
+func (idx *textIndex) dropLocked(path string) {
+	old := idx.docs[path]
+	if old == nil {
+		return
+	}
+	for term := range old.Terms {
+		delete(idx.terms[term], path)
+		if len(idx.terms[term]) == 0 {
+			delete(idx.terms, term)
+		}
+	}
+	delete(idx.docs, path)
+}
+
+// refresh brings the index in line with paths and saves it when anything changed
+func (idx *textIndex) refresh(name string, paths []string) (int, error) {
+	idx.refreshMu.Lock()
+	defer idx.refreshMu.Unlock()
+
+	changed := 0
+	wanted := make(map[string]struct{}, len(paths))
+	for _, path := range paths {
+		wanted[path] = struct{}{}
+		info, err := os.Stat(ConvertToWSLPath(path))
+		if err != nil || info.IsDir() {
+			continue
+		}
+		idx.mu.RLock()
+		doc := idx.docs[path]
+		idx.mu.RUnlock()
+		if doc != nil && doc.Size == info.Size() && doc.ModTime.Equal(info.ModTime()) {
+			continue
+		}
+
+		doc = &indexedDoc{ModTime: info.ModTime(), Size: info.Size()}
+		if text, ok := extractText(ConvertToWSLPath(path), maxIndexedTextSize); ok {
+			doc.Terms = termPositions(text)
+		}
+		idx.mu.Lock()
+		idx.putLocked(path, doc)
+		idx.mu.Unlock()
+		changed++
+	}
+
+	idx.mu.Lock()
+	for path := range idx.docs {
+		if _, ok := wanted[path]; !ok {
+			idx.dropLocked(path)
+			changed++
+		}
+	}
+	idx.mu.Unlock()
+
+	if changed == 0 {
+		return 0, nil
+	}
+	return changed, idx.save(name)
+}
+
+// refreshTextIndexInBackground indexes what changed in c since the last refresh. the
+// paths are collected right away, so either the caller holds mu or c is not yet in
+// Composites, as during startUp. the files are read in the background without mu.
+func refreshTextIndexInBackground(c *Folder) {
+	idx := textIndexFor(c)
+	name, paths := c.Name, filePaths(c)
+	go func() {
+		if _, err := idx.refresh(name, paths); err != nil {
+			log.Printf("saving text index of %s failed: %v", name, err)
+		}
+	}()
+}
+
+func filePaths(c *Folder) []string {
+	var paths []string
+	var walk func(f *Folder)
+	walk = func(f *Folder) {
+		for _, file := range f.Files {
+			paths = append(paths, file.Path)
+		}
+		for _, sub := range f.Subfolders {
+			walk(sub)
+		}
+	}
+	walk(c)
+	return paths
+}
+
+// -------------------- text extraction --------------------
+
+const (
+	wordprocessingNS = "http://schemas.openxmlformats.org/wordprocessingml/2006/main"
+	odfTextNS        = "urn:oasis:names:tc:opendocument:xmlns:text:1.0"
+)
+
+// extractText returns the searchable text of a file, text/* files as keyword
+// extraction reads them, the body of docx and odt documents one line per paragraph and
+// the text layer of pdfs
+func extractText(path string, maxSize int64) (string, bool) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".docx":
+		return extractDocumentText(path, "word/document.xml", maxSize)
+	case ".odt":
+		return extractDocumentText(path, "content.xml", maxSize)
+	case ".pdf":
+		return extractPdfText(path, maxSize)
+	}
+	data, ok := readPlainText(path, maxSize)
+	return string(data), ok
+}
+
+func extractDocumentText(path, part string, maxSize int64) (string, bool) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return "", false
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		if f.Name != part {
+			continue
+		}
+		if f.UncompressedSize64 > uint64(maxSize) {
+			return "", false
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return "", false
+		}
+		defer rc.Close()
+		return documentXMLText(io.LimitReader(rc, maxSize)), true
+	}
+	return "", false
+}
+
+// documentXMLText flattens word processing xml. docx keeps text in w:t, odt anywhere
+// inside text:p and text:h.
+func documentXMLText(r io.Reader) string {
+	var b strings.Builder
+	inWordText, odfDepth := false, 0
+	dec := xml.NewDecoder(r)
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch {
+			case t.Name.Space == wordprocessingNS && t.Name.Local == "t":
+				inWordText = true
+			case t.Name.Space == odfTextNS && (t.Name.Local == "p" || t.Name.Local == "h"):
+				odfDepth++
+			case t.Name.Space == wordprocessingNS && (t.Name.Local == "br" || t.Name.Local == "cr"),
+				t.Name.Space == odfTextNS && t.Name.Local == "line-break":
+				b.WriteByte('\n')
+			case t.Name.Space == wordprocessingNS && t.Name.Local == "tab",
+				t.Name.Space == odfTextNS && (t.Name.Local == "tab" || t.Name.Local == "s"):
+				b.WriteByte(' ')
+			}
+		case xml.EndElement:
+			switch {
+			case t.Name.Space == wordprocessingNS && t.Name.Local == "t":
+				inWordText = false
+			case t.Name.Space == wordprocessingNS && t.Name.Local == "p":
+				b.WriteByte('\n')
+			case t.Name.Space == odfTextNS && (t.Name.Local == "p" || t.Name.Local == "h"):
+				odfDepth--
+				if odfDepth == 0 {
+					b.WriteByte('\n')
+				}
+			}
+		case xml.CharData:
+			if inWordText || odfDepth > 0 {
+				b.Write(t)
+			}
+		}
+	}
+	return b.String()
+}
+
+// -------------------- tokens --------------------
+
+type textToken struct {
+	term       string
+	start, end int
+}
+
+// tokenizeText splits text into lower cased words of letters and digits with their byte offsets
+func tokenizeText(text string) []textToken {
+	var tokens []textToken
+	start := -1
+	for i, r := range text {
+		word := unicode.IsLetter(r) || unicode.IsNumber(r)
+		if word && start < 0 {
+			start = i
+		} else if !word && start >= 0 {
+			tokens = append(tokens, textToken{strings.ToLower(text[start:i]), start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, textToken{strings.ToLower(text[start:]), start, len(text)})
+	}
+	return tokens
+}
+
+// termPositions maps every word of text to the positions it occurs at
+func termPositions(text string) map[string][]int {
+	terms := make(map[string][]int)
+	for pos, tok := range tokenizeText(text) {
+		terms[tok.term] = append(terms[tok.term], pos)
+	}
+	return terms
+}
+
+// -------------------- queries --------------------
+
+// parseContentQuery splits q into words and "quoted phrases", every one has to occur
+func parseContentQuery(q string) ([][]string, error) {
+	var phrases [][]string
+	parts := strings.Split(q, `"`)
+	if len(parts)%2 == 0 {
+		return nil, fmt.Errorf("unterminated phrase in %q", q)
+	}
+	for i, part := range parts {
+		var words []string
+		for _, tok := range tokenizeText(part) {
+			words = append(words, tok.term)
+		}
+		if i%2 == 1 {
+			if len(words) > 0 {
+				phrases = append(phrases, words)
+			}
+			continue
+		}
+		for _, w := range words {
+			phrases = append(phrases, []string{w})
+		}
+	}
+	if len(phrases) == 0 {
+		return nil, fmt.Errorf("empty content query")
+	}
+	return phrases, nil
+}
+
+// phraseCount counts where the words of phrase follow each other in doc
+func phraseCount(doc *indexedDoc, phrase []string) int {
+	count := 0
+	for _, start := range doc.Terms[phrase[0]] {
+		found := true
+		for i, word := range phrase[1:] {
+			positions := doc.Terms[word]
+			j := sort.SearchInts(positions, start+i+1)
+			if j == len(positions) || positions[j] != start+i+1 {
+				found = false
+				break
+			}
+		}
+		if found {
+			count++
+		}
+	}
+	return count
+}
+
+type contentMatch struct {
+	path  string
+	score float64
+}
+
+// search ranks the documents containing every phrase, occurrences weighted by how rare
+// the phrase's rarest word is
+func (idx *textIndex) search(phrases [][]string) []contentMatch {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	// candidates come from the word with the fewest documents
+	var rarest map[string]struct{}
+	for _, phrase := range phrases {
+		for _, word := range phrase {
+			paths := idx.terms[word]
+			if len(paths) == 0 {
+				return nil
+			}
+			if rarest == nil || len(paths) < len(rarest) {
+				rarest = paths
+			}
+		}
+	}
+
+	total := float64(len(idx.docs))
+	var matches []contentMatch
+	for path := range rarest {
+		doc := idx.docs[path]
+		score := 0.0
+		for _, phrase := range phrases {
+			n := phraseCount(doc, phrase)
+			if n == 0 {
+				score = 0
+				break
+			}
+			df := len(idx.terms[phrase[0]])
+			for _, word := range phrase[1:] {
+				if len(idx.terms[word]) < df {
+					df = len(idx.terms[word])
+				}
+			}
+			score += float64(n) * math.Log(1+total/float64(df))
+		}
+		if score > 0 {
+			matches = append(matches, contentMatch{path, score})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return matches[i].path < matches[j].path
+	})
+	return matches
+}
+
+// -------------------- snippets --------------------
+
+// Highlight is a byte range of Snippet.Text that matched the query
+type Highlight struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+type Snippet struct {
+	Line       int         `json:"line"`
+	Text       string      `json:"text"`
+	Highlights []Highlight `json:"highlights"`
+}
+
+// snippets returns the first lines of text holding a query match, 1-based line numbers
+func snippets(text string, phrases [][]string) []Snippet {
+	var found []Snippet
+	for n, line := range strings.Split(text, "\n") {
+		tokens := tokenizeText(line)
+		var marks []Highlight
+		for i := range tokens {
+			for _, phrase := range phrases {
+				if i+len(phrase) > len(tokens) {
+					continue
+				}
+				match := true
+				for j, word := range phrase {
+					if tokens[i+j].term != word {
+						match = false
+						break
+					}
+				}
+				if match {
+					marks = append(marks, Highlight{tokens[i].start, tokens[i+len(phrase)-1].end})
+					break
+				}
+			}
+		}
+		if len(marks) == 0 {
+			continue
+		}
+		found = append(found, trimSnippet(n+1, line, marks))
+		if len(found) == maxSnippetsPerFile {
+			break
+		}
+	}
+	return found
+}
+
+// trimSnippet cuts long lines down to snippetWidth around the first highlight
+func trimSnippet(line int, text string, marks []Highlight) Snippet {
+	text = strings.TrimRight(text, "\r")
+	if len(text) <= snippetWidth {
+		return Snippet{Line: line, Text: text, Highlights: marks}
+	}
+	start := marks[0].Start - snippetWidth/4
+	if start < 0 {
+		start = 0
+	}
+	for start > 0 && !utf8.RuneStart(text[start]) {
+		start--
+	}
+	end := start + snippetWidth
+	if end > len(text) {
+		end = len(text)
+	}
+	for end < len(text) && !utf8.RuneStart(text[end]) {
+		end++
+	}
+	var kept []Highlight
+	for _, m := range marks {
+		if m.Start >= start && m.End <= end {
+			kept = append(kept, Highlight{m.Start - start, m.End - start})
+		}
+	}
+	return Snippet{Line: line, Text: text[start:end], Highlights: kept}
+}
+
+// -------------------- handler --------------------
+
+type ContentHit struct {
+	Name     string    `json:"name"`
+	Path     string    `json:"path"`
+	Score    float64   `json:"score"`
+	Snippets []Snippet `json:"snippets"`
+}
+
+type ContentSearchResponse struct {
+	Name   string       `json:"name"`
+	Hits   []ContentHit `json:"hits"`
+	Total  int          `json:"total"`
+	Offset int          `json:"offset"`
+	Limit  int          `json:"limit"`
+}
+
+// contentSearchHandler searches file contents, q takes words and "quoted phrases"
+func contentSearchHandler(w http.ResponseWriter, r *http.Request) {
+	phrases, err := parseContentQuery(r.URL.Query().Get("q"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	offset, pageLimit, err := searchPageParams(r, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	mu.Lock()
+	c := findComposite(r.URL.Query().Get("name"))
+	if c == nil {
+		mu.Unlock()
+		http.Error(w, "No smart manager with that name", http.StatusBadRequest)
+		return
+	}
+	idx := textIndexFor(c)
+	// the index may still list files that left the tree since its last refresh
+	inTree := make(map[string]struct{})
+	for _, path := range filePaths(c) {
+		inTree[path] = struct{}{}
+	}
+	name := c.Name
+	mu.Unlock()
+
+	var matches []contentMatch
+	for _, m := range idx.search(phrases) {
+		if _, ok := inTree[m.path]; ok {
+			matches = append(matches, m)
+		}
+	}
+
+	res := ContentSearchResponse{Name: name, Hits: []ContentHit{}, Total: len(matches), Offset: offset, Limit: pageLimit}
+	if offset < len(matches) {
+		end := offset + pageLimit
+		if end > len(matches) {
+			end = len(matches)
+		}
+		for _, m := range matches[offset:end] {
+			hit := ContentHit{Name: filepath.Base(m.path), Path: m.path, Score: m.score, Snippets: []Snippet{}}
+			if text, ok := extractText(ConvertToWSLPath(m.path), maxIndexedTextSize); ok {
+				if found := snippets(text, phrases); found != nil {
+					hit.Snippets = found
+				}
+			}
+			res.Hits = append(res.Hits, hit)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
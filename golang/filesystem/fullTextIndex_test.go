@@ -0,0 +1,242 @@
+package filesystem
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeZipPart(t *testing.T, path, part, content string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	w, _ := zw.Create(part)
+	w.Write([]byte(content))
+	zw.Close()
+	f.Close()
+}
+
+const docxBody = `<?xml version="1.0" encoding="UTF-8"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>
+<w:p><w:r><w:t>Quarterly board minutes</w:t></w:r></w:p>
+<w:p><w:r><w:instrText>PAGE</w:instrText><w:t xml:space="preserve">The annual </w:t></w:r><w:r><w:t>budget was approved.</w:t></w:r></w:p>
+</w:body></w:document>`
+
+const odtBody = `<?xml version="1.0" encoding="UTF-8"?>
+<office:document-content xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0" xmlns:text="urn:oasis:names:tc:opendocument:xmlns:text:1.0"><office:body><office:text>
+<text:h>Holiday plan</text:h>
+<text:p>Pack the<text:s/>annual<text:line-break/>budget spreadsheet</text:p>
+</office:text></office:body></office:document-content>`
+
+func contentManager(t *testing.T) (*Folder, string) {
+	t.Helper()
+	tmp := chdirTemp(t)
+	root := filepath.Join(tmp, "content")
+	os.MkdirAll(root, 0755)
+	os.WriteFile(filepath.Join(root, "notes.txt"), []byte("shopping list\nthe annual budget review is due\nannual leave\n"), 0644)
+	os.WriteFile(filepath.Join(root, "image.png"), []byte("\x89PNG\r\n\x1a\nannual budget"), 0644)
+	writeZipPart(t, filepath.Join(root, "minutes.docx"), "word/document.xml", docxBody)
+	writeZipPart(t, filepath.Join(root, "plan.odt"), "content.xml", odtBody)
+	c, err := ConvertToObject("content", root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, root
+}
+
+func TestDocumentXMLText(t *testing.T) {
+	text, ok := extractText(writeTempDoc(t, "a.docx", "word/document.xml", docxBody), maxIndexedTextSize)
+	if !ok || text != "Quarterly board minutes\nThe annual budget was approved.\n" {
+		t.Fatalf("unexpected docx text %q", text)
+	}
+	text, ok = extractText(writeTempDoc(t, "a.odt", "content.xml", odtBody), maxIndexedTextSize)
+	if !ok || text != "Holiday plan\nPack the annual\nbudget spreadsheet\n" {
+		t.Fatalf("unexpected odt text %q", text)
+	}
+}
+
+func writeTempDoc(t *testing.T, name, part, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	writeZipPart(t, path, part, content)
+	return path
+}
+
+func TestParseContentQuery(t *testing.T) {
+	phrases, err := parseContentQuery(`Budget "annual  leave" due`)
+	if err != nil || len(phrases) != 3 || len(phrases[1]) != 2 || phrases[0][0] != "budget" {
+		t.Fatalf("unexpected phrases %v %v", phrases, err)
+	}
+	for _, q := range []string{``, `"open`, `""`, `!!`} {
+		if _, err := parseContentQuery(q); err == nil {
+			t.Errorf("expected %q to be rejected", q)
+		}
+	}
+}
+
+func TestTextIndex_PhrasesAndRanking(t *testing.T) {
+	c, root := contentManager(t)
+	idx := textIndexFor(c)
+	if _, err := idx.refresh(c.Name, filePaths(c)); err != nil {
+		t.Fatal(err)
+	}
+
+	paths := func(q string) []string {
+		phrases, _ := parseContentQuery(q)
+		var got []string
+		for _, m := range idx.search(phrases) {
+			got = append(got, filepath.Base(m.path))
+		}
+		return got
+	}
+	// the docx phrase spans two runs, the odt one a line break, binary files are skipped
+	if got := paths(`"annual budget"`); len(got) != 3 {
+		t.Fatalf("expected the phrase in notes, minutes and plan, got %v", got)
+	}
+	if got := paths(`"budget annual"`); len(got) != 0 {
+		t.Fatalf("word order matters in a phrase, got %v", got)
+	}
+	// notes.txt has annual twice
+	if got := paths(`annual`); len(got) != 3 || got[0] != "notes.txt" {
+		t.Fatalf("more occurrences should rank first, got %v", got)
+	}
+	if got := paths(`annual spreadsheet`); len(got) != 1 || got[0] != "plan.odt" {
+		t.Fatalf("every word has to occur, got %v", got)
+	}
+	if _, ok := idx.docs[filepath.Join(root, "image.png")]; !ok {
+		t.Fatalf("binary files are remembered so they are not sniffed again")
+	}
+}
+
+func TestTextIndex_IncrementalAndPersisted(t *testing.T) {
+	c, root := contentManager(t)
+	idx := textIndexFor(c)
+	if n, _ := idx.refresh(c.Name, filePaths(c)); n != 4 {
+		t.Fatalf("first refresh should index every file, got %d", n)
+	}
+	if n, _ := idx.refresh(c.Name, filePaths(c)); n != 0 {
+		t.Fatalf("nothing changed, got %d", n)
+	}
+
+	notes := filepath.Join(root, "notes.txt")
+	minutes := idx.docs[filepath.Join(root, "minutes.docx")]
+	os.WriteFile(notes, []byte("renewal contract\n"), 0644)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(notes, later, later)
+	c.RemoveFile(filepath.Join(root, "plan.odt"))
+	if n, _ := idx.refresh(c.Name, filePaths(c)); n != 2 {
+		t.Fatalf("expected the changed and the removed file, got %d", n)
+	}
+	if idx.docs[filepath.Join(root, "minutes.docx")] != minutes {
+		t.Fatalf("unchanged files must not be read again")
+	}
+
+	stored := loadTextIndex(c.Name)
+	phrases, _ := parseContentQuery(`"renewal contract"`)
+	if got := stored.search(phrases); len(got) != 1 || got[0].path != notes {
+		t.Fatalf("reloaded index should find the new text, got %v", got)
+	}
+	phrases, _ = parseContentQuery(`spreadsheet`)
+	if got := stored.search(phrases); len(got) != 0 {
+		t.Fatalf("removed files should be gone, got %v", got)
+	}
+
+	// removing the manager drops its index, also when the managers directory is missing
+	origRecords := managersFilePath
+	t.Cleanup(func() { SetManagersFilePath(origRecords) })
+	SetManagersFilePath(filepath.Join(t.TempDir(), "missing", "managers.json"))
+	if err := cleanupOrphanCompositeJSONs(nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(textIndexPath(c.Name)); !os.IsNotExist(err) {
+		t.Fatalf("index of a removed manager should be deleted")
+	}
+}
+
+func TestStartUp_RefreshesTextIndex(t *testing.T) {
+	c, root := contentManager(t)
+	origRecords, origComposites := managersFilePath, Composites
+	t.Cleanup(func() {
+		SetManagersFilePath(origRecords)
+		Composites = origComposites
+	})
+	SetManagersFilePath(filepath.Join("storage", "startUpStorageFile.json"))
+	if err := saveManagerRecords([]ManagerRecord{{Name: c.Name, Path: root}}); err != nil {
+		t.Fatal(err)
+	}
+	Composites = nil
+
+	rr := httptest.NewRecorder()
+	startUpHandler(rr, httptest.NewRequest(http.MethodGet, "/startUp", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("startUp failed: %d %s", rr.Code, rr.Body.String())
+	}
+	// the refresh runs in the background and saves the index when it is done
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if _, err := os.Stat(textIndexPath(c.Name)); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("startUp did not index the files")
+		}
+	}
+	phrases, _ := parseContentQuery(`"annual budget"`)
+	if got := loadTextIndex(c.Name).search(phrases); len(got) != 3 {
+		t.Fatalf("expected notes.txt, minutes.docx and plan.odt, got %v", got)
+	}
+}
+
+func TestContentSearchHandler_Snippets(t *testing.T) {
+	c, root := contentManager(t)
+	textIndexFor(c).refresh(c.Name, filePaths(c))
+	orig := Composites
+	defer func() { Composites = orig }()
+	Composites = []*Folder{c}
+
+	rr := httptest.NewRecorder()
+	contentSearchHandler(rr, httptest.NewRequest("GET", "/contentSearch?name=content&q="+url.QueryEscape(`"annual budget" review`), nil))
+	var res ContentSearchResponse
+	if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != 1 || res.Hits[0].Path != filepath.Join(root, "notes.txt") {
+		t.Fatalf("unexpected hits %+v", res.Hits)
+	}
+	snip := res.Hits[0].Snippets
+	if len(snip) != 1 || snip[0].Line != 2 || len(snip[0].Highlights) != 2 {
+		t.Fatalf("unexpected snippets %+v", snip)
+	}
+	if h := snip[0].Highlights[0]; snip[0].Text[h.Start:h.End] != "annual budget" {
+		t.Fatalf("highlight should cover the phrase, got %q", snip[0].Text[h.Start:h.End])
+	}
+
+	rr = httptest.NewRecorder()
+	contentSearchHandler(rr, httptest.NewRequest("GET", "/contentSearch?name=content&q="+url.QueryEscape(`"open`), nil))
+	if rr.Code != 400 {
+		t.Fatalf("expected 400 for an unterminated phrase, got %d", rr.Code)
+	}
+}
+
+func TestTrimSnippet_KeepsHighlightInWindow(t *testing.T) {
+	line := ""
+	for len(line) < 400 {
+		line += "lorem ipsum "
+	}
+	line += "needle " + line
+	start := len(line)/2 - 6
+	for line[start:start+6] != "needle" {
+		start++
+	}
+	s := trimSnippet(1, line, []Highlight{{start, start + 6}})
+	if len(s.Text) > snippetWidth || len(s.Highlights) != 1 || s.Text[s.Highlights[0].Start:s.Highlights[0].End] != "needle" {
+		t.Fatalf("unexpected trimmed snippet %+v", s)
+	}
+}
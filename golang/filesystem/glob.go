@@ -0,0 +1,69 @@
+package filesystem
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// matchGlob matches a slash separated path against pattern. segments use path.Match
+// syntax, "**" matches any number of segments (including none). a leading "/" is ignored.
+func matchGlob(pattern, name string) bool {
+	pattern = strings.Trim(filepath.ToSlash(pattern), "/")
+	name = strings.Trim(filepath.ToSlash(name), "/")
+	return matchGlobSegments(splitGlob(pattern), splitGlob(name))
+}
+
+func splitGlob(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "/")
+}
+
+func matchGlobSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// collapse repeated ** and try every possible split
+			for len(pattern) > 0 && pattern[0] == "**" {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchGlobSegments(pattern, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], name[0]); err != nil || !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// validGlob reports whether every segment of pattern is well formed
+func validGlob(pattern string) bool {
+	for _, seg := range splitGlob(strings.Trim(filepath.ToSlash(pattern), "/")) {
+		if _, err := path.Match(seg, ""); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// relativeToComposite returns p relative to the manager root with forward slashes
+func relativeToComposite(c *Folder, p string) string {
+	rel, err := filepath.Rel(c.Path, p)
+	if err != nil {
+		return filepath.ToSlash(p)
+	}
+	return filepath.ToSlash(rel)
+}
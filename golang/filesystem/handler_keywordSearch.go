@@ -7,17 +7,16 @@ import (
 	"math"
 	"net/http"
 	"os"
-	"path/filepath"
 	"regexp"
 	"sort"
 	"strings"
 	"sync"
+	"unicode/utf8"
 
 	pb "github.com/COS301-SE-2025/Smart-File-Manager/golang/client/protos"
 )
 
 const limitKeywordSearch int = 15
-const maxDistKeywordSearch int = 5
 
 //flow idea:
 // app starts
@@ -50,177 +49,54 @@ func KeywordSearchHadler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
 	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
 
-	name := r.URL.Query().Get("compositeName")
 	searchText := r.URL.Query().Get("searchText")
+	// optional, matches the tag and all of its descendants
+	tag := r.URL.Query().Get("tag")
 
-	for _, c := range Composites {
-		if c.Name == name {
-
-			var terms []string = strings.Split(searchText, " ")
-
-			sr := getMatchesByKeywords(terms, c)
-
-			cores := DirectoryTreeJson{
-				Name:     sr.Name,
-				IsFolder: true,
-				Children: make([]FileNode, len(sr.rankedFiles)),
-			}
-
-			for i, rf := range sr.rankedFiles {
-				file := rf.file
-				fileNodeToAdd := FileNode{
-					Name:     file.Name,
-					Path:     file.Path,
-					IsFolder: false,
-					Tags:     file.Tags,
-					Metadata: ConvertMetadataEntries(file.Metadata),
-				}
-				cores.Children[i] = fileNodeToAdd
-			}
-
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(cores)
-			return
-		}
-	}
-
-	http.Error(w, "No smart manager with that name", http.StatusBadRequest)
-}
-
-func getMatchesByKeywords(searchTerms []string, composite *Folder) *safeResults {
-
-	res := &safeResults{
-		Name: composite.Name,
+	offset, pageLimit, err := searchPageParams(r, limitKeywordSearch)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	resultChan := make(chan rankedFile)
-
-	var wg sync.WaitGroup
-
-	wg.Add(1)
-	go exploreFolderForKeywords(composite, searchTerms, resultChan, &wg)
-
-	go func() {
-		wg.Wait()
-		close(resultChan)
-	}()
-
-	seen := make(map[string]struct{})
-	for currentRankedFile := range resultChan {
-
-		key := currentRankedFile.file.Path
-		if _, ok := seen[key]; ok {
-			continue // already inserted this file
-		}
-		seen[key] = struct{}{}
-
-		inserted := false
-		for i, iteratedRankedFile := range res.rankedFiles {
-			//if current is better
-			if iteratedRankedFile.distance > currentRankedFile.distance {
-
-				if len(res.rankedFiles) < limit {
-					//insert by shifting over to make the array sorted
-					res.rankedFiles = append(
-						append(res.rankedFiles[:i], currentRankedFile),
-						res.rankedFiles[i:]...,
-					)
-
-					inserted = true
-					break
-				} else {
-					res.rankedFiles = append(
-						append(
-							res.rankedFiles[:i],
-							currentRankedFile,
-						),
-						res.rankedFiles[i:limit-1]...,
-					)
-					inserted = true
-					break
-				}
-			}
-		}
-		// if limit is not reached and not inserted then we insert at the end
-		if len(res.rankedFiles) < limit {
-			if !inserted {
-				res.rankedFiles = append(res.rankedFiles, currentRankedFile)
-			}
-		}
+	terms := strings.Split(searchText, " ")
+	// over every manager the scores are taken against all of them so they can be merged
+	var corpus *keywordCorpus
+	if wantsAllManagers(r) {
+		mu.Lock()
+		composites := append([]*Folder(nil), Composites...)
+		mu.Unlock()
+		corpus = keywordCorpusFor(composites)
 	}
-
-	//checks to remove dups (yes if concurrency was perfect there wouldnt be dups)
-	unique := make([]rankedFile, 0, len(res.rankedFiles))
-
-	finalSeen := make(map[string]struct{}, len(res.rankedFiles))
-
-	for _, rf := range res.rankedFiles {
-		key := filepath.Clean(rf.file.Path)
-
-		if _, ok := finalSeen[key]; ok {
-			continue
-		}
-
-		finalSeen[key] = struct{}{}
-		unique = append(unique, rf)
-	}
-	res.rankedFiles = unique
-
-	sort.SliceStable(res.rankedFiles, func(i, j int) bool {
-		if res.rankedFiles[i].distance != res.rankedFiles[j].distance {
-			return res.rankedFiles[i].distance < res.rankedFiles[j].distance
-		}
-		ni := strings.ToLower(res.rankedFiles[i].file.Name)
-		nj := strings.ToLower(res.rankedFiles[j].file.Name)
-		if ni != nj {
-			return ni < nj
-		}
-
-		return filepath.Clean(res.rankedFiles[i].file.Path) < filepath.Clean(res.rankedFiles[j].file.Path)
+	respondSearch(w, r, offset, pageLimit, func(run *searchRun, c *Folder) *safeResults {
+		return getMatchesByKeywords(run, terms, c, tagFilter(c, tag), corpus)
 	})
-
-	return res
-
 }
 
-func exploreFolderForKeywords(f *Folder, searchTerms []string, c chan<- rankedFile, wg *sync.WaitGroup) {
-	defer wg.Done()
-
-	for _, folder := range f.Subfolders {
-		wg.Add(1)
-		go exploreFolderForKeywords(folder, searchTerms, c, wg)
+// getMatchesByKeywords ranks files by their keywords through the manager's keyword
+// index, filter (optional) decides which files are considered at all. corpus is the
+// collection to score against, nil for the manager alone.
+func getMatchesByKeywords(run *searchRun, searchTerms []string, composite *Folder, filter func(*File) bool, corpus *keywordCorpus) *safeResults {
+	idx := keywordIndexFor(composite)
+	if corpus == nil {
+		corpus = newKeywordCorpus(idx)
 	}
-
-	for _, file := range f.Files {
-		finalDist := 100
-		for _, searchTerm := range searchTerms {
-			for _, keyword := range file.Keywords {
-
-				dist := LevenshteinDistForKeywords(searchTerm, keyword.Keyword)
-				if dist <= maxDistKeywordSearch {
-					if dist < finalDist {
-						finalDist = dist
-					}
-
-				}
-			}
-		}
-		if finalDist <= maxDistKeywordSearch {
-			c <- rankedFile{file: *file, distance: finalDist}
-		}
+	return &safeResults{
+		Name:        composite.Name,
+		rankedFiles: idx.searchIn(corpus, run, searchTerms, filter),
 	}
 }
 
 func LevenshteinDistForKeywords(searchText string, fileKeyword string) int {
 	if len(searchText) == 0 {
-		return len(fileKeyword)
+		return utf8.RuneCountInString(fileKeyword)
 	}
 	if len(fileKeyword) == 0 {
-		return len(searchText)
+		return utf8.RuneCountInString(searchText)
 	}
 
-	searchText = strings.ToLower(searchText)
-	fileKeyword = strings.ToLower(fileKeyword)
+	searchText = foldText(searchText)
+	fileKeyword = foldText(fileKeyword)
 
 	//  exact matches should be 0
 	if fileKeyword == searchText {
@@ -234,39 +110,10 @@ func LevenshteinDistForKeywords(searchText string, fileKeyword string) int {
 		boost = 0.1
 	}
 
-	// now fall back on full Levenshtein
-	lenSearchText, lenFileName := len(searchText), len(fileKeyword)
+	// now fall back on full Levenshtein, counted in runes
+	dist := runeLevenshtein([]rune(searchText), []rune(fileKeyword))
 
-	prev := make([]int, lenFileName+1)
-	curr := make([]int, lenFileName+1)
-	for j := 0; j <= lenFileName; j++ {
-		prev[j] = j
-	}
-	for i := 1; i <= lenSearchText; i++ {
-		curr[0] = i
-		ai := searchText[i-1]
-		for j := 1; j <= lenFileName; j++ {
-			cost := 0
-			if ai != fileKeyword[j-1] {
-				cost = 1
-			}
-			sub := prev[j-1] + cost
-			ins := curr[j-1] + 1
-			del := prev[j] + 1
-
-			// take the minimum
-			if ins < sub {
-				sub = ins
-			}
-			if del < sub {
-				sub = del
-			}
-			curr[j] = sub
-		}
-		prev, curr = curr, prev
-	}
-
-	return int(math.Round(float64(prev[lenFileName]) * float64(boost)))
+	return int(math.Round(float64(dist) * float64(boost)))
 
 }
 
@@ -276,7 +123,7 @@ func pythonExtractKeywords(c *Folder) {
 		log.Fatalf("grpcFunc failed: %v", err)
 	}
 
-	saveCompositeDetails(c)
+	queueCompositeSave(c)
 	c.HasKeywords = true
 
 }
@@ -289,7 +136,8 @@ func GoExtractKeywords(c *Folder) {
 	getKeywords(c, &wg)
 
 	wg.Wait()
-	saveCompositeDetails(c)
+	dropKeywordIndex(c)
+	queueCompositeSave(c)
 	c.HasKeywords = true
 }
 
@@ -331,7 +179,8 @@ var stopwords = map[string]struct{}{
 
 // ExtractKeywordsFromText runs RAKE on the given text and returns topN words.
 func ExtractKeywordsFromText(text string, topN int) []*pb.Keyword {
-	re := regexp.MustCompile(`[A-Za-z0-9]+`)
+	// letters and digits of any script, so accented and non-latin words stay whole
+	re := regexp.MustCompile(`[\p{L}\p{N}]+`)
 	words := re.FindAllString(strings.ToLower(text), -1)
 
 	var phrases [][]string
@@ -381,14 +230,23 @@ func ExtractKeywordsFromText(text string, topN int) []*pb.Keyword {
 // ExtractKeywordsRAKE reads filePath (limit maxSize), but only if it's a text/* file.
 // Otherwise it returns an empty slice.
 func ExtractKeywordsRAKE(filePath string, topN int, maxSize int64) ([]*pb.Keyword, error) {
+	data, ok := readPlainText(filePath, maxSize)
+	if !ok {
+		return nil, nil
+	}
+	return ExtractKeywordsFromText(string(data), topN), nil
+}
+
+// readPlainText reads filePath (limit maxSize) when its content sniffs as text/*
+func readPlainText(filePath string, maxSize int64) ([]byte, bool) {
 	fi, err := os.Stat(filePath)
 	if err != nil || fi.IsDir() || fi.Size() > maxSize {
-		return nil, nil
+		return nil, false
 	}
 
 	f, err := os.Open(filePath)
 	if err != nil {
-		return nil, nil
+		return nil, false
 	}
 	defer f.Close()
 
@@ -399,15 +257,14 @@ func ExtractKeywordsRAKE(filePath string, topN int, maxSize int64) ([]*pb.Keywor
 	ctype := http.DetectContentType(head[:n])
 	if !strings.HasPrefix(ctype, "text/") {
 		// not a plain-text file → no keywords
-		return nil, nil
+		return nil, false
 	}
 
 	data, err := io.ReadAll(io.LimitReader(f, maxSize))
 	if err != nil {
-		return nil, nil
+		return nil, false
 	}
-
-	return ExtractKeywordsFromText(string(data), topN), nil
+	return data, true
 }
 
 func AppendUniqueKeywords(dst, src []*pb.Keyword) []*pb.Keyword {
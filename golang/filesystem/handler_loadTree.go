@@ -26,19 +26,48 @@ type DirectoryTreeJson struct {
 	IsFolder bool       `json:"isFolder"`
 	RootPath string     `json:"rootPath"`
 	Children []FileNode `json:"children"`
+	// manager level settings, only written to storage
+	TagRegistry  []*TagDefinition `json:"tagRegistry,omitempty"`
+	TagRules     []*TagRule       `json:"tagRules,omitempty"`
+	XattrSync    *TagSyncSettings `json:"xattrSync,omitempty"`
+	XmpSync      *TagSyncSettings `json:"xmpSync,omitempty"`
+	LockPolicies []*LockPolicy    `json:"lockPolicies,omitempty"`
+	SmartFolders []*SmartFolder   `json:"smartFolders,omitempty"`
+	WriteProtect bool             `json:"writeProtect,omitempty"`
+	// tree responses only, the smart folders as virtual folders next to the real tree
+	SmartFolderNodes []FileNode `json:"smartFolderNodes,omitempty"`
 }
 
 // file or folder
 type FileNode struct {
-	Name     string        `json:"name"`
-	Path     string        `json:"path,omitempty"`
-	IsFolder bool          `json:"isFolder"`
-	Tags     []string      `json:"tags,omitempty"`
-	Metadata *Metadata     `json:"metadata,omitempty"`
-	Children []FileNode    `json:"children,omitempty"`
-	Keywords []*pb.Keyword `json:"keywords,omitempty"`
-	Locked   bool          `json:"locked"`
-	NewPath  string        `json:"newPath,omitempty"` // for moving files
+	Name     string   `json:"name"`
+	Path     string   `json:"path,omitempty"`
+	IsFolder bool     `json:"isFolder"`
+	Tags     []string `json:"tags,omitempty"`
+	// folders only, tags that apply to every file beneath
+	InheritTags []string      `json:"inheritTags,omitempty"`
+	Metadata    *Metadata     `json:"metadata,omitempty"`
+	Children    []FileNode    `json:"children,omitempty"`
+	Keywords    []*pb.Keyword `json:"keywords,omitempty"`
+	Locked      bool          `json:"locked"`
+	Lock        *LockInfo     `json:"lock,omitempty"`
+	// storage only, the mode to restore once a write protected item is unlocked
+	OriginalMode *os.FileMode `json:"originalMode,omitempty"`
+	NewPath      string       `json:"newPath,omitempty"` // for moving files
+	// used to re-attach metadata after a rename outside the app
+	Identity    string `json:"identity,omitempty"`
+	ContentHash string `json:"contentHash,omitempty"`
+	Sidecar     string `json:"sidecar,omitempty"`
+	// storage only, size and modification time (unix nanoseconds) that confirm an
+	// identity match, inodes are handed out again once a file is deleted
+	Size    int64 `json:"size,omitempty"`
+	ModTime int64 `json:"modTime,omitempty"`
+	// storage only, the tags rules have added to the file
+	RuleTags []string `json:"ruleTags,omitempty"`
+	// search results only, the manager a hit came from when searching all of them
+	Manager string `json:"manager,omitempty"`
+	// virtual folders only, the id of the smart folder behind the node
+	SmartFolder string `json:"smartFolder,omitempty"`
 }
 
 type Metadata struct {
@@ -148,6 +177,7 @@ func grpcFunc(c *Folder, requestType string, preferredCase string) error {
 	default: // "METADATA", "CLUSTERING"
 		mergeProtoToFolder(resp.Root, c)
 	}
+	dropKeywordIndex(c)
 
 	return nil
 }
@@ -176,10 +206,15 @@ func mergeProtoToFolder(dir *pb.Directory, existing *Folder) {
 			Name:   sub.Name,
 			Path:   sub.Path,
 			Locked: sub.IsLocked,
+			parent: existing,
 		}
 		mergeProtoToFolderHelper(sub, child)
 		existing.Subfolders = append(existing.Subfolders, child)
 	}
+	// the files were all replaced, index the new ones
+	if existing.nameIndex != nil {
+		existing.nameIndex = buildNameIndex(existing)
+	}
 }
 
 func mergeProtoToFolderHelper(dir *pb.Directory, existing *Folder) {
@@ -211,6 +246,7 @@ func mergeProtoToFolderHelper(dir *pb.Directory, existing *Folder) {
 			Name:   sub.Name,
 			Path:   sub.Path,
 			Locked: sub.IsLocked,
+			parent: existing,
 		}
 		mergeProtoToFolderHelper(sub, child)
 		existing.Subfolders = append(existing.Subfolders, child)
@@ -489,8 +525,20 @@ func loadTreeDataHandlerGoOnly(w http.ResponseWriter, r *http.Request) {
 	for _, c := range Composites {
 		if c.Name == name {
 
+			// storage must be current before it is read back into the composite
+			if err := flushPendingSavesLocked(); err != nil {
+				fmt.Printf("flush before load failed: %v\n", err)
+			}
 			populateKeywordsFromStoredJsonFile(c)
 
+			// rules run on every rescan so new files and stored keywords are covered
+			imported := importExternalTags(c)
+			released := releaseExpiredLocks(c, time.Now())
+			policed := applyLockPolicies(c, time.Now())
+			if len(applyTagRules(c, false)) > 0 || imported || released > 0 || policed > 0 {
+				queueCompositeSave(c)
+			}
+
 			children := GoSidecreateDirectoryJSONStructure(c)
 
 			root := DirectoryTreeJson{
@@ -498,6 +546,8 @@ func loadTreeDataHandlerGoOnly(w http.ResponseWriter, r *http.Request) {
 				IsFolder: true,
 				RootPath: c.Path,
 				Children: children,
+				// saved searches are virtual folders, kept apart from the real tree
+				SmartFolderNodes: smartFolderNodes(c),
 			}
 			// PrettyPrintFolder(c, "")
 
@@ -512,6 +562,9 @@ func loadTreeDataHandlerGoOnly(w http.ResponseWriter, r *http.Request) {
 
 			go pythonExtractKeywords(c)
 
+			// reads only the files that changed since the last refresh
+			refreshTextIndexInBackground(c)
+
 			return
 		}
 	}
@@ -569,6 +622,8 @@ func GoSidecreateDirectoryJSONStructure(folder *Folder) []FileNode {
 			Tags:     tags,
 			Metadata: md,
 			Locked:   file.Locked,
+			Lock:     file.LockInfo,
+			Sidecar:  file.Sidecar,
 		})
 	}
 
@@ -577,13 +632,15 @@ func GoSidecreateDirectoryJSONStructure(folder *Folder) []FileNode {
 		childNodes := GoSidecreateDirectoryJSONStructure(sub)
 
 		nodes = append(nodes, FileNode{
-			Name:     sub.Name,
-			Path:     sub.Path,
-			IsFolder: true,
-			Tags:     sub.Tags,
-			Metadata: &Metadata{},
-			Children: childNodes,
-			Locked:   sub.Locked,
+			Name:        sub.Name,
+			Path:        sub.Path,
+			IsFolder:    true,
+			Tags:        sub.Tags,
+			InheritTags: sub.InheritTags,
+			Metadata:    &Metadata{},
+			Children:    childNodes,
+			Locked:      sub.Locked,
+			Lock:        sub.LockInfo,
 		})
 	}
 
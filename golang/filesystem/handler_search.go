@@ -1,32 +1,39 @@
 package filesystem
 
 import (
-	"encoding/json"
 	"fmt"
 	"math"
 	"net/http"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"unicode/utf8"
 )
 
 const limit int = 25
 const maxDist int = 8
 const similarityThreshold = 0.5
 
+// largest page a search endpoint hands out
+const maxSearchLimit int = 500
+
+// response name of a search across every manager (all=true)
+const allManagersName = "all"
+
 func LevenshteinDist(searchText string, fileName string) int {
 	if len(searchText) == 0 {
-		return len(fileName)
+		return utf8.RuneCountInString(fileName)
 	}
 	if len(fileName) == 0 {
-		return len(searchText)
+		return utf8.RuneCountInString(searchText)
 	}
 
 	if fileName[0] != '.' {
 
-		searchText = strings.ToLower(searchText)
-		fileName = strings.ToLower(fileName)
+		searchText = foldText(searchText)
+		fileName = foldText(fileName)
 
 		//if the search doesnt contain a . then we remove the file
 		// extention from the fie names for better search results
@@ -53,39 +60,10 @@ func LevenshteinDist(searchText string, fileName string) int {
 		boost = 0.1
 	}
 
-	// now fall back on full Levenshtein
-	lenSearchText, lenFileName := len(searchText), len(fileName)
-
-	prev := make([]int, lenFileName+1)
-	curr := make([]int, lenFileName+1)
-	for j := 0; j <= lenFileName; j++ {
-		prev[j] = j
-	}
-	for i := 1; i <= lenSearchText; i++ {
-		curr[0] = i
-		ai := searchText[i-1]
-		for j := 1; j <= lenFileName; j++ {
-			cost := 0
-			if ai != fileName[j-1] {
-				cost = 1
-			}
-			sub := prev[j-1] + cost
-			ins := curr[j-1] + 1
-			del := prev[j] + 1
-
-			// take the minimum
-			if ins < sub {
-				sub = ins
-			}
-			if del < sub {
-				sub = del
-			}
-			curr[j] = sub
-		}
-		prev, curr = curr, prev
-	}
+	// now fall back on full Levenshtein, counted in runes
+	dist := runeLevenshtein([]rune(searchText), []rune(fileName))
 
-	return int(math.Round(float64(prev[lenFileName]) * float64(boost)))
+	return int(math.Round(float64(dist) * float64(boost)))
 
 }
 
@@ -95,8 +73,13 @@ type safeResults struct {
 }
 
 type rankedFile struct {
-	file     File
+	// the hit, only dereferenced when the response is built
+	file     *File
 	distance int
+	// keyword relevance, higher first between equal distances
+	score float64
+	// set when the ranking spans several managers
+	manager string
 }
 
 // gpt given
@@ -120,39 +103,157 @@ func PrettyPrintFolder(f *Folder, indent string) {
 
 func SearchHandler(w http.ResponseWriter, r *http.Request) {
 
-	compositeName := r.URL.Query().Get("compositeName")
 	searchText := r.URL.Query().Get("searchText")
+	// optional, matches the tag and all of its descendants
+	tag := r.URL.Query().Get("tag")
+
+	offset, pageLimit, err := searchPageParams(r, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	for _, comp := range Composites {
-		if comp.Name == compositeName {
+	// mode=regex|glob matches exactly, the default is the fuzzy name search
+	search := func(run *searchRun, c *Folder) *safeResults {
+		return getMatches(run, searchText, c, tagFilter(c, tag))
+	}
+	if mode := r.URL.Query().Get("mode"); mode != "" && mode != "fuzzy" {
+		match, err := patternMatcher(mode, searchText)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		search = func(run *searchRun, c *Folder) *safeResults {
+			return getPatternMatches(run, match, c, tagFilter(c, tag))
+		}
+	}
 
-			sr := getMatches(searchText, comp)
+	respondSearch(w, r, offset, pageLimit, search)
+}
 
-			cores := DirectoryTreeJson{
-				Name:     sr.Name,
-				IsFolder: true,
-				Children: make([]FileNode, len(sr.rankedFiles)),
-			}
+// SearchResponse is one page of search results. Total counts every match, not just the page.
+type SearchResponse struct {
+	Name     string     `json:"name"`
+	IsFolder bool       `json:"isFolder"`
+	Children []FileNode `json:"children"`
+	Total    int        `json:"total"`
+	Offset   int        `json:"offset"`
+	Limit    int        `json:"limit"`
+}
 
-			for i, rf := range sr.rankedFiles {
-				file := rf.file
-				fileNodeToAdd := FileNode{
-					Name:     file.Name,
-					Path:     file.Path,
-					IsFolder: false,
-					Tags:     file.Tags,
-					Metadata: ConvertMetadataEntries(file.Metadata),
-				}
-				cores.Children[i] = fileNodeToAdd
+// searchPageParams reads offset and limit, limit defaults to defaultLimit
+func searchPageParams(r *http.Request, defaultLimit int) (int, int, error) {
+	offset, pageLimit := 0, defaultLimit
+	if raw := r.URL.Query().Get("offset"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			return 0, 0, fmt.Errorf("invalid offset %q", raw)
+		}
+		offset = n
+	}
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxSearchLimit {
+			return 0, 0, fmt.Errorf("invalid limit %q, expected 1-%d", raw, maxSearchLimit)
+		}
+		pageLimit = n
+	}
+	return offset, pageLimit, nil
+}
+
+// searchPage cuts the page out of the ranked matches
+func searchPage(name string, ranked []rankedFile, offset, pageLimit int) SearchResponse {
+	res := SearchResponse{
+		Name:     name,
+		IsFolder: true,
+		Children: []FileNode{},
+		Total:    len(ranked),
+		Offset:   offset,
+		Limit:    pageLimit,
+	}
+	if offset >= len(ranked) {
+		return res
+	}
+	end := offset + pageLimit
+	if end > len(ranked) {
+		end = len(ranked)
+	}
+	for _, rf := range ranked[offset:end] {
+		res.Children = append(res.Children, searchNode(rf))
+	}
+	return res
+}
+
+// searchNode is how a match shows up in a search response
+func searchNode(rf rankedFile) FileNode {
+	return FileNode{
+		Name:     rf.file.Name,
+		Path:     rf.file.Path,
+		IsFolder: false,
+		Tags:     rf.file.Tags,
+		Metadata: ConvertMetadataEntries(rf.file.Metadata),
+		Manager:  rf.manager,
+	}
+}
+
+// searchAllManagers runs match on every manager and merges the hits into one ranking.
+// both searches rank by plain distances first, so hits from different managers compare
+// directly. keyword scores only order hits of equal distance and are taken against the
+// keyword indexes of all managers together. a file inside two nested managers is listed
+// once, for the innermost manager.
+func searchAllManagers(run *searchRun, match func(run *searchRun, c *Folder) *safeResults) []rankedFile {
+	mu.Lock()
+	composites := append([]*Folder(nil), Composites...)
+	mu.Unlock()
+
+	ranked := []rankedFile{}
+	seen := make(map[string]struct{})
+	streamed := make(map[string]struct{})
+	for _, c := range composites {
+		if run.stopped() {
+			break
+		}
+		name := c.Name
+		label := func(path string) string {
+			return innermostManager(composites, path, name)
+		}
+		sr := match(run.forManager(label, streamed), c)
+		for _, rf := range sr.rankedFiles {
+			key := filepath.Clean(rf.file.Path)
+			if _, ok := seen[key]; ok {
+				continue
 			}
+			seen[key] = struct{}{}
+			rf.manager = label(rf.file.Path)
+			ranked = append(ranked, rf)
+		}
+	}
+	sortRanked(ranked)
+	return ranked
+}
 
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(cores)
-			return
+// innermostManager names the manager path belongs to: of the managers whose root holds
+// it the one with the longest root, by name when two share a root. found, the manager
+// that reported the path, is used when no root holds it.
+func innermostManager(composites []*Folder, path, found string) string {
+	path = filepath.Clean(path)
+	best, bestLen := found, -1
+	for _, c := range composites {
+		root := filepath.Clean(c.Path)
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if len(root) > bestLen || (len(root) == bestLen && c.Name < best) {
+			best, bestLen = c.Name, len(root)
 		}
 	}
-	http.Error(w, "No smart manager with that name", http.StatusBadRequest)
+	return best
+}
 
+// wantsAllManagers reports whether the search should span every manager
+func wantsAllManagers(r *http.Request) bool {
+	return r.URL.Query().Get("all") == "true"
 }
 
 func ConvertMetadataEntries(entries []*MetadataEntry) *Metadata {
@@ -176,145 +277,145 @@ func ConvertMetadataEntries(entries []*MetadataEntry) *Metadata {
 	return md
 }
 
-func getMatches(text string, composite *Folder) *safeResults {
-
-	res := &safeResults{
-		Name: composite.Name,
-	}
+// getMatches ranks files by name, filter (optional) decides which files are considered at all.
+// every match is returned, callers page through them.
+func getMatches(run *searchRun, text string, composite *Folder, filter func(*File) bool) *safeResults {
 
 	resultChan := make(chan rankedFile)
 
-	var wg sync.WaitGroup
-
-	wg.Add(1)
-	go exploreFolder(composite, text, resultChan, &wg)
-
-	go func() {
-		wg.Wait()
-		close(resultChan)
-	}()
-
-	seen := make(map[string]struct{})
-	for currentRankedFile := range resultChan {
+	if composite.nameIndex != nil {
+		// only files sharing a trigram with text are scored
+		go func() {
+			indexedMatches(run, composite.nameIndex, text, filter, resultChan)
+			close(resultChan)
+		}()
+	} else {
+		var wg sync.WaitGroup
 
-		key := currentRankedFile.file.Path
-		if _, ok := seen[key]; ok {
-			continue // already inserted this file
-		}
-		seen[key] = struct{}{}
+		wg.Add(1)
+		go exploreFolder(run, composite, text, filter, resultChan, &wg)
 
-		inserted := false
-		for i, iteratedRankedFile := range res.rankedFiles {
-			//if current is better
-			if iteratedRankedFile.distance > currentRankedFile.distance {
-
-				if len(res.rankedFiles) < limit && (currentRankedFile.distance < maxDist) {
-					//insert by shifting over to make the array sorted
-					res.rankedFiles = append(
-						append(res.rankedFiles[:i], currentRankedFile),
-						res.rankedFiles[i:]...,
-					)
-
-					inserted = true
-					break
-				} else {
-					res.rankedFiles = append(
-						append(
-							res.rankedFiles[:i],
-							currentRankedFile,
-						),
-						res.rankedFiles[i:limit-1]...,
-					)
-					inserted = true
-					break
-				}
-			}
-		}
-		// if limit is not reached and not inserted then we insert at the end
-		if len(res.rankedFiles) < limit {
-			if !inserted && (currentRankedFile.distance < maxDist) {
-				res.rankedFiles = append(res.rankedFiles, currentRankedFile)
-			}
-		}
+		go func() {
+			wg.Wait()
+			close(resultChan)
+		}()
 	}
 
-	//checks to remove dups (yes if concurrency was perfect there wouldnt be dups)
-	unique := make([]rankedFile, 0, len(res.rankedFiles))
-
-	finalSeen := make(map[string]struct{}, len(res.rankedFiles))
+	return &safeResults{
+		Name:        composite.Name,
+		rankedFiles: collectRanked(run, resultChan, maxDist),
+	}
+}
 
-	for _, rf := range res.rankedFiles {
+// collectRanked drains c, keeps each path once and only distances below cutoff, and
+// sorts by distance, name and path so pages stay stable between requests. kept matches
+// are reported to run as they arrive.
+func collectRanked(run *searchRun, c <-chan rankedFile, cutoff int) []rankedFile {
+	ranked := []rankedFile{}
+	seen := make(map[string]struct{})
+	for rf := range c {
+		if rf.distance >= cutoff {
+			continue
+		}
+		//checks to remove dups (yes if concurrency was perfect there wouldnt be dups)
 		key := filepath.Clean(rf.file.Path)
-
-		if _, ok := finalSeen[key]; ok {
+		if _, ok := seen[key]; ok {
 			continue
 		}
-
-		finalSeen[key] = struct{}{}
-		unique = append(unique, rf)
+		seen[key] = struct{}{}
+		ranked = append(ranked, rf)
+		run.emit(rf)
 	}
-	res.rankedFiles = unique
+	sortRanked(ranked)
+	return ranked
+}
 
-	sort.SliceStable(res.rankedFiles, func(i, j int) bool {
-		if res.rankedFiles[i].distance != res.rankedFiles[j].distance {
-			return res.rankedFiles[i].distance < res.rankedFiles[j].distance
+func sortRanked(ranked []rankedFile) {
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].distance != ranked[j].distance {
+			return ranked[i].distance < ranked[j].distance
+		}
+		if ranked[i].score != ranked[j].score {
+			return ranked[i].score > ranked[j].score
+		}
+		ni := strings.ToLower(ranked[i].file.Name)
+		nj := strings.ToLower(ranked[j].file.Name)
+		if ni != nj {
+			return ni < nj
 		}
-		return strings.ToLower(res.rankedFiles[i].file.Name) < strings.ToLower(res.rankedFiles[j].file.Name)
+		return filepath.Clean(ranked[i].file.Path) < filepath.Clean(ranked[j].file.Path)
 	})
-
-	return res
 }
 
-func exploreFolder(f *Folder, text string, c chan<- rankedFile, wg *sync.WaitGroup) {
+// exploreFolder sends the name matches below f to c, it stops once run is stopped
+func exploreFolder(run *searchRun, f *Folder, text string, filter func(*File) bool, c chan<- rankedFile, wg *sync.WaitGroup) {
 	defer wg.Done()
-
-	lowSearch := strings.ToLower(text)
+	if run.stopped() {
+		return
+	}
 
 	for _, folder := range f.Subfolders {
 		wg.Add(1)
-		go exploreFolder(folder, text, c, wg)
+		go exploreFolder(run, folder, text, filter, c, wg)
 	}
 
 	for _, file := range f.Files {
-		dist := LevenshteinDist(text, file.Name)
-
-		if strings.Contains(strings.ToLower(file.Name), lowSearch) {
-			dist = 0
-		}
-		maxLen := len(text)
-		if len(file.Name) > maxLen {
-			maxLen = len(file.Name)
-		}
-		if maxLen == 0 {
+		if filter != nil && !filter(file) {
 			continue
 		}
-		similarity := 1.0 - float64(dist)/float64(maxLen)
-
-		// dynamic minimum similarity depending on search length
-		minSim := similarityThreshold
-		switch {
-		case len(text) == 0:
-			continue
-		case len(text) <= 2:
-			//initial must match
-			if !strings.HasPrefix(strings.ToLower(file.Name), lowSearch) {
-				continue
+		if dist, ok := fuzzyNameMatch(text, file.Name); ok {
+			select {
+			case c <- rankedFile{file: file, distance: dist}:
+			case <-run.done():
+				return
 			}
-			minSim = 0.90
+		}
+	}
 
-		case len(text) <= 5:
-			minSim = 0.75
+}
 
-		case len(text) <= 8:
-			minSim = 0.60
+// fuzzyNameMatch scores name against text, ok is false when the name is not similar
+// enough to count as a hit. a name containing text scores 0.
+func fuzzyNameMatch(text string, name string) (int, bool) {
+	lowSearch := foldText(text)
+	lowName := foldText(name)
 
-		default:
-			minSim = similarityThreshold
-		}
+	dist := LevenshteinDist(text, name)
 
-		if dist <= maxDist && similarity >= minSim {
-			c <- rankedFile{file: *file, distance: dist}
+	if strings.Contains(lowName, lowSearch) {
+		dist = 0
+	}
+	textLen := utf8.RuneCountInString(lowSearch)
+	maxLen := textLen
+	if n := utf8.RuneCountInString(lowName); n > maxLen {
+		maxLen = n
+	}
+	if maxLen == 0 {
+		return dist, false
+	}
+	similarity := 1.0 - float64(dist)/float64(maxLen)
+
+	// dynamic minimum similarity depending on search length
+	minSim := similarityThreshold
+	switch {
+	case textLen == 0:
+		return dist, false
+	case textLen <= 2:
+		//initial must match, in scripts without spaces anywhere in the name
+		if !strings.HasPrefix(lowName, lowSearch) && !(unspacedScript(lowSearch) && dist == 0) {
+			return dist, false
 		}
+		minSim = 0.90
+
+	case textLen <= 5:
+		minSim = 0.75
+
+	case textLen <= 8:
+		minSim = 0.60
+
+	default:
+		minSim = similarityThreshold
 	}
 
+	return dist, dist <= maxDist && similarity >= minSim
 }
@@ -0,0 +1,284 @@
+package filesystem
+
+// the keyword index ranks /keywordSearch with BM25 over the keywords extracted for each
+// file. keywords are split into words, a word counts once for every keyword of the file
+// it appears in, weighted by how strong that keyword is for the file, and rare words
+// weigh more through their inverse document frequency. query words the index does not
+// know at all fall back to fuzzy matching against the indexed words so typos still find
+// something, always ranked below the exact hits. the index lives on the manager root,
+// is built by the first keyword search and dropped whenever the keywords or the tree of
+// the manager change. a search over every manager scores against the word statistics
+// of all their indexes together, see keywordCorpus.
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"unicode/utf8"
+
+	pb "github.com/COS301-SE-2025/Smart-File-Manager/golang/client/protos"
+)
+
+// usual BM25 parameters, k1 saturates the term frequency, b normalises for the number
+// of keyword words a file has
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+type keywordPosting struct {
+	doc int32
+	tf  float64
+}
+
+type keywordIndex struct {
+	files    []*File
+	lengths  []float64
+	total    float64
+	postings map[string][]keywordPosting
+}
+
+// keywordCorpus is the collection BM25 scores against: the file count, the average
+// keyword length and the document frequency of a word over one or more indexes. it
+// makes the scores of different managers comparable.
+type keywordCorpus struct {
+	indexes []*keywordIndex
+	files   int
+	avgLen  float64
+}
+
+func newKeywordCorpus(indexes ...*keywordIndex) *keywordCorpus {
+	corpus := &keywordCorpus{indexes: indexes}
+	total := 0.0
+	for _, idx := range indexes {
+		corpus.files += len(idx.files)
+		total += idx.total
+	}
+	if corpus.files > 0 {
+		corpus.avgLen = total / float64(corpus.files)
+	}
+	return corpus
+}
+
+// keywordCorpusFor is the union of the keyword indexes of managers
+func keywordCorpusFor(managers []*Folder) *keywordCorpus {
+	indexes := make([]*keywordIndex, 0, len(managers))
+	for _, c := range managers {
+		indexes = append(indexes, keywordIndexFor(c))
+	}
+	return newKeywordCorpus(indexes...)
+}
+
+// guards the keywordIndex field of every manager
+var keywordIndexMu sync.Mutex
+
+// keywordIndexFor returns the keyword index of c, building it when needed
+func keywordIndexFor(c *Folder) *keywordIndex {
+	keywordIndexMu.Lock()
+	defer keywordIndexMu.Unlock()
+	if c.keywordIndex == nil {
+		c.keywordIndex = buildKeywordIndex(c)
+	}
+	return c.keywordIndex
+}
+
+// dropKeywordIndex forgets the keyword index of c, the next search rebuilds it
+func dropKeywordIndex(c *Folder) {
+	keywordIndexMu.Lock()
+	c.keywordIndex = nil
+	keywordIndexMu.Unlock()
+}
+
+// keywordWords splits a keyword or search term into folded words
+func keywordWords(text string) []string {
+	var words []string
+	for _, tok := range tokenizeText(foldText(text)) {
+		words = append(words, tok.term)
+	}
+	return words
+}
+
+// keywordWeights rates every keyword of a file between 0.5 and 1 against its other
+// keywords. go's RAKE scores are at least 1 and higher is better, the YAKE scores from
+// python stay below 1 and lower is better, so each kind is compared among itself.
+// keywords without a score count fully.
+func keywordWeights(kws []*pb.Keyword) []float64 {
+	maxRake, minYake := 0.0, math.Inf(1)
+	for _, kw := range kws {
+		if kw == nil {
+			continue
+		}
+		switch s := float64(kw.Score); {
+		case s >= 1:
+			maxRake = math.Max(maxRake, s)
+		case s > 0:
+			minYake = math.Min(minYake, s)
+		}
+	}
+	weights := make([]float64, len(kws))
+	for i, kw := range kws {
+		rel := 1.0
+		if kw != nil {
+			switch s := float64(kw.Score); {
+			case s >= 1:
+				rel = s / maxRake
+			case s > 0:
+				rel = minYake / s
+			}
+		}
+		weights[i] = 0.5 + 0.5*rel
+	}
+	return weights
+}
+
+// buildKeywordIndex indexes the keywords of every file below root
+func buildKeywordIndex(root *Folder) *keywordIndex {
+	idx := &keywordIndex{postings: make(map[string][]keywordPosting)}
+	var walk func(f *Folder)
+	walk = func(f *Folder) {
+		for _, file := range f.Files {
+			tf := make(map[string]float64)
+			length := 0.0
+			for i, weight := range keywordWeights(file.Keywords) {
+				if file.Keywords[i] == nil {
+					continue
+				}
+				for _, word := range keywordWords(file.Keywords[i].Keyword) {
+					tf[word] += weight
+					length++
+				}
+			}
+			if length == 0 {
+				continue
+			}
+			doc := int32(len(idx.files))
+			idx.files = append(idx.files, file)
+			idx.lengths = append(idx.lengths, length)
+			idx.total += length
+			for word, freq := range tf {
+				idx.postings[word] = append(idx.postings[word], keywordPosting{doc: doc, tf: freq})
+			}
+		}
+		for _, sub := range f.Subfolders {
+			walk(sub)
+		}
+	}
+	walk(root)
+	return idx
+}
+
+// idf is the BM25 inverse document frequency of word over the corpus
+func (corpus *keywordCorpus) idf(word string) float64 {
+	df := 0
+	for _, idx := range corpus.indexes {
+		df += len(idx.postings[word])
+	}
+	n := float64(corpus.files)
+	return math.Log(1 + (n-float64(df)+0.5)/(float64(df)+0.5))
+}
+
+// typoBudget is how many edits a query word not in the index may be away from an
+// indexed word, one or two letter words have to match exactly
+func typoBudget(word string) int {
+	switch n := utf8.RuneCountInString(word); {
+	case n <= 2:
+		return -1
+	case n <= 4:
+		return 1
+	case n <= 8:
+		return 2
+	}
+	return 3
+}
+
+type fuzzyWord struct {
+	word string
+	dist int
+}
+
+// fuzzyWords returns the indexed words within the typo budget of word, sorted so the
+// scores add up the same way every time
+func (idx *keywordIndex) fuzzyWords(word string) []fuzzyWord {
+	budget := typoBudget(word)
+	var found []fuzzyWord
+	for indexed := range idx.postings {
+		if dist := LevenshteinDistForKeywords(word, indexed); dist <= budget {
+			found = append(found, fuzzyWord{indexed, dist})
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].word < found[j].word })
+	return found
+}
+
+type keywordHit struct {
+	score float64
+	// 0 once a query word matched exactly, else 1 + the smallest typo distance
+	distance int
+}
+
+// search ranks the files whose keywords contain the search terms. files matching a
+// word exactly come first (distance 0), files only found through a typo follow with
+// distance 1 + edits. within a distance files are ordered by their BM25 score. every
+// file is reported to run when its first word is found, before it is fully scored.
+func (idx *keywordIndex) search(run *searchRun, terms []string, filter func(*File) bool) []rankedFile {
+	return idx.searchIn(newKeywordCorpus(idx), run, terms, filter)
+}
+
+// searchIn is search with the scores taken against corpus, which holds idx
+func (idx *keywordIndex) searchIn(corpus *keywordCorpus, run *searchRun, terms []string, filter func(*File) bool) []rankedFile {
+	// files the filter turned down are kept as nil so they are only asked once
+	hits := make(map[int32]*keywordHit)
+	add := func(word string, factor float64, distance int) {
+		postings := idx.postings[word]
+		idf := corpus.idf(word)
+		for _, p := range postings {
+			hit, ok := hits[p.doc]
+			if !ok {
+				file := idx.files[p.doc]
+				if filter == nil || filter(file) {
+					hit = &keywordHit{distance: distance}
+					run.emit(rankedFile{file: file, distance: distance})
+				}
+				hits[p.doc] = hit
+			}
+			if hit == nil {
+				continue
+			}
+			norm := 1 - bm25B + bm25B*idx.lengths[p.doc]/corpus.avgLen
+			hit.score += factor * idf * p.tf * (bm25K1 + 1) / (p.tf + bm25K1*norm)
+			if distance < hit.distance {
+				hit.distance = distance
+			}
+		}
+	}
+
+	seen := make(map[string]struct{})
+	for _, term := range terms {
+		for _, word := range keywordWords(term) {
+			if run.stopped() {
+				return nil
+			}
+			if _, ok := seen[word]; ok {
+				continue
+			}
+			seen[word] = struct{}{}
+			if _, ok := idx.postings[word]; ok {
+				add(word, 1, 0)
+				continue
+			}
+			// a typo counts at most half as much as the real word
+			for _, fw := range idx.fuzzyWords(word) {
+				add(fw.word, 1/float64(2+fw.dist), 1+fw.dist)
+			}
+		}
+	}
+
+	ranked := []rankedFile{}
+	for doc, hit := range hits {
+		if hit != nil {
+			ranked = append(ranked, rankedFile{file: idx.files[doc], distance: hit.distance, score: hit.score})
+		}
+	}
+	sortRanked(ranked)
+	return ranked
+}
@@ -0,0 +1,170 @@
+package filesystem
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	pb "github.com/COS301-SE-2025/Smart-File-Manager/golang/client/protos"
+)
+
+// keywordFolder builds a manager with one file per entry, keywords given as word=score
+func keywordFolder(files map[string]string) *Folder {
+	c := &Folder{Name: "kw", Path: "/kw"}
+	for name, spec := range files {
+		file := &File{Name: name, Path: "/kw/" + name}
+		for _, pair := range strings.Split(spec, ",") {
+			var score float32
+			word, raw, _ := strings.Cut(pair, "=")
+			fmt.Sscan(raw, &score)
+			file.Keywords = append(file.Keywords, &pb.Keyword{Keyword: word, Score: score})
+		}
+		c.Files = append(c.Files, file)
+	}
+	return c
+}
+
+func rankedNames(ranked []rankedFile) string {
+	var names []string
+	for _, rf := range ranked {
+		names = append(names, rf.file.Name)
+	}
+	return strings.Join(names, " ")
+}
+
+func TestKeywordIndex_RareWordsWeighMore(t *testing.T) {
+	c := keywordFolder(map[string]string{
+		"a.txt":     "budget=2,holiday=2",
+		"b.txt":     "budget=2,travel=2",
+		"c.txt":     "budget=2,minutes=2",
+		"audit.txt": "audit=2,minutes=2",
+	})
+	got := keywordIndexFor(c).search(nil, []string{"budget", "audit"}, nil)
+	if len(got) != 4 || got[0].file.Name != "audit.txt" {
+		t.Fatalf("the rare word should rank its file first, got %s", rankedNames(got))
+	}
+}
+
+func TestKeywordIndex_KeywordScoreAndFrequency(t *testing.T) {
+	// RAKE, higher is better
+	c := keywordFolder(map[string]string{
+		"strong.txt": "budget=9,holiday=1",
+		"weak.txt":   "budget=1,holiday=9",
+	})
+	if got := rankedNames(keywordIndexFor(c).search(nil, []string{"budget"}, nil)); got != "strong.txt weak.txt" {
+		t.Fatalf("the stronger rake keyword should rank first, got %s", got)
+	}
+	// YAKE, lower is better
+	c = keywordFolder(map[string]string{
+		"strong.txt": "budget=0.01,holiday=0.05",
+		"weak.txt":   "budget=0.05,holiday=0.01",
+	})
+	if got := rankedNames(keywordIndexFor(c).search(nil, []string{"budget"}, nil)); got != "strong.txt weak.txt" {
+		t.Fatalf("the stronger yake keyword should rank first, got %s", got)
+	}
+	// the word in two keywords beats the word in one, both files have three words
+	c = keywordFolder(map[string]string{
+		"twice.txt": "budget=1,budget review=1",
+		"once.txt":  "budget=1,holiday plans=1",
+	})
+	if got := rankedNames(keywordIndexFor(c).search(nil, []string{"budget"}, nil)); got != "twice.txt once.txt" {
+		t.Fatalf("term frequency should count, got %s", got)
+	}
+}
+
+func TestKeywordIndex_FuzzyOnlyAsFallback(t *testing.T) {
+	c := keywordFolder(map[string]string{
+		"tax.txt":      "tax=1",
+		"tab.txt":      "tab=1",
+		"learning.txt": "machine learning=3",
+	})
+	idx := keywordIndexFor(c)
+	if got := rankedNames(idx.search(nil, []string{"tax"}, nil)); got != "tax.txt" {
+		t.Fatalf("an indexed word should not pull in typos, got %s", got)
+	}
+	got := idx.search(nil, []string{"learn"}, nil)
+	if len(got) != 1 || got[0].file.Name != "learning.txt" || got[0].distance == 0 {
+		t.Fatalf("an unknown word should fall back to similar words, got %+v", got)
+	}
+	// an exact hit on one word ranks above typo hits on the other
+	got = idx.search(nil, []string{"learnnig", "tab"}, nil)
+	if rankedNames(got) != "tab.txt learning.txt" || got[0].distance != 0 || got[1].distance == 0 {
+		t.Fatalf("exact hits first, got %s", rankedNames(got))
+	}
+	if got := idx.search(nil, []string{"ta"}, nil); len(got) != 0 {
+		t.Fatalf("short words need an exact hit, got %s", rankedNames(got))
+	}
+	if got := idx.search(nil, []string{"tax"}, func(f *File) bool { return f.Name != "tax.txt" }); len(got) != 0 {
+		t.Fatalf("the filter should apply, got %s", rankedNames(got))
+	}
+}
+
+func TestKeywordIndex_RebuiltAfterChanges(t *testing.T) {
+	c := keywordFolder(map[string]string{"a.txt": "budget=1"})
+	if got := keywordIndexFor(c).search(nil, []string{"invoice"}, nil); len(got) != 0 {
+		t.Fatalf("unexpected hits %s", rankedNames(got))
+	}
+	c.AddFile(&File{Name: "b.txt", Path: "/kw/b.txt", Keywords: []*pb.Keyword{{Keyword: "invoice", Score: 1}}})
+	if got := rankedNames(keywordIndexFor(c).search(nil, []string{"invoice"}, nil)); got != "b.txt" {
+		t.Fatalf("added files should be searchable, got %s", got)
+	}
+
+	// keywords restored from storage replace the indexed ones
+	mergeDirectoryTreeToComposite(c, &DirectoryTreeJson{Children: []FileNode{
+		{Name: "a.txt", Path: "/kw/a.txt", Keywords: []*pb.Keyword{{Keyword: "invoice", Score: 1}}},
+	}})
+	if got := rankedNames(keywordIndexFor(c).search(nil, []string{"invoice"}, nil)); got != "a.txt b.txt" {
+		t.Fatalf("restored keywords should be searchable, got %s", got)
+	}
+
+	c.RemoveFile("/kw/b.txt")
+	if got := rankedNames(keywordIndexFor(c).search(nil, []string{"invoice"}, nil)); got != "a.txt" {
+		t.Fatalf("removed files should be gone, got %s", got)
+	}
+}
+
+func TestKeywordSearchHandler_AllManagersScoreTogether(t *testing.T) {
+	orig := Composites
+	defer func() { Composites = orig }()
+	// budget is rare at work and everywhere at home, on its own each manager would
+	// rank its hit differently although the files look the same
+	work := keywordFolder(map[string]string{"z.txt": "budget=1"})
+	for i := 0; i < 8; i++ {
+		work.AddFile(&File{Name: fmt.Sprint(i), Path: fmt.Sprintf("/kw/%d", i), Keywords: []*pb.Keyword{{Keyword: "other", Score: 1}}})
+	}
+	home := keywordFolder(map[string]string{"a.txt": "budget=1", "b.txt": "budget=1"})
+	home.Name, home.Path = "home", "/home"
+	for _, f := range home.Files {
+		f.Path = "/home/" + f.Name
+	}
+	Composites = []*Folder{work, home}
+
+	res := decodePage(t, "budget", func(rr *httptest.ResponseRecorder) {
+		KeywordSearchHadler(rr, httptest.NewRequest("GET", "/keywordSearch?all=true&searchText=budget", nil))
+	})
+	var names []string
+	for _, child := range res.Children {
+		names = append(names, child.Name)
+	}
+	if strings.Join(names, " ") != "a.txt b.txt z.txt" {
+		t.Fatalf("equal files should score equally over all managers, got %v", names)
+	}
+}
+
+func TestKeywordSearchHandler_RanksByRelevance(t *testing.T) {
+	orig := Composites
+	defer func() { Composites = orig }()
+	c := keywordFolder(map[string]string{
+		"a_minutes.txt": "meeting=1,minutes=8,board=8",
+		"b_agenda.txt":  "meeting=8,agenda=1",
+	})
+	Composites = []*Folder{c}
+
+	res := decodePage(t, "meeting", func(rr *httptest.ResponseRecorder) {
+		KeywordSearchHadler(rr, httptest.NewRequest("GET", "/keywordSearch?compositeName=kw&searchText=meeting", nil))
+	})
+	if res.Total != 2 || res.Children[0].Name != "b_agenda.txt" {
+		t.Fatalf("the file where meeting is the main keyword should come first, got %+v", res.Children)
+	}
+}
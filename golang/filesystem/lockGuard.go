@@ -0,0 +1,168 @@
+package filesystem
+
+// every destructive operation (delete, tag rename/merge/delete and tag removal) asks
+// the lock guard before it changes anything. locked items are refused before the disk
+// is touched and the caller gets the blocked items back. force=true overrides. a move
+// does not refuse, it leaves the items a user or a policy locked where they are.
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+type BlockedItem struct {
+	Path     string `json:"path"`
+	Name     string `json:"name"`
+	IsFolder bool   `json:"isFolder"`
+	// LockedBy is the locked folder the item sits in when the item itself is not locked
+	LockedBy string    `json:"lockedBy,omitempty"`
+	Lock     *LockInfo `json:"lock,omitempty"`
+}
+
+// LockConflict is the 409 response of a refused operation
+type LockConflict struct {
+	Operation string        `json:"operation"`
+	Blocked   []BlockedItem `json:"blocked"`
+}
+
+func forceRequested(r *http.Request) bool {
+	return r.URL.Query().Get("force") == "true"
+}
+
+// locateItem finds path in c and returns it together with the folders above it, root first
+func locateItem(f *Folder, path string, ancestors []*Folder) (*File, *Folder, []*Folder) {
+	if f.Path == path {
+		return nil, f, ancestors
+	}
+	ancestors = append(ancestors, f)
+	for _, file := range f.Files {
+		if file.Path == path {
+			return file, nil, ancestors
+		}
+	}
+	for _, sub := range f.Subfolders {
+		if file, folder, chain := locateItem(sub, path, ancestors); file != nil || folder != nil {
+			return file, folder, chain
+		}
+	}
+	return nil, nil, nil
+}
+
+func closestLocked(ancestors []*Folder) *Folder {
+	for i := len(ancestors) - 1; i >= 0; i-- {
+		if ancestors[i].Locked {
+			return ancestors[i]
+		}
+	}
+	return nil
+}
+
+func blockedItem(path, name string, isFolder, locked bool, info *LockInfo, lockedBy *Folder) BlockedItem {
+	b := BlockedItem{Path: path, Name: name, IsFolder: isFolder, Lock: info}
+	if !locked && lockedBy != nil {
+		b.LockedBy = lockedBy.Path
+		b.Lock = lockedBy.LockInfo
+	}
+	return b
+}
+
+// lockBlockers lists what keeps paths from being changed: the item itself, the closest
+// locked folder it sits in and, with contents, every locked item inside a folder.
+// unknown paths are left to the caller. expired locks are released first. caller holds mu.
+func lockBlockers(c *Folder, paths []string, contents bool) []BlockedItem {
+	if releaseExpiredLocks(c, time.Now()) > 0 {
+		queueCompositeSave(c)
+	}
+	blocked := []BlockedItem{}
+	seen := map[string]bool{}
+	add := func(b BlockedItem) {
+		if !seen[b.Path] {
+			seen[b.Path] = true
+			blocked = append(blocked, b)
+		}
+	}
+
+	for _, path := range paths {
+		file, folder, ancestors := locateItem(c, path, nil)
+		lockedBy := closestLocked(ancestors)
+		switch {
+		case file != nil:
+			if file.Locked || lockedBy != nil {
+				add(blockedItem(file.Path, file.Name, false, file.Locked, file.LockInfo, lockedBy))
+			}
+		case folder != nil:
+			if folder.Locked || lockedBy != nil {
+				add(blockedItem(folder.Path, folder.Name, true, folder.Locked, folder.LockInfo, lockedBy))
+				continue
+			}
+			if !contents {
+				continue
+			}
+			for _, e := range listLocks(folder) {
+				info := e.LockInfo
+				add(BlockedItem{Path: e.Path, Name: e.Name, IsFolder: e.IsFolder, Lock: &info})
+			}
+		}
+	}
+	return blocked
+}
+
+// lockedCarryingTag lists the locked files and folders carrying tag or one of its descendants.
+// a tagged folder blocks when it or a folder above it is locked, not for locks inside it.
+func lockedCarryingTag(c *Folder, tag string) []BlockedItem {
+	if releaseExpiredLocks(c, time.Now()) > 0 {
+		queueCompositeSave(c)
+	}
+	tag = normalizeTag(tag)
+	carries := func(tags []string) bool {
+		for _, t := range tags {
+			if tagMatches(normalizeTag(t), tag) {
+				return true
+			}
+		}
+		return false
+	}
+
+	blocked := []BlockedItem{}
+	var walk func(f *Folder, lockedBy *Folder)
+	walk = func(f *Folder, lockedBy *Folder) {
+		if f != c && carries(f.Tags) && (f.Locked || lockedBy != nil) {
+			blocked = append(blocked, blockedItem(f.Path, f.Name, true, f.Locked, f.LockInfo, lockedBy))
+		}
+		if f.Locked {
+			lockedBy = f
+		}
+		for _, file := range f.Files {
+			if carries(file.Tags) && (file.Locked || lockedBy != nil) {
+				blocked = append(blocked, blockedItem(file.Path, file.Name, false, file.Locked, file.LockInfo, lockedBy))
+			}
+		}
+		for _, sub := range f.Subfolders {
+			walk(sub, lockedBy)
+		}
+	}
+	if tag != "" {
+		walk(c, nil)
+	}
+	return blocked
+}
+
+// guardLocks answers 409 with the blocked items and returns false, unless nothing is
+// blocked or the request asks for force=true
+func guardLocks(w http.ResponseWriter, r *http.Request, operation string, blocked []BlockedItem) bool {
+	if len(blocked) == 0 {
+		return true
+	}
+	if forceRequested(r) {
+		log.Printf("%s: overriding %d lock(s)", operation, len(blocked))
+		return true
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	if err := json.NewEncoder(w).Encode(LockConflict{Operation: operation, Blocked: blocked}); err != nil {
+		log.Printf("failed to encode lock conflict: %v", err)
+	}
+	return false
+}
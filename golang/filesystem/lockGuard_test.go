@@ -0,0 +1,202 @@
+package filesystem
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLockBlockers_ItemAncestorAndContents(t *testing.T) {
+	c := lockFolder()
+	lockPathWithInfo(c, "/l/legal", &LockInfo{Reason: "legal hold", LockedAt: time.Now()})
+	// added after the folder was locked, only the folder lock covers it
+	c.Subfolders[0].Files = append(c.Subfolders[0].Files, &File{Name: "late.pdf", Path: "/l/legal/late.pdf"})
+
+	blocked := lockBlockers(c, []string{"/l/legal/late.pdf", "/l/a.txt"}, true)
+	if len(blocked) != 1 || blocked[0].LockedBy != "/l/legal" || blocked[0].Lock.Reason != "legal hold" {
+		t.Fatalf("expected late.pdf blocked by its folder, got %+v", blocked)
+	}
+
+	blocked = lockBlockers(c, []string{"/l"}, true)
+	if len(blocked) != 1 || blocked[0].Path != "/l/legal" || !blocked[0].IsFolder {
+		t.Fatalf("expected the locked folder inside the root, got %+v", blocked)
+	}
+	if blocked = lockBlockers(c, []string{"/l"}, false); len(blocked) != 0 {
+		t.Fatalf("locks inside must not count without contents, got %+v", blocked)
+	}
+}
+
+func TestDeleteFileHandler_RefusesLockedFileUnlessForced(t *testing.T) {
+	orig := Composites
+	defer func() { Composites = orig }()
+	tmp := t.TempDir()
+	target := filepath.Join(tmp, "keep.txt")
+	os.WriteFile(target, []byte("x"), 0644)
+	c, err := ConvertToObject("guard", tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	Composites = []*Folder{c}
+	lockPathWithInfo(c, target, &LockInfo{Owner: "ana", LockedAt: time.Now()})
+
+	rr := httptest.NewRecorder()
+	deleteFileHandler(rr, httptest.NewRequest("GET", "/deleteFile?name=guard&path="+target, nil))
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d", rr.Code)
+	}
+	var conflict LockConflict
+	if err := json.NewDecoder(rr.Body).Decode(&conflict); err != nil {
+		t.Fatal(err)
+	}
+	if len(conflict.Blocked) != 1 || conflict.Blocked[0].Path != target || conflict.Blocked[0].Lock.Owner != "ana" {
+		t.Fatalf("unexpected conflict %+v", conflict)
+	}
+	if _, err := os.Stat(target); err != nil {
+		t.Fatalf("locked file must stay on disk: %v", err)
+	}
+
+	rr = httptest.NewRecorder()
+	deleteFileHandler(rr, httptest.NewRequest("GET", "/deleteFile?name=guard&force=true&path="+target, nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("forced delete failed with %d", rr.Code)
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) || c.GetFile(target) != nil {
+		t.Fatalf("forced delete should remove the file from disk and tree")
+	}
+}
+
+func TestDeleteHandlers_CleanPathBeforeGuard(t *testing.T) {
+	orig := Composites
+	defer func() { Composites = orig }()
+	tmp := t.TempDir()
+	held := filepath.Join(tmp, "held")
+	os.MkdirAll(held, 0755)
+	os.WriteFile(filepath.Join(held, "f.txt"), []byte("x"), 0644)
+	c, err := ConvertToObject("clean", tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	Composites = []*Folder{c}
+	lockPathWithInfo(c, held, &LockInfo{Owner: "ana", LockedAt: time.Now()})
+
+	for _, spelling := range []string{held + "/", held + "/.", filepath.Join(held, "..", "held")} {
+		rr := httptest.NewRecorder()
+		deleteFolderHandler(rr, httptest.NewRequest("GET", "/deleteFolder?name=clean&path="+spelling, nil))
+		if rr.Code != http.StatusConflict {
+			t.Fatalf("%s: expected 409, got %d", spelling, rr.Code)
+		}
+		rr = httptest.NewRecorder()
+		deleteFileHandler(rr, httptest.NewRequest("GET", "/deleteFile?name=clean&path="+spelling+"/f.txt", nil))
+		if rr.Code != http.StatusConflict {
+			t.Fatalf("%s/f.txt: expected 409, got %d", spelling, rr.Code)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(held, "f.txt")); err != nil {
+		t.Fatalf("locked folder must stay on disk: %v", err)
+	}
+
+	// unknown to the manager: refused without touching disk
+	outside := filepath.Join(t.TempDir(), "other.txt")
+	os.WriteFile(outside, []byte("x"), 0644)
+	rr := httptest.NewRecorder()
+	deleteFileHandler(rr, httptest.NewRequest("GET", "/deleteFile?name=clean&force=true&path="+outside, nil))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rr.Code)
+	}
+	rr = httptest.NewRecorder()
+	deleteFolderHandler(rr, httptest.NewRequest("GET", "/deleteFolder?name=clean&force=true&path="+tmp, nil))
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("the manager root cannot be deleted, got %d", rr.Code)
+	}
+	if _, err := os.Stat(outside); err != nil {
+		t.Fatalf("files outside the manager must stay: %v", err)
+	}
+}
+
+func TestBulkDeleteFolders_RefusesWholeBatch(t *testing.T) {
+	orig := Composites
+	defer func() { Composites = orig }()
+	tmp := t.TempDir()
+	for _, dir := range []string{"free", "held"} {
+		os.MkdirAll(filepath.Join(tmp, dir), 0755)
+		os.WriteFile(filepath.Join(tmp, dir, "f.txt"), []byte("x"), 0644)
+	}
+	c, _ := ConvertToObject("guard", tmp)
+	Composites = []*Folder{c}
+	lockPathWithInfo(c, filepath.Join(tmp, "held", "f.txt"), &LockInfo{LockedAt: time.Now()})
+
+	body := `[{"file_path":"` + filepath.Join(tmp, "free") + `"},{"file_path":"` + filepath.Join(tmp, "held") + `"}]`
+	rr := httptest.NewRecorder()
+	BulkDeleteFolderHandler(rr, httptest.NewRequest("POST", "/bulkDeleteFolders?name=guard", strings.NewReader(body)))
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d", rr.Code)
+	}
+	if _, err := os.Stat(filepath.Join(tmp, "free")); err != nil {
+		t.Fatalf("nothing may be deleted when the batch is refused")
+	}
+}
+
+func TestTagRegistryOperation_BlockedByLockedCarrier(t *testing.T) {
+	chdirTemp(t)
+	orig := Composites
+	defer func() { Composites = orig }()
+	c := lockFolder()
+	c.Files[0].Tags = []string{"client/acme"}
+	c.Subfolders[0].Files[0].Tags = []string{"client"}
+	Composites = []*Folder{c}
+	lockPathWithInfo(c, "/l/legal", &LockInfo{LockedAt: time.Now()})
+
+	rr := httptest.NewRecorder()
+	deleteTagHandler(rr, httptest.NewRequest("GET", "/deleteTag?name=locks&tag=client", nil))
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d", rr.Code)
+	}
+	if len(c.Files[0].Tags) != 1 {
+		t.Fatalf("a refused change must not touch any file")
+	}
+
+	rr = httptest.NewRecorder()
+	renameTagHandler(rr, httptest.NewRequest("GET", "/renameTag?name=locks&from=client/acme&to=client/acme-corp", nil))
+	if rr.Code != http.StatusOK || c.Files[0].Tags[0] != "client/acme-corp" {
+		t.Fatalf("tags on unlocked files only should rename, got %d %v", rr.Code, c.Files[0].Tags)
+	}
+}
+
+func TestDeleteHandlers_FailedDiskDeleteKeepsNode(t *testing.T) {
+	orig := Composites
+	defer func() { Composites = orig }()
+	tmp := t.TempDir()
+	// a regular file where a directory is expected makes the disk delete fail
+	os.WriteFile(filepath.Join(tmp, "blocker"), []byte("x"), 0644)
+	c, err := ConvertToObject("failing", tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	Composites = []*Folder{c}
+	stuck := filepath.Join(tmp, "blocker", "stuck.txt")
+	c.Files = append(c.Files, &File{Name: "stuck.txt", Path: stuck, Tags: []string{"keep"}})
+
+	rr := httptest.NewRecorder()
+	deleteFileHandler(rr, httptest.NewRequest("GET", "/deleteFile?name=failing&path="+stuck, nil))
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", rr.Code)
+	}
+	if file := c.GetFile(stuck); file == nil || len(file.Tags) != 1 {
+		t.Fatalf("a file that could not be deleted must keep its node and tags")
+	}
+
+	rr = httptest.NewRecorder()
+	body := `[{"file_path":"` + stuck + `"}]`
+	BulkDeleteFileHandler(rr, httptest.NewRequest("POST", "/bulkDeleteFiles?name=failing", strings.NewReader(body)))
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500 from the bulk delete, got %d", rr.Code)
+	}
+	if c.GetFile(stuck) == nil {
+		t.Fatalf("bulk delete must keep the node of a file that could not be deleted")
+	}
+}
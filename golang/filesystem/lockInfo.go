@@ -0,0 +1,271 @@
+package filesystem
+
+// locks carry why and by whom they were set and can expire. Locked stays the source
+// of truth for "is this locked", Lock holds the details. expired locks are released
+// by a background check, on rescans and whenever the lock list is read.
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const lockExpiryInterval = time.Minute
+
+type LockInfo struct {
+	Reason    string     `json:"reason,omitempty"`
+	Owner     string     `json:"owner,omitempty"`
+	LockedAt  time.Time  `json:"lockedAt"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	// Policy is the id of the lock policy that set the lock
+	Policy string `json:"policy,omitempty"`
+}
+
+// LockEntry is one row of the /locks listing
+type LockEntry struct {
+	Path     string `json:"path"`
+	Name     string `json:"name"`
+	IsFolder bool   `json:"isFolder"`
+	LockInfo
+}
+
+func (l *LockInfo) expired(now time.Time) bool {
+	return l != nil && l.ExpiresAt != nil && !now.Before(*l.ExpiresAt)
+}
+
+func sameLockInfo(a, b *LockInfo) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if a.Reason != b.Reason || a.Owner != b.Owner || a.Policy != b.Policy || !a.LockedAt.Equal(b.LockedAt) {
+		return false
+	}
+	if a.ExpiresAt == nil || b.ExpiresAt == nil {
+		return a.ExpiresAt == b.ExpiresAt
+	}
+	return a.ExpiresAt.Equal(*b.ExpiresAt)
+}
+
+// lockInfoFromRequest reads reason, owner and either expiresAt (RFC3339) or duration ("2h")
+func lockInfoFromRequest(r *http.Request, now time.Time) (*LockInfo, error) {
+	q := r.URL.Query()
+	info := &LockInfo{
+		Reason:   strings.TrimSpace(q.Get("reason")),
+		Owner:    strings.TrimSpace(q.Get("owner")),
+		LockedAt: now.UTC(),
+	}
+	if raw := q.Get("expiresAt"); raw != "" {
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expiresAt, expected RFC3339: %w", err)
+		}
+		t = t.UTC()
+		info.ExpiresAt = &t
+	} else if raw := q.Get("duration"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid duration %q", raw)
+		}
+		t := info.LockedAt.Add(d)
+		info.ExpiresAt = &t
+	}
+	if info.ExpiresAt != nil && !info.ExpiresAt.After(now) {
+		return nil, fmt.Errorf("lock would already be expired")
+	}
+	return info, nil
+}
+
+// lockPathWithInfo locks path like LockByPath and attaches info to everything it locked
+func lockPathWithInfo(c *Folder, path string, info *LockInfo) bool {
+	if file := c.GetFile(path); file != nil {
+		file.Lock()
+		file.LockInfo = info
+		if c.WriteProtect {
+			file.protect()
+		}
+		return true
+	}
+	folder := c.GetSubfolder(path)
+	if folder == nil {
+		return false
+	}
+	folder.lockRecursive()
+	var walk func(f *Folder)
+	walk = func(f *Folder) {
+		f.LockInfo = info
+		for _, file := range f.Files {
+			file.LockInfo = info
+		}
+		for _, sub := range f.Subfolders {
+			walk(sub)
+		}
+	}
+	walk(folder)
+	if c.WriteProtect {
+		protectTree(folder)
+	}
+	return true
+}
+
+// releaseExpiredLocks unlocks every item whose lock has expired, a folder takes its subtree with it
+func releaseExpiredLocks(c *Folder, now time.Time) int {
+	released := 0
+	var walk func(f *Folder)
+	walk = func(f *Folder) {
+		if f.Locked && f.LockInfo.expired(now) {
+			expired := f.LockInfo
+			var unlock func(f *Folder)
+			unlock = func(f *Folder) {
+				// only what the expired lock covers, newer locks inside stay
+				if sameLockInfo(f.LockInfo, expired) {
+					f.Locked = false
+					f.LockInfo = nil
+					f.restoreMode()
+					released++
+				}
+				for _, file := range f.Files {
+					if sameLockInfo(file.LockInfo, expired) {
+						file.Unlock()
+						released++
+					}
+				}
+				for _, sub := range f.Subfolders {
+					unlock(sub)
+				}
+			}
+			unlock(f)
+		}
+		for _, file := range f.Files {
+			if file.Locked && file.LockInfo.expired(now) {
+				file.Unlock()
+				released++
+			}
+		}
+		for _, sub := range f.Subfolders {
+			walk(sub)
+		}
+	}
+	walk(c)
+	return released
+}
+
+// releaseAllExpiredLocks runs the expiry check over every manager, caller holds mu
+func releaseAllExpiredLocks(now time.Time) {
+	for _, c := range Composites {
+		if n := releaseExpiredLocks(c, now); n > 0 {
+			log.Printf("released %d expired lock(s) in %s", n, c.Name)
+			queueCompositeSave(c)
+		}
+	}
+}
+
+func startLockExpiry() {
+	go func() {
+		ticker := time.NewTicker(lockExpiryInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			mu.Lock()
+			releaseAllExpiredLocks(time.Now())
+			mu.Unlock()
+		}
+	}()
+}
+
+// listLocks returns the locked items of a manager. items locked together with their
+// folder (same lock details) are not repeated, the folder stands for them.
+func listLocks(c *Folder) []LockEntry {
+	entries := []LockEntry{}
+	entry := func(path, name string, isFolder bool, info *LockInfo) LockEntry {
+		e := LockEntry{Path: path, Name: name, IsFolder: isFolder}
+		if info != nil {
+			e.LockInfo = *info
+		}
+		return e
+	}
+
+	var walk func(f *Folder, parentLocked bool, parentInfo *LockInfo)
+	walk = func(f *Folder, parentLocked bool, parentInfo *LockInfo) {
+		covered := func(info *LockInfo) bool {
+			return parentLocked && sameLockInfo(info, parentInfo)
+		}
+		if f.Locked && f != c && !covered(f.LockInfo) {
+			entries = append(entries, entry(f.Path, f.Name, true, f.LockInfo))
+		}
+		for _, file := range f.Files {
+			if file.Locked && !(f.Locked && sameLockInfo(file.LockInfo, f.LockInfo)) {
+				entries = append(entries, entry(file.Path, file.Name, false, file.LockInfo))
+			}
+		}
+		for _, sub := range f.Subfolders {
+			walk(sub, f.Locked, f.LockInfo)
+		}
+	}
+	walk(c, false, nil)
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+	return entries
+}
+
+// filterLocks applies the optional owner, reason (substring), type and expiresBefore filters
+func filterLocks(entries []LockEntry, r *http.Request) ([]LockEntry, error) {
+	q := r.URL.Query()
+	owner := q.Get("owner")
+	reason := strings.ToLower(q.Get("reason"))
+	kind := q.Get("type")
+	var before *time.Time
+	if raw := q.Get("expiresBefore"); raw != "" {
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expiresBefore, expected RFC3339: %w", err)
+		}
+		before = &t
+	}
+
+	out := []LockEntry{}
+	for _, e := range entries {
+		if owner != "" && e.Owner != owner {
+			continue
+		}
+		if reason != "" && !strings.Contains(strings.ToLower(e.Reason), reason) {
+			continue
+		}
+		if (kind == "file" && e.IsFolder) || (kind == "folder" && !e.IsFolder) {
+			continue
+		}
+		if before != nil && (e.ExpiresAt == nil || !e.ExpiresAt.Before(*before)) {
+			continue
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+func locksHandler(w http.ResponseWriter, r *http.Request) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	c := findComposite(r.URL.Query().Get("name"))
+	if c == nil {
+		http.Error(w, "No smart manager with that name", http.StatusBadRequest)
+		return
+	}
+	if releaseExpiredLocks(c, time.Now()) > 0 {
+		queueCompositeSave(c)
+	}
+
+	entries, err := filterLocks(listLocks(c), r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(entries); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
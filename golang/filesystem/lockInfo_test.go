@@ -0,0 +1,131 @@
+package filesystem
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func lockFolder() *Folder {
+	return &Folder{
+		Name: "locks",
+		Path: "/l",
+		Files: []*File{
+			{Name: "a.txt", Path: "/l/a.txt"},
+		},
+		Subfolders: []*Folder{
+			{
+				Name:  "legal",
+				Path:  "/l/legal",
+				Files: []*File{{Name: "contract.pdf", Path: "/l/legal/contract.pdf"}, {Name: "nda.pdf", Path: "/l/legal/nda.pdf"}},
+			},
+		},
+	}
+}
+
+func TestLockInfoFromRequest(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	info, err := lockInfoFromRequest(httptest.NewRequest("GET", "/lock?reason=legal+hold&owner=ana&duration=2h", nil), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Reason != "legal hold" || info.Owner != "ana" || !info.ExpiresAt.Equal(now.Add(2*time.Hour)) {
+		t.Fatalf("unexpected info %+v", info)
+	}
+
+	for _, q := range []string{"duration=soon", "duration=-1h", "expiresAt=tomorrow", "expiresAt=2020-01-01T00:00:00Z"} {
+		if _, err := lockInfoFromRequest(httptest.NewRequest("GET", "/lock?"+q, nil), now); err == nil {
+			t.Errorf("expected %s to be rejected", q)
+		}
+	}
+}
+
+func TestReleaseExpiredLocks_FolderAndNestedLocks(t *testing.T) {
+	c := lockFolder()
+	now := time.Now()
+	past := now.Add(-time.Minute)
+	future := now.Add(time.Hour)
+
+	lockPathWithInfo(c, "/l/legal", &LockInfo{Reason: "build", LockedAt: past.Add(-time.Hour), ExpiresAt: &past})
+	// a separate, still valid lock inside the expired folder lock
+	lockPathWithInfo(c, "/l/legal/nda.pdf", &LockInfo{Reason: "legal hold", LockedAt: now, ExpiresAt: &future})
+	lockPathWithInfo(c, "/l/a.txt", &LockInfo{Reason: "forever", LockedAt: now})
+
+	if n := releaseExpiredLocks(c, now); n != 2 {
+		t.Fatalf("expected folder and contract.pdf released, got %d", n)
+	}
+	legal := c.Subfolders[0]
+	if legal.Locked || legal.Files[0].Locked || legal.Files[0].LockInfo != nil {
+		t.Fatalf("expired folder lock not released")
+	}
+	if !legal.Files[1].Locked || !c.Files[0].Locked {
+		t.Fatalf("locks that have not expired must stay")
+	}
+}
+
+func TestListLocks_FoldersStandForTheirContent(t *testing.T) {
+	c := lockFolder()
+	now := time.Now()
+	lockPathWithInfo(c, "/l/legal", &LockInfo{Reason: "Legal hold", Owner: "ana", LockedAt: now})
+	lockPathWithInfo(c, "/l/a.txt", &LockInfo{Reason: "in use by build", Owner: "ci", LockedAt: now})
+
+	entries := listLocks(c)
+	if len(entries) != 2 || entries[0].Path != "/l/a.txt" || entries[1].Path != "/l/legal" || !entries[1].IsFolder {
+		t.Fatalf("expected a.txt and the legal folder, got %+v", entries)
+	}
+
+	filtered, err := filterLocks(entries, httptest.NewRequest("GET", "/locks?reason=legal", nil))
+	if err != nil || len(filtered) != 1 || filtered[0].Owner != "ana" {
+		t.Fatalf("reason filter failed: %+v %v", filtered, err)
+	}
+	filtered, _ = filterLocks(entries, httptest.NewRequest("GET", "/locks?type=file&owner=ci", nil))
+	if len(filtered) != 1 || filtered[0].Name != "a.txt" {
+		t.Fatalf("type/owner filter failed: %+v", filtered)
+	}
+}
+
+func TestLockInfo_PersistsAndShowsInLocksHandler(t *testing.T) {
+	chdirTemp(t)
+	orig := Composites
+	defer func() { Composites = orig }()
+	c := lockFolder()
+	Composites = []*Folder{c}
+
+	rr := httptest.NewRecorder()
+	lockHandler(rr, httptest.NewRequest("GET", "/lock?name=locks&path=/l/legal&reason=audit&owner=bo&duration=24h", nil))
+	if rr.Body.String() != "true" {
+		t.Fatalf("expected true, got %s", rr.Body.String())
+	}
+
+	stored := readStoredTree(t, "locks")
+	fresh := lockFolder()
+	mergeDirectoryTreeToComposite(fresh, &stored)
+	info := fresh.Subfolders[0].Files[0].LockInfo
+	if info == nil || info.Reason != "audit" || info.Owner != "bo" || info.ExpiresAt == nil {
+		t.Fatalf("lock info not restored: %+v", info)
+	}
+
+	rr = httptest.NewRecorder()
+	locksHandler(rr, httptest.NewRequest("GET", "/locks?name=locks", nil))
+	var entries []LockEntry
+	if err := json.NewDecoder(rr.Body).Decode(&entries); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Reason != "audit" {
+		t.Fatalf("unexpected listing %+v", entries)
+	}
+
+	rr = httptest.NewRecorder()
+	unlockHandler(rr, httptest.NewRequest("GET", "/unlock?name=locks&path=/l/legal", nil))
+	if c.Subfolders[0].LockInfo != nil || c.Subfolders[0].Files[0].LockInfo != nil {
+		t.Fatalf("unlock should clear lock details")
+	}
+
+	rr = httptest.NewRecorder()
+	lockHandler(rr, httptest.NewRequest("GET", "/lock?name=locks&path=/l/legal&duration=nope", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a bad duration, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,249 @@
+package filesystem
+
+// lock policies lock files by pattern instead of by path. they are evaluated on every
+// scan and rescan, so files that appear later under a policy are locked as well. a lock
+// set by a policy remembers the policy id and is released again once the policy is
+// removed or no longer matches. unlocking such a file by hand lasts until the next rescan.
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LockPolicy locks every file that matches all of its non-empty conditions.
+// PathGlob is relative to the manager root and supports "**", NameGlob is matched
+// against the file name only ("*.key").
+type LockPolicy struct {
+	ID       string `json:"id"`
+	PathGlob string `json:"pathGlob,omitempty"`
+	NameGlob string `json:"nameGlob,omitempty"`
+	Category string `json:"category,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+	Owner    string `json:"owner,omitempty"`
+}
+
+func (p *LockPolicy) validate() error {
+	p.PathGlob = strings.TrimSpace(p.PathGlob)
+	p.NameGlob = strings.TrimSpace(p.NameGlob)
+	if p.PathGlob == "" && p.NameGlob == "" && p.Category == "" {
+		return fmt.Errorf("policy has no conditions")
+	}
+	if p.PathGlob != "" && !validGlob(p.PathGlob) {
+		return fmt.Errorf("invalid path glob %q", p.PathGlob)
+	}
+	if p.NameGlob != "" {
+		if strings.Contains(p.NameGlob, "/") {
+			return fmt.Errorf("name glob %q must not contain a path", p.NameGlob)
+		}
+		if _, err := path.Match(p.NameGlob, ""); err != nil {
+			return fmt.Errorf("invalid name glob %q", p.NameGlob)
+		}
+	}
+	return nil
+}
+
+func (p *LockPolicy) matches(c *Folder, file *File) bool {
+	if p.Category != "" && !strings.EqualFold(GetCategory(file.Name), p.Category) {
+		return false
+	}
+	if p.PathGlob != "" && !matchGlob(p.PathGlob, relativeToComposite(c, file.Path)) {
+		return false
+	}
+	if p.NameGlob != "" {
+		if ok, _ := path.Match(p.NameGlob, file.Name); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *LockPolicy) lockInfo(now time.Time) *LockInfo {
+	reason := p.Reason
+	if reason == "" {
+		reason = "lock policy " + p.ID
+	}
+	return &LockInfo{Reason: reason, Owner: p.Owner, LockedAt: now.UTC(), Policy: p.ID}
+}
+
+// applyLockPolicies locks the unlocked files matching a policy and releases policy locks
+// that no policy covers any more. it returns the number of files that changed.
+func applyLockPolicies(c *Folder, now time.Time) int {
+	changed := 0
+	var walk func(f *Folder)
+	walk = func(f *Folder) {
+		for _, file := range f.Files {
+			var match *LockPolicy
+			for _, p := range c.LockPolicies {
+				if p.matches(c, file) {
+					match = p
+					break
+				}
+			}
+			policyLock := file.Locked && file.LockInfo != nil && file.LockInfo.Policy != ""
+			switch {
+			case match != nil && !file.Locked:
+				file.Lock()
+				file.LockInfo = match.lockInfo(now)
+				if c.WriteProtect {
+					file.protect()
+				}
+				changed++
+			case match == nil && policyLock && !f.Locked:
+				file.Unlock()
+				changed++
+			}
+		}
+		for _, sub := range f.Subfolders {
+			walk(sub)
+		}
+	}
+	walk(c)
+	return changed
+}
+
+// releasePolicyLocks unlocks what policy id locked, so an edited policy starts over
+func releasePolicyLocks(c *Folder, id string) {
+	var walk func(f *Folder)
+	walk = func(f *Folder) {
+		for _, file := range f.Files {
+			if file.Locked && file.LockInfo != nil && file.LockInfo.Policy == id {
+				file.Unlock()
+			}
+		}
+		for _, sub := range f.Subfolders {
+			walk(sub)
+		}
+	}
+	walk(c)
+}
+
+func findLockPolicy(c *Folder, id string) int {
+	for i, p := range c.LockPolicies {
+		if p.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// addLockPolicy validates p, gives it an id and appends it to the manager
+func addLockPolicy(c *Folder, p *LockPolicy) error {
+	if err := p.validate(); err != nil {
+		return err
+	}
+	highest := 0
+	for _, existing := range c.LockPolicies {
+		if n, err := strconv.Atoi(existing.ID); err == nil && n > highest {
+			highest = n
+		}
+	}
+	p.ID = strconv.Itoa(highest + 1)
+	c.LockPolicies = append(c.LockPolicies, p)
+	return nil
+}
+
+// updateLockPolicy replaces policy id, keeping the id
+func updateLockPolicy(c *Folder, id string, p *LockPolicy) error {
+	i := findLockPolicy(c, id)
+	if i < 0 {
+		return fmt.Errorf("no lock policy with id %q", id)
+	}
+	if err := p.validate(); err != nil {
+		return err
+	}
+	p.ID = id
+	c.LockPolicies[i] = p
+	releasePolicyLocks(c, id)
+	return nil
+}
+
+func removeLockPolicy(c *Folder, id string) bool {
+	i := findLockPolicy(c, id)
+	if i < 0 {
+		return false
+	}
+	c.LockPolicies = append(c.LockPolicies[:i], c.LockPolicies[i+1:]...)
+	releasePolicyLocks(c, id)
+	return true
+}
+
+func lockPoliciesHandler(w http.ResponseWriter, r *http.Request) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	c := findComposite(r.URL.Query().Get("name"))
+	if c == nil {
+		http.Error(w, "No smart manager with that name", http.StatusBadRequest)
+		return
+	}
+	policies := c.LockPolicies
+	if policies == nil {
+		policies = []*LockPolicy{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(policies); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// lockPolicyOperation decodes the policy body, runs op and applies the policies right away
+func lockPolicyOperation(w http.ResponseWriter, r *http.Request, op func(c *Folder, p *LockPolicy) error) {
+	var policy LockPolicy
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	c := findComposite(r.URL.Query().Get("name"))
+	if c == nil {
+		http.Error(w, "No smart manager with that name", http.StatusBadRequest)
+		return
+	}
+	if err := op(c, &policy); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	applyLockPolicies(c, time.Now())
+	queueCompositeSave(c)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(policy); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// addLockPolicyHandler takes the policy as json body
+func addLockPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	lockPolicyOperation(w, r, addLockPolicy)
+}
+
+// updateLockPolicyHandler replaces the policy ?id= with the json body
+func updateLockPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	lockPolicyOperation(w, r, func(c *Folder, p *LockPolicy) error {
+		return updateLockPolicy(c, id, p)
+	})
+}
+
+func removeLockPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	c := findComposite(r.URL.Query().Get("name"))
+	if c == nil || !removeLockPolicy(c, r.URL.Query().Get("id")) {
+		w.Write([]byte("false"))
+		return
+	}
+	// another policy may still cover what this one released
+	applyLockPolicies(c, time.Now())
+	queueCompositeSave(c)
+	w.Write([]byte("true"))
+}
@@ -0,0 +1,117 @@
+package filesystem
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func policyFolder() *Folder {
+	return &Folder{
+		Name: "vault",
+		Path: "/v",
+		Files: []*File{
+			{Name: "server.key", Path: "/v/server.key"},
+			{Name: "readme.md", Path: "/v/readme.md"},
+		},
+		Subfolders: []*Folder{
+			{
+				Name: "contracts",
+				Path: "/v/contracts",
+				Subfolders: []*Folder{
+					{Name: "signed", Path: "/v/contracts/signed", Files: []*File{{Name: "acme.pdf", Path: "/v/contracts/signed/acme.pdf"}}},
+					{Name: "drafts", Path: "/v/contracts/drafts", Files: []*File{{Name: "beta.pdf", Path: "/v/contracts/drafts/beta.pdf"}}},
+				},
+			},
+		},
+	}
+}
+
+func TestLockPolicy_Validate(t *testing.T) {
+	for _, p := range []LockPolicy{{}, {PathGlob: "a/[b"}, {NameGlob: "a/*.key"}, {NameGlob: "[x"}} {
+		if err := p.validate(); err == nil {
+			t.Errorf("expected %+v to be rejected", p)
+		}
+	}
+}
+
+func TestApplyLockPolicies_LocksNewFilesAndReleasesStale(t *testing.T) {
+	c := policyFolder()
+	addLockPolicy(c, &LockPolicy{PathGlob: "contracts/signed/**", Reason: "signed"})
+	addLockPolicy(c, &LockPolicy{NameGlob: "*.key", Owner: "ops"})
+
+	now := time.Now()
+	if n := applyLockPolicies(c, now); n != 2 {
+		t.Fatalf("expected acme.pdf and server.key locked, got %d", n)
+	}
+	key := c.Files[0]
+	if !key.Locked || key.LockInfo.Policy != "2" || key.LockInfo.Owner != "ops" || key.LockInfo.Reason != "lock policy 2" {
+		t.Fatalf("unexpected key lock %+v", key.LockInfo)
+	}
+	if c.Files[1].Locked || c.Subfolders[0].Subfolders[1].Files[0].Locked {
+		t.Fatalf("files outside the policies must stay unlocked")
+	}
+
+	// a file appearing on a later rescan
+	signed := c.Subfolders[0].Subfolders[0]
+	signed.Files = append(signed.Files, &File{Name: "new.pdf", Path: "/v/contracts/signed/new.pdf"})
+	if n := applyLockPolicies(c, now); n != 1 || !signed.Files[1].Locked {
+		t.Fatalf("new file under the policy should be locked")
+	}
+
+	// a manual lock is left alone when its policy goes away, a policy lock is released
+	c.Files[1].Lock()
+	c.Files[1].LockInfo = &LockInfo{Reason: "manual", LockedAt: now}
+	if !removeLockPolicy(c, "1") {
+		t.Fatal("policy 1 should exist")
+	}
+	if signed.Files[0].Locked || signed.Files[1].Locked {
+		t.Fatalf("locks of a removed policy must be released")
+	}
+	if applyLockPolicies(c, now); !c.Files[1].Locked || !key.Locked {
+		t.Fatalf("manual lock and the remaining policy must stay")
+	}
+}
+
+func TestLockPolicyHandlers_PersistAndUpdate(t *testing.T) {
+	chdirTemp(t)
+	orig := Composites
+	defer func() { Composites = orig }()
+	c := policyFolder()
+	Composites = []*Folder{c}
+
+	rr := httptest.NewRecorder()
+	addLockPolicyHandler(rr, httptest.NewRequest("POST", "/addLockPolicy?name=vault", strings.NewReader(`{"nameGlob":"*.pdf"}`)))
+	var added LockPolicy
+	if err := json.NewDecoder(rr.Body).Decode(&added); err != nil || added.ID != "1" {
+		t.Fatalf("unexpected add response %+v %v", added, err)
+	}
+	if !c.Subfolders[0].Subfolders[1].Files[0].Locked {
+		t.Fatalf("adding a policy should apply it right away")
+	}
+
+	rr = httptest.NewRecorder()
+	updateLockPolicyHandler(rr, httptest.NewRequest("POST", "/updateLockPolicy?name=vault&id=1", strings.NewReader(`{"pathGlob":"contracts/signed/*"}`)))
+	if rr.Code != 200 || c.Subfolders[0].Subfolders[1].Files[0].Locked || !c.Subfolders[0].Subfolders[0].Files[0].Locked {
+		t.Fatalf("update should move the lock from drafts to signed, got %d", rr.Code)
+	}
+
+	saveCompositeDetails(c)
+	stored := readStoredTree(t, "vault")
+	fresh := policyFolder()
+	mergeDirectoryTreeToComposite(fresh, &stored)
+	if len(fresh.LockPolicies) != 1 || fresh.LockPolicies[0].PathGlob != "contracts/signed/*" {
+		t.Fatalf("policies not restored: %+v", fresh.LockPolicies)
+	}
+	if lock := fresh.Subfolders[0].Subfolders[0].Files[0].LockInfo; lock == nil || lock.Policy != "1" {
+		t.Fatalf("policy lock not restored: %+v", lock)
+	}
+
+	rr = httptest.NewRecorder()
+	updateLockPolicyHandler(rr, httptest.NewRequest("POST", "/updateLockPolicy?name=vault&id=9", strings.NewReader(`{"nameGlob":"*"}`)))
+	if rr.Code != 400 {
+		t.Fatalf("expected 400 for an unknown policy, got %d", rr.Code)
+	}
+}
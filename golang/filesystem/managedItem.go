@@ -2,6 +2,7 @@ package filesystem
 
 import (
 	"fmt"
+	"os"
 	"strings"
 	"time"
 
@@ -22,7 +23,25 @@ type File struct {
 	Metadata []*MetadataEntry
 	Tags     []string
 	Locked   bool // Lock status for file
-	Keywords []*pb.Keyword
+	LockInfo *LockInfo
+	// mode before write protection, nil when the file is not write protected
+	OriginalMode *os.FileMode
+	Keywords     []*pb.Keyword
+	// Identity is device:inode, ContentHash is only filled for tagged/locked files
+	Identity    string
+	ContentHash string
+	// size and modification time (unix nanoseconds) seen by the scan, ContentHash belongs to them
+	Size    int64
+	ModTime int64
+	// path of the attached .xmp sidecar, if any
+	Sidecar string
+	// tags auto-tagging rules added, a rule never adds one of them again
+	RuleTags []string
+	// last user.xdg.tags / dc:subject value read from or written to disk
+	xattrTags    string
+	xattrKnown   bool
+	sidecarTags  string
+	sidecarKnown bool
 }
 
 // Folder represents a directory in the filesystem
@@ -32,25 +51,75 @@ type Folder struct {
 	NewPath      string
 	CreationDate time.Time
 	Locked       bool // Lock status for folder
+	LockInfo     *LockInfo
+	OriginalMode *os.FileMode
 	HasKeywords  bool
 	Files        []*File
 	Subfolders   []*Folder
 	Tags         []string
+	// subset of Tags that also apply to every file beneath the folder
+	InheritTags []string
+	// only used on the root folder of a smart manager
+	TagDefinitions []*TagDefinition
+	TagRules       []*TagRule
+	XattrSync      *TagSyncSettings
+	XmpSync        *TagSyncSettings
+	LockPolicies   []*LockPolicy
+	SmartFolders   []*SmartFolder
+	WriteProtect   bool
+
+	// folder above, nil on the root folder of a smart manager
+	parent *Folder
+	// trigram index over the file names below a manager root, see nameIndex.go
+	nameIndex *nameIndex
+	// content index, loaded on first use, see fullTextIndex.go
+	textIndex *textIndex
+	// BM25 keyword index, built on first use, see keywordIndex.go
+	keywordIndex *keywordIndex
 }
 
 // -------------------- Folder Methods --------------------
 
+// managerRoot returns the root folder of the smart manager f belongs to, the
+// search indexes live there
+func (f *Folder) managerRoot() *Folder {
+	for f.parent != nil {
+		f = f.parent
+	}
+	return f
+}
+
 // AddFile adds a file to the folder
 func (f *Folder) AddFile(file *File) {
 	f.Files = append(f.Files, file)
+	root := f.managerRoot()
+	dropKeywordIndex(root)
+	if root.nameIndex != nil {
+		root.nameIndex.add(file)
+	}
 }
 
 // AddSubfolder adds a subfolder to the folder
 func (f *Folder) AddSubfolder(folder *Folder) {
+	folder.parent = f
 	f.Subfolders = append(f.Subfolders, folder)
+	root := f.managerRoot()
+	dropKeywordIndex(root)
+	if root.nameIndex != nil {
+		root.nameIndex.addTree(folder)
+	}
 }
 
 func (f *Folder) RemoveFile(filePath string) error {
+	root := f.managerRoot()
+	dropKeywordIndex(root)
+	if root.nameIndex != nil {
+		return root.nameIndex.removing(f.GetFile(filePath), f.removeFile(filePath))
+	}
+	return f.removeFile(filePath)
+}
+
+func (f *Folder) removeFile(filePath string) error {
 	if f.Locked {
 		return fmt.Errorf("cannot remove file: folder '%s' is locked", f.Name)
 	}
@@ -65,7 +134,7 @@ func (f *Folder) RemoveFile(filePath string) error {
 	}
 
 	for _, subfolder := range f.Subfolders {
-		if err := subfolder.RemoveFile(filePath); err == nil {
+		if err := subfolder.removeFile(filePath); err == nil {
 			return nil
 		}
 	}
@@ -74,6 +143,15 @@ func (f *Folder) RemoveFile(filePath string) error {
 }
 
 func (f *Folder) RemoveFileOrderPreserving(filePath string) error {
+	root := f.managerRoot()
+	dropKeywordIndex(root)
+	if root.nameIndex != nil {
+		return root.nameIndex.removing(f.GetFile(filePath), f.removeFileOrderPreserving(filePath))
+	}
+	return f.removeFileOrderPreserving(filePath)
+}
+
+func (f *Folder) removeFileOrderPreserving(filePath string) error {
 
 	for i, file := range f.Files {
 		if file.Path == filePath {
@@ -86,7 +164,7 @@ func (f *Folder) RemoveFileOrderPreserving(filePath string) error {
 	}
 
 	for _, subfolder := range f.Subfolders {
-		if err := subfolder.RemoveFileOrderPreserving(filePath); err == nil {
+		if err := subfolder.removeFileOrderPreserving(filePath); err == nil {
 			return nil
 		}
 	}
@@ -95,6 +173,15 @@ func (f *Folder) RemoveFileOrderPreserving(filePath string) error {
 }
 
 func (f *Folder) RemoveSubfolder(folderPath string) error {
+	root := f.managerRoot()
+	dropKeywordIndex(root)
+	if root.nameIndex != nil {
+		return root.nameIndex.removingTree(f.GetSubfolder(folderPath), f.removeSubfolder(folderPath))
+	}
+	return f.removeSubfolder(folderPath)
+}
+
+func (f *Folder) removeSubfolder(folderPath string) error {
 
 	for i, subfolder := range f.Subfolders {
 		if subfolder.Path == folderPath {
@@ -107,7 +194,7 @@ func (f *Folder) RemoveSubfolder(folderPath string) error {
 	}
 
 	for _, subfolder := range f.Subfolders {
-		if err := subfolder.RemoveSubfolder(folderPath); err == nil {
+		if err := subfolder.removeSubfolder(folderPath); err == nil {
 			return nil
 		}
 	}
@@ -177,11 +264,17 @@ func (f *Folder) LockByPath(path string) {
 	checkFile := f.GetFile(path)
 	if checkFile != nil {
 		checkFile.Lock()
+		if f.WriteProtect {
+			checkFile.protect()
+		}
 		return
 	}
 	checkFolder := f.GetSubfolder(path)
 	if checkFolder != nil {
 		checkFolder.lockRecursive()
+		if f.WriteProtect {
+			protectTree(checkFolder)
+		}
 		return
 	}
 }
@@ -214,18 +307,21 @@ func (f *Folder) UnlockByPath(path string) {
 // unlockRecursive unlocks this folder and all nested folders and files
 func (f *Folder) unlockRecursive() {
 	f.Locked = false
+	f.LockInfo = nil
+	f.restoreMode()
 	for _, sf := range f.Subfolders {
 		sf.unlockRecursive()
 	}
 	for _, file := range f.Files {
-		file.Locked = false
+		file.Unlock()
 	}
 }
 
 // AddTagToFile tags a file in this folder or its subfolders
 func (f *Folder) AddTagToFile(filePath, tagName string) bool {
 	file := f.GetFile(filePath)
-	if file != nil {
+	tagName = normalizeTag(tagName)
+	if file != nil && tagName != "" {
 		for _, tag := range file.Tags {
 			if tag == tagName {
 				return false // Tag already exists
@@ -238,8 +334,27 @@ func (f *Folder) AddTagToFile(filePath, tagName string) bool {
 }
 
 // AddTagToSelf adds a tag to the folder itself
-func (f *Folder) AddTagToSelf(tagID, tagName string) {
+func (f *Folder) AddTagToSelf(tagID, tagName string) bool {
+	tagName = normalizeTag(tagName)
+	if tagName == "" {
+		return false
+	}
+	for _, tag := range f.Tags {
+		if tag == tagName {
+			return false // Tag already exists
+		}
+	}
 	f.Tags = append(f.Tags, tagName)
+	return true
+}
+
+// SetTagInheritance marks one of the folder's tags as (not) applying to the files beneath it
+func (f *Folder) SetTagInheritance(tagName string, inherit bool) {
+	tagName = normalizeTag(tagName)
+	f.InheritTags = removeString(f.InheritTags, tagName)
+	if inherit {
+		f.InheritTags = append(f.InheritTags, tagName)
+	}
 }
 
 // RemoveTag removes a tag from this folder
@@ -247,12 +362,23 @@ func (f *Folder) RemoveTag(tag string) bool {
 	for i, t := range f.Tags {
 		if t == tag {
 			f.Tags = append(f.Tags[:i], f.Tags[i+1:]...)
+			f.InheritTags = removeString(f.InheritTags, tag)
 			return true
 		}
 	}
 	return false
 }
 
+func removeString(list []string, s string) []string {
+	out := list[:0]
+	for _, v := range list {
+		if v != s {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
 // Display prints the folder tree with lock status and tags
 func (f *Folder) Display(indent int) {
 	prefix := strings.Repeat("  ", indent)
@@ -280,6 +406,8 @@ func (f *File) Lock() {
 // Unlock unlocks this file
 func (f *File) Unlock() {
 	f.Locked = false
+	f.LockInfo = nil
+	f.restoreMode()
 }
 
 // RemoveTag removes a tag from this file
@@ -8,6 +8,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 var root string
@@ -22,6 +23,16 @@ func moveDirectoryHandler(w http.ResponseWriter, r *http.Request) {
 		// fmt.Printf("Checking manager: %s\n", item.Name)
 		if item.Name == compositeName {
 			// fmt.Printf("found manager: %s\n", item.Name)
+			// items a user or a lock policy locked stay where they are, force=true moves them too
+			if releaseExpiredLocks(item, time.Now()) > 0 {
+				queueCompositeSave(item)
+			}
+			if !forceRequested(r) {
+				if held := holdLockedItems(item, item.Locked && item.LockInfo != nil); held > 0 {
+					log.Printf("move: leaving %d locked item(s) in place", held)
+				}
+			}
+			snapshotBefore("move")
 			CreateDirectoryStructure(item)
 			moveContent(item)
 
@@ -88,10 +99,11 @@ func moveContent(item *Folder) {
 		panic(err)
 	}
 
-	moveContentRecursive(item)
+	held := moveContentRecursive(item)
 
 	item.Path = filepath.Join(root, item.Name)
-	if originalPath != item.Path {
+	// the old directory still holds the items that stayed
+	if originalPath != item.Path && held == 0 {
 		os.RemoveAll(originalPath)
 	}
 
@@ -128,12 +140,40 @@ func moveContent(item *Folder) {
 	}
 }
 
-func moveContentRecursive(item *Folder) {
+// holdLockedItems clears the new path of every item a user or a lock policy locked, so
+// the move leaves it where it is. automatic locks of hidden and ~ files carry no lock
+// details and move along. returns the number of items held.
+func holdLockedItems(f *Folder, parentHeld bool) int {
+	held := 0
+	for _, file := range f.Files {
+		if parentHeld || (file.Locked && file.LockInfo != nil) {
+			file.NewPath = ""
+			held++
+		}
+	}
+	for _, sub := range f.Subfolders {
+		subHeld := parentHeld || (sub.Locked && sub.LockInfo != nil)
+		if subHeld {
+			sub.NewPath = ""
+		}
+		held += holdLockedItems(sub, subHeld)
+	}
+	return held
+}
+
+// moveContentRecursive moves the files to their new paths, items without a new path stay.
+// returns the number of files that stayed.
+func moveContentRecursive(item *Folder) int {
 	if item == nil {
-		return
+		return 0
 	}
 
+	stayed := 0
 	for _, file := range item.Files {
+		if file.NewPath == "" {
+			stayed++
+			continue
+		}
 		sourcePath := file.Path
 		targetPath := filepath.Join(root, file.NewPath)
 
@@ -146,13 +186,25 @@ func moveContentRecursive(item *Folder) {
 			log.Printf("Error moving file %s to %s: %v", sourcePath, finalTargetPath, err)
 		} else {
 			file.Path = finalTargetPath
+			// the sidecar travels with its file
+			if file.Sidecar != "" {
+				sidecarTarget := sidecarMovedWith(file.Sidecar, sourcePath, finalTargetPath)
+				if err := os.Rename(file.Sidecar, sidecarTarget); err != nil {
+					log.Printf("Error moving sidecar %s to %s: %v", file.Sidecar, sidecarTarget, err)
+				} else {
+					file.Sidecar = sidecarTarget
+				}
+			}
 		}
 	}
 
 	for _, subfolder := range item.Subfolders {
-		subfolder.Path = filepath.Join(root, subfolder.NewPath)
-		moveContentRecursive(subfolder)
+		if subfolder.NewPath != "" {
+			subfolder.Path = filepath.Join(root, subfolder.NewPath)
+		}
+		stayed += moveContentRecursive(subfolder)
 	}
+	return stayed
 }
 
 func generateUniqueFilePath(targetPath string) string {
@@ -198,6 +250,10 @@ func CreateDirectoryStructureRecursive(item *Folder) {
 		return
 	}
 	for _, subfolder := range item.Subfolders {
+		// a folder without a new path stays where it is
+		if subfolder.NewPath == "" {
+			continue
+		}
 		subfolder.Path = filepath.Join(root, subfolder.NewPath)
 		CreateDirectoryStructureRecursive(subfolder)
 	}
@@ -219,10 +275,17 @@ func UpdateStoredPathsFromComposite(comp *Folder) error {
 	}
 
 	newStructure := DirectoryTreeJson{
-		Name:     comp.Name,
-		IsFolder: true,
-		RootPath: comp.Path,
-		Children: buildNodesWithPreservedMetadata(comp, &oldStructure),
+		Name:         comp.Name,
+		IsFolder:     true,
+		RootPath:     comp.Path,
+		Children:     buildNodesWithPreservedMetadata(comp, &oldStructure),
+		TagRegistry:  comp.TagDefinitions,
+		TagRules:     comp.TagRules,
+		XattrSync:    comp.XattrSync,
+		XmpSync:      comp.XmpSync,
+		LockPolicies: comp.LockPolicies,
+		SmartFolders: comp.SmartFolders,
+		WriteProtect: comp.WriteProtect,
 	}
 
 	return saveCompositeDetailsToFile(newStructure)
@@ -236,12 +299,21 @@ func buildNodesWithPreservedMetadata(folder *Folder, oldStructure *DirectoryTree
 
 	for _, file := range folder.Files {
 		node := FileNode{
-			Name:     file.Name,
-			Path:     file.Path,
-			IsFolder: false,
-			Keywords: file.Keywords,
-			Tags:     file.Tags,
-			Locked:   file.Locked,
+			Name:         file.Name,
+			Path:         file.Path,
+			IsFolder:     false,
+			Keywords:     file.Keywords,
+			Tags:         file.Tags,
+			Locked:       file.Locked,
+			Lock:         file.LockInfo,
+			OriginalMode: file.OriginalMode,
+			Identity:     file.Identity,
+			RuleTags:     file.RuleTags,
+		}
+		// a move keeps size and modification time, the stamp of the scan still holds
+		if storedNodeHasMetadata(node) {
+			stamp := stampOf(file, nil)
+			node.Size, node.ModTime, node.ContentHash = stamp.size, stamp.modTime, stamp.hash
 		}
 
 		if oldNode, exists := findNodeByName(oldPathMap, file.Name, false); exists {
@@ -251,8 +323,13 @@ func buildNodesWithPreservedMetadata(folder *Folder, oldStructure *DirectoryTree
 			if len(node.Tags) == 0 {
 				node.Tags = oldNode.Tags
 			}
+			if len(node.RuleTags) == 0 {
+				node.RuleTags = oldNode.RuleTags
+			}
 			if !node.Locked {
 				node.Locked = oldNode.Locked
+				node.Lock = oldNode.Lock
+				node.OriginalMode = oldNode.OriginalMode
 			}
 		}
 
@@ -263,20 +340,26 @@ func buildNodesWithPreservedMetadata(folder *Folder, oldStructure *DirectoryTree
 		childNodes := buildNodesWithPreservedMetadata(sub, oldStructure)
 
 		node := FileNode{
-			Name:     sub.Name,
-			Path:     sub.Path,
-			IsFolder: true,
-			Tags:     sub.Tags,
-			Children: childNodes,
-			Locked:   sub.Locked,
+			Name:         sub.Name,
+			Path:         sub.Path,
+			IsFolder:     true,
+			Tags:         sub.Tags,
+			InheritTags:  sub.InheritTags,
+			Children:     childNodes,
+			Locked:       sub.Locked,
+			Lock:         sub.LockInfo,
+			OriginalMode: sub.OriginalMode,
 		}
 
 		if oldNode, exists := findNodeByName(oldPathMap, sub.Name, true); exists {
 			if len(node.Tags) == 0 {
 				node.Tags = oldNode.Tags
+				node.InheritTags = oldNode.InheritTags
 			}
 			if !node.Locked {
 				node.Locked = oldNode.Locked
+				node.Lock = oldNode.Lock
+				node.OriginalMode = oldNode.OriginalMode
 			}
 		}
 
@@ -196,6 +196,60 @@ func TestMoveContentRecursive(t *testing.T) {
 	}
 }
 
+func TestMoveContent_LeavesUserLockedItemsInPlace(t *testing.T) {
+	tempDir := t.TempDir()
+	root = tempDir
+
+	write := func(rel string) string {
+		p := filepath.Join(tempDir, rel)
+		os.MkdirAll(filepath.Dir(p), 0755)
+		os.WriteFile(p, []byte(rel), 0644)
+		return p
+	}
+	dsStore := write("src/.DS_Store")
+	plain := write("src/plain.txt")
+	kept := write("src/kept.txt")
+	inLocked := write("src/archive/old.txt")
+
+	c, err := ConvertToObject("src", filepath.Join(tempDir, "src"))
+	if err != nil {
+		t.Fatalf("ConvertToObject: %v", err)
+	}
+	if !c.GetFile(dsStore).Locked {
+		t.Fatalf("hidden file should be locked automatically")
+	}
+	lockPathWithInfo(c, kept, &LockInfo{Reason: "contract"})
+	lockPathWithInfo(c, filepath.Join(tempDir, "src", "archive"), &LockInfo{Reason: "archive"})
+	for _, f := range []string{dsStore, plain, kept} {
+		c.GetFile(f).NewPath = filepath.Join("sorted", filepath.Base(f))
+	}
+	archive := c.GetSubfolder(filepath.Join(tempDir, "src", "archive"))
+	archive.NewPath = "sorted/archive"
+	archive.Files[0].NewPath = "sorted/archive/old.txt"
+
+	if held := holdLockedItems(c, false); held != 2 {
+		t.Fatalf("expected the user-locked file and the file of the locked folder to be held, got %d", held)
+	}
+	CreateDirectoryStructureRecursive(c)
+	if stayed := moveContentRecursive(c); stayed != 2 {
+		t.Fatalf("expected 2 files to stay, got %d", stayed)
+	}
+
+	for _, f := range []string{"sorted/.DS_Store", "sorted/plain.txt"} {
+		if _, err := os.Stat(filepath.Join(tempDir, f)); err != nil {
+			t.Errorf("%s should have been moved: %v", f, err)
+		}
+	}
+	for _, f := range []string{kept, inLocked} {
+		if _, err := os.Stat(f); err != nil {
+			t.Errorf("%s should have stayed: %v", f, err)
+		}
+	}
+	if archive.Path != filepath.Join(tempDir, "src", "archive") || archive.Files[0].Path != inLocked {
+		t.Errorf("locked folder should keep its paths, got %s and %s", archive.Path, archive.Files[0].Path)
+	}
+}
+
 func TestMoveContentRecursive_NilFolder(t *testing.T) {
 	moveContentRecursive(nil)
 }
@@ -0,0 +1,193 @@
+package filesystem
+
+// the name index keeps a trigram posting list per manager so /search only scores files
+// that share at least one trigram with the search text instead of every file in the
+// tree. names are padded at the start, so a one or two letter search (which has to be
+// a prefix anyway) finds its candidates through the padded grams. the index lives on
+// the root folder, is built by ConvertToObject and follows the add and remove methods
+// of every folder below it, which reach the root through their parent. removed files
+// leave a hole that is compacted away once holes make up a quarter of the index.
+
+import (
+	"sync"
+)
+
+// nameGram packs three runes (21 bits each) into one map key
+type nameGram uint64
+
+const gramPad rune = 0
+
+type nameIndex struct {
+	mu      sync.RWMutex
+	files   []*File
+	ids     map[*File]int32
+	grams   map[nameGram][]int32
+	removed int
+}
+
+func newNameIndex() *nameIndex {
+	return &nameIndex{
+		ids:   make(map[*File]int32),
+		grams: make(map[nameGram][]int32),
+	}
+}
+
+// buildNameIndex indexes every file below root
+func buildNameIndex(root *Folder) *nameIndex {
+	idx := newNameIndex()
+	idx.addTree(root)
+	return idx
+}
+
+// nameGrams returns the distinct trigrams of the folded text, padded at the start
+func nameGrams(text string) []nameGram {
+	runes := []rune{gramPad, gramPad}
+	runes = append(runes, []rune(foldText(text))...)
+	seen := make(map[nameGram]struct{}, len(runes))
+	grams := make([]nameGram, 0, len(runes))
+	for i := 0; i+2 < len(runes); i++ {
+		g := nameGram(runes[i])<<42 | nameGram(runes[i+1])<<21 | nameGram(runes[i+2])
+		if _, ok := seen[g]; !ok {
+			seen[g] = struct{}{}
+			grams = append(grams, g)
+		}
+	}
+	return grams
+}
+
+func (idx *nameIndex) addLocked(file *File) {
+	if _, ok := idx.ids[file]; ok {
+		return
+	}
+	id := int32(len(idx.files))
+	idx.files = append(idx.files, file)
+	idx.ids[file] = id
+	for _, g := range nameGrams(file.Name) {
+		idx.grams[g] = append(idx.grams[g], id)
+	}
+}
+
+func (idx *nameIndex) add(file *File) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.addLocked(file)
+}
+
+func (idx *nameIndex) addTree(folder *Folder) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	var walk func(f *Folder)
+	walk = func(f *Folder) {
+		for _, file := range f.Files {
+			idx.addLocked(file)
+		}
+		for _, sub := range f.Subfolders {
+			walk(sub)
+		}
+	}
+	walk(folder)
+}
+
+func (idx *nameIndex) removeLocked(file *File) {
+	id, ok := idx.ids[file]
+	if !ok {
+		return
+	}
+	delete(idx.ids, file)
+	idx.files[id] = nil
+	idx.removed++
+}
+
+func (idx *nameIndex) remove(file *File) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.removeLocked(file)
+	idx.compactLocked()
+}
+
+func (idx *nameIndex) removeTree(folder *Folder) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	var walk func(f *Folder)
+	walk = func(f *Folder) {
+		for _, file := range f.Files {
+			idx.removeLocked(file)
+		}
+		for _, sub := range f.Subfolders {
+			walk(sub)
+		}
+	}
+	walk(folder)
+	idx.compactLocked()
+}
+
+// compactLocked rebuilds the posting lists once removed files make up a quarter of them
+func (idx *nameIndex) compactLocked() {
+	if idx.removed == 0 || idx.removed*4 < len(idx.files) {
+		return
+	}
+	files := idx.files
+	idx.files = nil
+	idx.ids = make(map[*File]int32, len(files)-idx.removed)
+	idx.grams = make(map[nameGram][]int32)
+	idx.removed = 0
+	for _, file := range files {
+		if file != nil {
+			idx.addLocked(file)
+		}
+	}
+}
+
+// candidates returns the files sharing at least one trigram with text
+func (idx *nameIndex) candidates(text string) []*File {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	marked := make([]uint64, len(idx.files)/64+1)
+	var found []*File
+	for _, g := range nameGrams(text) {
+		for _, id := range idx.grams[g] {
+			word, bit := id/64, uint64(1)<<(id%64)
+			if marked[word]&bit != 0 {
+				continue
+			}
+			marked[word] |= bit
+			if file := idx.files[id]; file != nil {
+				found = append(found, file)
+			}
+		}
+	}
+	return found
+}
+
+// removing drops what a remove method took out of the tree, passing err on
+func (idx *nameIndex) removing(file *File, err error) error {
+	if err == nil && file != nil {
+		idx.remove(file)
+	}
+	return err
+}
+
+func (idx *nameIndex) removingTree(folder *Folder, err error) error {
+	if err == nil && folder != nil {
+		idx.removeTree(folder)
+	}
+	return err
+}
+
+// indexedMatches scores the shortlisted files like exploreFolder does and sends the
+// matches to c, it stops once run is stopped
+func indexedMatches(run *searchRun, idx *nameIndex, text string, filter func(*File) bool, c chan<- rankedFile) {
+	for _, file := range idx.candidates(text) {
+		if filter != nil && !filter(file) {
+			continue
+		}
+		if dist, ok := fuzzyNameMatch(text, file.Name); ok {
+			select {
+			case c <- rankedFile{file: file, distance: dist}:
+			case <-run.done():
+				return
+			}
+		}
+	}
+}
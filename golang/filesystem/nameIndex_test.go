@@ -0,0 +1,230 @@
+package filesystem
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+)
+
+var corpusWords = []string{"annual", "report", "invoice", "budget", "holiday", "photo", "contract", "draft", "notes", "meeting", "summary", "scan", "receipt", "plan", "résumé"}
+var corpusSyllables = []string{"ka", "lo", "mi", "ran", "tes", "vo", "bel", "qui", "dor", "sa", "fen", "ju", "pra", "ne", "wil", "ox", "gra", "tu", "zem", "hi"}
+var corpusExts = []string{".pdf", ".docx", ".txt", ".jpg", ".xlsx", ".md"}
+
+// nameCorpus builds a manager with files spread over folders of folders, folders
+// holds how many folders each level gets. most names mix real and made up words,
+// every 50th is a short name so misspelt searches have something to find.
+func nameCorpus(files int, folders int, seed int64) *Folder {
+	rng := rand.New(rand.NewSource(seed))
+	root := &Folder{Name: "corpus", Path: "/corpus"}
+	var leaves []*Folder
+	for i := 0; i < folders; i++ {
+		top := &Folder{Name: fmt.Sprintf("f%d", i), Path: fmt.Sprintf("/corpus/f%d", i)}
+		root.Subfolders = append(root.Subfolders, top)
+		for j := 0; j < folders; j++ {
+			leaf := &Folder{Name: fmt.Sprintf("g%d", j), Path: fmt.Sprintf("%s/g%d", top.Path, j)}
+			top.Subfolders = append(top.Subfolders, leaf)
+			leaves = append(leaves, leaf)
+		}
+	}
+	word := func() string {
+		if rng.Intn(4) == 0 {
+			return corpusWords[rng.Intn(len(corpusWords))]
+		}
+		w := ""
+		for n := 2 + rng.Intn(2); n > 0; n-- {
+			w += corpusSyllables[rng.Intn(len(corpusSyllables))]
+		}
+		return w
+	}
+	ext := func() string { return corpusExts[rng.Intn(len(corpusExts))] }
+	for i := 0; i < files; i++ {
+		name := fmt.Sprintf("%s_%s_%d%s", word(), word(), rng.Intn(3000), ext())
+		if i%50 == 0 {
+			name = corpusWords[rng.Intn(len(corpusWords))] + ext()
+		}
+		leaf := leaves[i%len(leaves)]
+		leaf.Files = append(leaf.Files, &File{Name: name, Path: fmt.Sprintf("%s/%d/%s", leaf.Path, i, name)})
+	}
+	return root
+}
+
+func matchedPaths(c *Folder, text string) []string {
+	var paths []string
+	for _, rf := range getMatches(nil, text, c, nil).rankedFiles {
+		paths = append(paths, rf.file.Path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// the index only gives up names that share no trigram with the search, like photo.xlsx
+// for "reprot", which the full scan still lets through on edit distance alone
+func TestNameIndex_SameHitsAsFullScan(t *testing.T) {
+	c := nameCorpus(3000, 4, 1)
+	queries := []string{"report", "reprot", "invoce", "anual_report", "budget_plan", "holidy", "summary_notes", "resume", "résumé", "r", "in", "PHOTO", "contract.pdf", "zzzz", "scan_1", "ranbel", "kalomi_tes"}
+
+	full := make(map[string][]string)
+	for _, q := range queries {
+		full[q] = matchedPaths(c, q)
+	}
+	c.nameIndex = buildNameIndex(c)
+	for _, q := range queries {
+		found := make(map[string]bool)
+		for _, p := range matchedPaths(c, q) {
+			found[p] = true
+		}
+		for _, p := range full[q] {
+			if found[p] {
+				delete(found, p)
+			} else if sharesGram(q, filepath.Base(p)) {
+				t.Errorf("%q: indexed search missed %s", q, p)
+			}
+		}
+		for p := range found {
+			t.Errorf("%q: indexed search found %s the full scan did not", q, p)
+		}
+	}
+}
+
+func sharesGram(text, name string) bool {
+	grams := make(map[nameGram]bool)
+	for _, g := range nameGrams(name) {
+		grams[g] = true
+	}
+	for _, g := range nameGrams(text) {
+		if grams[g] {
+			return true
+		}
+	}
+	return false
+}
+
+func TestNameIndex_FollowsTreeChanges(t *testing.T) {
+	c := &Folder{Name: "idx", Path: "/idx"}
+	sub := &Folder{Name: "sub", Path: "/idx/sub"}
+	sub.Files = []*File{{Name: "invoice_march.pdf", Path: "/idx/sub/invoice_march.pdf"}}
+	c.Files = []*File{{Name: "invoice_april.pdf", Path: "/idx/invoice_april.pdf"}}
+	c.Subfolders = []*Folder{sub}
+	c.nameIndex = buildNameIndex(c)
+
+	c.AddFile(&File{Name: "invoice_may.pdf", Path: "/idx/invoice_may.pdf"})
+	c.AddSubfolder(&Folder{Name: "more", Path: "/idx/more", Files: []*File{{Name: "invoice_june.pdf", Path: "/idx/more/invoice_june.pdf"}}})
+	if got := matchedPaths(c, "invoice"); len(got) != 4 {
+		t.Fatalf("added files should be searchable, got %v", got)
+	}
+
+	if err := c.RemoveFile("/idx/invoice_april.pdf"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RemoveFileOrderPreserving("/idx/sub/invoice_march.pdf"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RemoveSubfolder("/idx/more"); err != nil {
+		t.Fatal(err)
+	}
+	if got := matchedPaths(c, "invoice"); len(got) != 1 || got[0] != "/idx/invoice_may.pdf" {
+		t.Fatalf("removed files should be gone from the index, got %v", got)
+	}
+	if len(c.nameIndex.files) != 1 || c.nameIndex.removed != 0 {
+		t.Fatalf("expected the index to compact, %d entries %d removed", len(c.nameIndex.files), c.nameIndex.removed)
+	}
+}
+
+func TestNameIndex_FollowsSubfolderChanges(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "sub", "deep"), 0755)
+	os.WriteFile(filepath.Join(root, "sub", "deep", "invoice_march.pdf"), []byte("i"), 0644)
+	c, err := ConvertToObject("nested", root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deep := c.GetSubfolder(filepath.Join(root, "sub", "deep"))
+	keywordIndexFor(c)
+
+	added := filepath.Join(root, "sub", "deep", "invoice_may.pdf")
+	deep.AddFile(&File{Name: "invoice_may.pdf", Path: added})
+	deep.AddSubfolder(&Folder{Name: "more", Path: filepath.Join(root, "sub", "deep", "more"), Files: []*File{{Name: "invoice_june.pdf", Path: filepath.Join(root, "sub", "deep", "more", "invoice_june.pdf")}}})
+	if got := matchedPaths(c, "invoice"); len(got) != 3 {
+		t.Fatalf("files added to a subfolder should be searchable, got %v", got)
+	}
+	if c.keywordIndex != nil {
+		t.Fatalf("a change in a subfolder should drop the keyword index of the manager")
+	}
+
+	keywordIndexFor(c)
+	if err := deep.RemoveFile(added); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.GetSubfolder(filepath.Join(root, "sub")).RemoveSubfolder(filepath.Join(root, "sub", "deep", "more")); err != nil {
+		t.Fatal(err)
+	}
+	if got := matchedPaths(c, "invoice"); len(got) != 1 {
+		t.Fatalf("files removed from a subfolder should be gone from the index, got %v", got)
+	}
+	if c.keywordIndex != nil {
+		t.Fatalf("a removal in a subfolder should drop the keyword index of the manager")
+	}
+}
+
+func TestConvertToObject_BuildsNameIndex(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "sub"), 0755)
+	os.WriteFile(filepath.Join(root, "invoice.pdf"), []byte("i"), 0644)
+	os.WriteFile(filepath.Join(root, "sub", "notes.txt"), []byte("n"), 0644)
+	c, err := ConvertToObject("indexed", root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.nameIndex == nil || len(c.nameIndex.ids) != 2 {
+		t.Fatalf("expected every scanned file indexed")
+	}
+	if got := matchedPaths(c, "invoce"); len(got) != 1 {
+		t.Fatalf("expected invoice.pdf, got %v", got)
+	}
+}
+
+var (
+	millionOnce sync.Once
+	million     *Folder
+)
+
+// millionFiles is shared between the benchmarks, building it takes a few seconds
+func millionFiles(b *testing.B) *Folder {
+	if testing.Short() {
+		b.Skip("the million file tree is skipped in -short mode")
+	}
+	millionOnce.Do(func() {
+		million = nameCorpus(1_000_000, 32, 7)
+		million.nameIndex = buildNameIndex(million)
+	})
+	return million
+}
+
+func BenchmarkSearch_MillionFiles_Indexed(b *testing.B) {
+	c := millionFiles(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		getMatches(nil, "holidy", c, nil)
+	}
+}
+
+func BenchmarkSearch_MillionFiles_FullScan(b *testing.B) {
+	c := millionFiles(b)
+	scan := &Folder{Name: c.Name, Path: c.Path, Subfolders: c.Subfolders}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		getMatches(nil, "holidy", scan, nil)
+	}
+}
+
+func BenchmarkBuildNameIndex_MillionFiles(b *testing.B) {
+	c := millionFiles(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buildNameIndex(c)
+	}
+}
@@ -0,0 +1,60 @@
+package filesystem
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// patternMatcher builds the exact matcher of /search?mode=regex|glob. a file matches
+// when the pattern matches its name or its slash separated path below the manager.
+func patternMatcher(mode, pattern string) (func(name, rel string) bool, error) {
+	if pattern == "" {
+		return nil, fmt.Errorf("empty %s pattern", mode)
+	}
+	switch mode {
+	case "regex":
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex: %v", err)
+		}
+		return func(name, rel string) bool {
+			return re.MatchString(name) || re.MatchString(rel)
+		}, nil
+	case "glob":
+		if !validGlob(pattern) {
+			return nil, fmt.Errorf("invalid glob %q", pattern)
+		}
+		return func(name, rel string) bool {
+			return matchGlob(pattern, name) || matchGlob(pattern, rel)
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown search mode %q, expected fuzzy, regex or glob", mode)
+}
+
+// getPatternMatches returns every file match accepts. there is no similarity cut off,
+// all hits share distance 0 and come back in name order.
+func getPatternMatches(run *searchRun, match func(name, rel string) bool, composite *Folder, filter func(*File) bool) *safeResults {
+	ranked := []rankedFile{}
+	var walk func(f *Folder)
+	walk = func(f *Folder) {
+		if run.stopped() {
+			return
+		}
+		for _, file := range f.Files {
+			if filter != nil && !filter(file) {
+				continue
+			}
+			if match(file.Name, relativeToComposite(composite, file.Path)) {
+				rf := rankedFile{file: file}
+				ranked = append(ranked, rf)
+				run.emit(rf)
+			}
+		}
+		for _, sub := range f.Subfolders {
+			walk(sub)
+		}
+	}
+	walk(composite)
+	sortRanked(ranked)
+	return &safeResults{Name: composite.Name, rankedFiles: ranked}
+}
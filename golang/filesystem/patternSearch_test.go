@@ -0,0 +1,82 @@
+package filesystem
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func patternFolder() *Folder {
+	c := &Folder{Name: "pics", Path: "/pics"}
+	reports := &Folder{Name: "reports", Path: "/pics/work/reports"}
+	work := &Folder{Name: "work", Path: "/pics/work", Subfolders: []*Folder{reports}}
+	c.Subfolders = []*Folder{work}
+	for i := 0; i < 40; i++ {
+		c.Files = append(c.Files, &File{Name: fmt.Sprintf("IMG_2024%04d.jpg", i), Path: fmt.Sprintf("/pics/IMG_2024%04d.jpg", i)})
+	}
+	c.Files = append(c.Files,
+		&File{Name: "IMG_20220101.jpg", Path: "/pics/IMG_20220101.jpg"},
+		&File{Name: "IMG_20230101.jpg.xmp", Path: "/pics/IMG_20230101.jpg.xmp"})
+	reports.Files = []*File{
+		{Name: "q1.xlsx", Path: "/pics/work/reports/q1.xlsx"},
+		{Name: "q1.pdf", Path: "/pics/work/reports/q1.pdf"},
+	}
+	work.Files = []*File{{Name: "q2.xlsx", Path: "/pics/work/q2.xlsx"}}
+	return c
+}
+
+func TestSearchHandler_PatternModes(t *testing.T) {
+	orig := Composites
+	defer func() { Composites = orig }()
+	Composites = []*Folder{patternFolder()}
+
+	get := func(mode, pattern string, extra string) SearchResponse {
+		u := "/search?compositeName=pics&mode=" + mode + "&searchText=" + url.QueryEscape(pattern) + extra
+		return decodePage(t, u, func(rr *httptest.ResponseRecorder) {
+			SearchHandler(rr, httptest.NewRequest("GET", u, nil))
+		})
+	}
+
+	// 40 hits, more than the fuzzy page size, all counted
+	res := get("regex", `^IMG_20(23|24).*\.jpg$`, "&limit=500")
+	if res.Total != 40 || len(res.Children) != 40 {
+		t.Fatalf("expected all 40 2024 images, got %d of %d", len(res.Children), res.Total)
+	}
+	if res := get("regex", `^IMG_20(23|24).*\.jpg$`, ""); res.Total != 40 || len(res.Children) != limit {
+		t.Fatalf("expected a first page of %d out of 40, got %d of %d", limit, len(res.Children), res.Total)
+	}
+	// the relative path is matched too
+	if res := get("regex", `^work/reports/`, ""); res.Total != 2 {
+		t.Fatalf("expected both reports by path, got %d", res.Total)
+	}
+
+	res = get("glob", `**/reports/*.xlsx`, "")
+	if res.Total != 1 || res.Children[0].Path != "/pics/work/reports/q1.xlsx" {
+		t.Fatalf("unexpected glob hits %+v", res.Children)
+	}
+	if res := get("glob", `*.xlsx`, ""); res.Total != 2 {
+		t.Fatalf("a glob without a slash should match names anywhere, got %d", res.Total)
+	}
+
+	for _, q := range []string{"mode=regex&searchText=" + url.QueryEscape("IMG_(20"), "mode=glob&searchText=" + url.QueryEscape("[a-"), "mode=regex&searchText=", "mode=soundex&searchText=img"} {
+		rr := httptest.NewRecorder()
+		SearchHandler(rr, httptest.NewRequest("GET", "/search?compositeName=pics&"+q, nil))
+		if rr.Code != 400 {
+			t.Errorf("%s: expected 400, got %d", q, rr.Code)
+		}
+	}
+}
+
+func TestGetPatternMatches_PathLikeAutoTagRules(t *testing.T) {
+	// a path that cannot be made relative is matched as it is, the way rule globs see it
+	c := &Folder{Name: "odd", Path: "/odd", Files: []*File{{Name: "a.txt", Path: "loose/a.txt"}}}
+	var seen []string
+	getPatternMatches(nil, func(name, rel string) bool {
+		seen = append(seen, rel)
+		return true
+	}, c, nil)
+	if len(seen) != 1 || seen[0] != relativeToComposite(c, "loose/a.txt") || seen[0] != "loose/a.txt" {
+		t.Fatalf("unexpected relative paths %v", seen)
+	}
+}
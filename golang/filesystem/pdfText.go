@@ -0,0 +1,355 @@
+package filesystem
+
+// text of pdf files for the full-text index. there is no pdf library in the tree, so
+// this reads the page content streams directly: uncompressed and FlateDecode streams
+// are inflated and the strings shown by the text operators (Tj, TJ, ' and ") are
+// collected. strings are decoded as UTF-16 when they carry a byte order mark and as
+// WinAnsi otherwise, which covers pdfs written with the standard fonts. fonts with
+// their own encoding, most CID fonts and so most CJK text, are not mapped through
+// their ToUnicode tables and are left out, as are scanned pages without a text layer.
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+var (
+	pdfStreamStart = []byte("stream")
+	pdfStreamEnd   = []byte("endstream")
+	pdfObjStart    = []byte("obj")
+)
+
+// kerning in thousandths of a text unit from which TJ shows a space
+const pdfWordGap = 200
+
+// dictionary entries of streams that never hold page text
+var pdfSkippedStreams = []string{"/Image", "/Length1", "/Length2", "/Length3", "/XRef", "/ObjStm", "/Metadata", "/EmbeddedFile"}
+
+// extractPdfText returns the text of the page content streams of a pdf
+func extractPdfText(path string, maxSize int64) (string, bool) {
+	info, err := os.Stat(path)
+	if err != nil || info.Size() > maxSize {
+		return "", false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || !bytes.HasPrefix(data, []byte("%PDF-")) {
+		return "", false
+	}
+
+	var b strings.Builder
+	// inflated streams share the size budget of the file
+	budget := maxSize
+	for rest := data; budget > 0; {
+		i := bytes.Index(rest, pdfStreamStart)
+		if i < 0 {
+			break
+		}
+		// the dictionary sits between the object header and the stream keyword
+		dict := rest[:i]
+		if j := bytes.LastIndex(dict, pdfObjStart); j >= 0 {
+			dict = dict[j:]
+		}
+		body := rest[i+len(pdfStreamStart):]
+		body = bytes.TrimPrefix(body, []byte("\r"))
+		body = bytes.TrimPrefix(body, []byte("\n"))
+		end := bytes.Index(body, pdfStreamEnd)
+		if end < 0 {
+			break
+		}
+		rest = body[end+len(pdfStreamEnd):]
+
+		content, ok := pdfStreamContent(dict, body[:end], budget)
+		if !ok {
+			continue
+		}
+		budget -= int64(len(content))
+		pdfContentText(content, &b)
+	}
+	return b.String(), true
+}
+
+// pdfStreamContent decodes a stream, ok is false for streams that hold no page text
+func pdfStreamContent(dict, raw []byte, budget int64) ([]byte, bool) {
+	for _, skip := range pdfSkippedStreams {
+		if bytes.Contains(dict, []byte(skip)) {
+			return nil, false
+		}
+	}
+	if !bytes.Contains(dict, []byte("/Filter")) {
+		return raw, true
+	}
+	// filter chains and image filters are left alone
+	if !bytes.Contains(dict, []byte("/FlateDecode")) || bytes.Count(dict, []byte("Decode")) > 1 {
+		return nil, false
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return nil, false
+	}
+	defer zr.Close()
+	// streams cut short still give what could be inflated
+	content, _ := io.ReadAll(io.LimitReader(zr, budget))
+	return content, len(content) > 0
+}
+
+// pdfContentText appends the strings the text operators of a content stream show
+func pdfContentText(content []byte, b *strings.Builder) {
+	lex := &pdfLexer{data: content}
+	var operands []pdfToken
+	inText := false
+	for {
+		tok, ok := lex.next()
+		if !ok {
+			return
+		}
+		if tok.kind != pdfOperator {
+			operands = append(operands, tok)
+			continue
+		}
+		switch tok.text {
+		case "BT":
+			inText = true
+		case "ET":
+			inText = false
+			b.WriteByte('\n')
+		case "ID":
+			// inline image data runs up to EI
+			lex.skipInlineImage()
+		case "Td", "TD", "T*", "Tm":
+			if inText {
+				b.WriteByte(' ')
+			}
+		case "Tj", "'", "\"", "TJ":
+			if !inText {
+				break
+			}
+			if tok.text != "Tj" && tok.text != "TJ" {
+				b.WriteByte(' ')
+			}
+			for _, op := range operands {
+				switch {
+				case op.kind == pdfString:
+					b.WriteString(pdfDecodeString(op.raw))
+				case op.kind == pdfNumber && tok.text == "TJ":
+					// a large negative kerning inside TJ is the gap between two words
+					if n, err := strconv.ParseFloat(op.text, 64); err == nil && n <= -pdfWordGap {
+						b.WriteByte(' ')
+					}
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+}
+
+// pdfDecodeString turns the bytes of a pdf string into text, strings in two byte
+// font encodings are dropped rather than indexed as noise
+func pdfDecodeString(raw []byte) string {
+	if len(raw) >= 2 && raw[0] == 0xfe && raw[1] == 0xff {
+		units := make([]uint16, 0, len(raw)/2)
+		for i := 2; i+1 < len(raw); i += 2 {
+			units = append(units, uint16(raw[i])<<8|uint16(raw[i+1]))
+		}
+		return string(utf16.Decode(units))
+	}
+	if bytes.IndexByte(raw, 0) >= 0 {
+		return ""
+	}
+	text, err := charmap.Windows1252.NewDecoder().Bytes(raw)
+	if err != nil {
+		return ""
+	}
+	return string(text)
+}
+
+type pdfTokenKind int
+
+const (
+	pdfOperator pdfTokenKind = iota
+	pdfNumber
+	pdfString
+	pdfOther
+)
+
+type pdfToken struct {
+	kind pdfTokenKind
+	text string
+	// decoded bytes of a string
+	raw []byte
+}
+
+// pdfLexer splits a content stream into tokens
+type pdfLexer struct {
+	data []byte
+	pos  int
+}
+
+func pdfWhitespace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func pdfDelimiter(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+func (lex *pdfLexer) next() (pdfToken, bool) {
+	for lex.pos < len(lex.data) {
+		c := lex.data[lex.pos]
+		switch {
+		case pdfWhitespace(c):
+			lex.pos++
+		case c == '%':
+			for lex.pos < len(lex.data) && lex.data[lex.pos] != '\n' && lex.data[lex.pos] != '\r' {
+				lex.pos++
+			}
+		case c == '(':
+			lex.pos++
+			return pdfToken{kind: pdfString, raw: lex.literalString()}, true
+		case c == '<' && lex.pos+1 < len(lex.data) && lex.data[lex.pos+1] == '<',
+			c == '>' && lex.pos+1 < len(lex.data) && lex.data[lex.pos+1] == '>':
+			lex.pos += 2
+			return pdfToken{kind: pdfOther}, true
+		case c == '<':
+			lex.pos++
+			return pdfToken{kind: pdfString, raw: lex.hexString()}, true
+		case c == '/':
+			lex.pos++
+			lex.word()
+			return pdfToken{kind: pdfOther}, true
+		case pdfDelimiter(c):
+			lex.pos++
+			return pdfToken{kind: pdfOther}, true
+		default:
+			word := lex.word()
+			if strings.IndexByte("+-.0123456789", word[0]) >= 0 {
+				return pdfToken{kind: pdfNumber, text: word}, true
+			}
+			return pdfToken{kind: pdfOperator, text: word}, true
+		}
+	}
+	return pdfToken{}, false
+}
+
+// word reads regular characters, at least one
+func (lex *pdfLexer) word() string {
+	start := lex.pos
+	for lex.pos < len(lex.data) && !pdfWhitespace(lex.data[lex.pos]) && !pdfDelimiter(lex.data[lex.pos]) {
+		lex.pos++
+	}
+	if lex.pos == start && lex.pos < len(lex.data) {
+		lex.pos++
+	}
+	return string(lex.data[start:lex.pos])
+}
+
+// literalString reads a (string) after its opening parenthesis
+func (lex *pdfLexer) literalString() []byte {
+	var out []byte
+	depth := 1
+	for lex.pos < len(lex.data) {
+		c := lex.data[lex.pos]
+		lex.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				return out
+			}
+		case '\\':
+			if lex.pos >= len(lex.data) {
+				return out
+			}
+			e := lex.data[lex.pos]
+			lex.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r', '\n':
+				// a backslash at the end of a line continues the string
+				if e == '\r' && lex.pos < len(lex.data) && lex.data[lex.pos] == '\n' {
+					lex.pos++
+				}
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					n := int(e - '0')
+					for k := 0; k < 2 && lex.pos < len(lex.data) && lex.data[lex.pos] >= '0' && lex.data[lex.pos] <= '7'; k++ {
+						n = n*8 + int(lex.data[lex.pos]-'0')
+						lex.pos++
+					}
+					c = byte(n)
+				} else {
+					c = e
+				}
+			}
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// hexString reads a <hex string> after its opening bracket
+func (lex *pdfLexer) hexString() []byte {
+	var out []byte
+	var digits []byte
+	for lex.pos < len(lex.data) {
+		c := lex.data[lex.pos]
+		lex.pos++
+		if c == '>' {
+			break
+		}
+		if v, ok := hexValue(c); ok {
+			digits = append(digits, v)
+		}
+	}
+	// an odd last digit is followed by an implied 0
+	if len(digits)%2 == 1 {
+		digits = append(digits, 0)
+	}
+	for i := 0; i < len(digits); i += 2 {
+		out = append(out, digits[i]<<4|digits[i+1])
+	}
+	return out
+}
+
+func hexValue(c byte) (byte, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+// skipInlineImage moves past the data of an inline image, up to and including EI
+func (lex *pdfLexer) skipInlineImage() {
+	for lex.pos+2 <= len(lex.data) {
+		if lex.data[lex.pos] == 'E' && lex.data[lex.pos+1] == 'I' &&
+			lex.pos > 0 && pdfWhitespace(lex.data[lex.pos-1]) &&
+			(lex.pos+2 == len(lex.data) || pdfWhitespace(lex.data[lex.pos+2])) {
+			lex.pos += 2
+			return
+		}
+		lex.pos++
+	}
+	lex.pos = len(lex.data)
+}
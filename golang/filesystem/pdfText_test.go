@@ -0,0 +1,71 @@
+package filesystem
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writePdf writes a minimal pdf with one object per stream, a stream is compressed when
+// its dictionary asks for FlateDecode
+func writePdf(t *testing.T, path string, streams map[string]string) {
+	t.Helper()
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n")
+	n := 1
+	for dict, content := range streams {
+		data := []byte(content)
+		if strings.Contains(dict, "/FlateDecode") {
+			var z bytes.Buffer
+			zw := zlib.NewWriter(&z)
+			zw.Write(data)
+			zw.Close()
+			data = z.Bytes()
+		}
+		fmt.Fprintf(&b, "%d 0 obj\n<< %s /Length %d >>\nstream\n", n, dict, len(data))
+		b.Write(data)
+		b.WriteString("\nendstream\nendobj\n")
+		n++
+	}
+	b.WriteString("trailer\n<< /Size 4 >>\n%%EOF\n")
+	if err := os.WriteFile(path, b.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExtractPdfText(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.pdf")
+	writePdf(t, path, map[string]string{
+		"/Filter /FlateDecode": `BT /F1 12 Tf 72 720 Td (Quarterly \(draft\) report) Tj 0 -14 Td [(Bud) 20 (get) -250 (approved)] TJ ET`,
+		"":                     `BT <FEFF00E9007400E9> Tj <00410042> Tj ET`,
+		"/Subtype /Image":      `BT (noise) Tj ET`,
+	})
+
+	text, ok := extractText(path, maxIndexedTextSize)
+	if !ok {
+		t.Fatalf("pdf should be readable")
+	}
+	for _, want := range []string{"Quarterly (draft) report", "Budget approved", "été"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("expected %q in %q", want, text)
+		}
+	}
+	if strings.Contains(text, "noise") || strings.Contains(text, "AB") {
+		t.Errorf("images and two byte font strings should be skipped, got %q", text)
+	}
+
+	terms := termPositions(text)
+	if _, ok := terms["budget"]; !ok {
+		t.Errorf("pdf words should be indexed, got %v", terms)
+	}
+
+	// not a pdf at all
+	os.WriteFile(path, []byte("plain"), 0644)
+	if _, ok := extractText(path, maxIndexedTextSize); ok {
+		t.Errorf("a file without the pdf header should not be read as pdf")
+	}
+}
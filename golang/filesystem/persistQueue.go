@@ -0,0 +1,265 @@
+package filesystem
+
+// write-behind persistence: handlers mark a composite dirty and a worker writes each
+// dirty composite once per interval. encoding happens under mu (the tree may be
+// mutated by handlers), the disk write and the external tag export happen after mu
+// is released.
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const defaultFlushInterval = 2 * time.Second
+
+type persistenceQueue struct {
+	mu         sync.Mutex
+	pending    map[string]*Folder
+	running    bool
+	stop       chan struct{}
+	done       chan struct{}
+	generation uint64
+	lastErrors map[string]string
+	lastFlush  time.Time
+	writes     int
+
+	// fileMu serialises the actual file replacement, written is the newest generation on disk
+	fileMu  sync.Mutex
+	written map[string]uint64
+}
+
+var persister = &persistenceQueue{
+	pending:    make(map[string]*Folder),
+	lastErrors: make(map[string]string),
+	written:    make(map[string]uint64),
+}
+
+type encodedComposite struct {
+	comp       *Folder
+	out        []byte
+	generation uint64
+	exports    *tagExports
+}
+
+type PersistenceStatus struct {
+	Running   bool              `json:"running"`
+	Pending   []string          `json:"pending"`
+	Errors    map[string]string `json:"errors"`
+	LastFlush time.Time         `json:"lastFlush"`
+	Writes    int               `json:"writes"`
+}
+
+func (q *persistenceQueue) nextGeneration() uint64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.generation++
+	return q.generation
+}
+
+// forget drops a pending save, used when the composite is written or deleted directly
+func (q *persistenceQueue) forget(name string) {
+	q.mu.Lock()
+	delete(q.pending, name)
+	q.mu.Unlock()
+}
+
+// queueCompositeSave marks a composite as changed. without a running worker (tests,
+// tools) it falls back to a synchronous save so nothing is lost.
+func queueCompositeSave(c *Folder) {
+	if c == nil {
+		return
+	}
+	persister.mu.Lock()
+	if !persister.running {
+		persister.mu.Unlock()
+		saveCompositeDetails(c)
+		return
+	}
+	persister.pending[c.Name] = c
+	persister.mu.Unlock()
+}
+
+// takePending encodes every dirty composite, the caller must hold mu
+func (q *persistenceQueue) takePending() []encodedComposite {
+	q.mu.Lock()
+	pending := q.pending
+	q.pending = make(map[string]*Folder)
+	q.mu.Unlock()
+
+	var encoded []encodedComposite
+	for name, c := range pending {
+		out, err := json.MarshalIndent(compositeStorageTree(c), "", "  ")
+		if err != nil {
+			q.recordResult(name, c, err)
+			continue
+		}
+		encoded = append(encoded, encodedComposite{
+			comp:       c,
+			out:        out,
+			generation: q.nextGeneration(),
+			exports:    planTagExports(c),
+		})
+	}
+	return encoded
+}
+
+// write exports the tags and puts the encoded composites on disk, it records the outcome
+// of each file write. the tag exports are recorded by recordTagExports.
+func (q *persistenceQueue) write(encoded []encodedComposite) error {
+	var firstErr error
+	for _, e := range encoded {
+		e.exports.write()
+		err := writeCompositeFile(e.comp.Name, e.out, e.generation)
+		q.recordResult(e.comp.Name, e.comp, err)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	q.mu.Lock()
+	q.lastFlush = time.Now()
+	q.mu.Unlock()
+	return firstErr
+}
+
+// recordTagExports notes the written external tags on the files, caller holds mu
+func recordTagExports(encoded []encodedComposite) {
+	for _, e := range encoded {
+		e.exports.record()
+	}
+}
+
+// recordResult keeps the last error per manager and re-queues failed composites for the next flush
+func (q *persistenceQueue) recordResult(name string, c *Folder, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err == nil {
+		q.writes++
+		delete(q.lastErrors, name)
+		return
+	}
+	log.Printf("persisting %s failed: %v", name, err)
+	q.lastErrors[name] = err.Error()
+	if _, queued := q.pending[name]; !queued && q.running {
+		q.pending[name] = c
+	}
+}
+
+// pendingStampRequests lists the files whose stamps the pending saves need, caller holds mu
+func (q *persistenceQueue) pendingStampRequests() map[string][]stampRequest {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	requests := make(map[string][]stampRequest, len(q.pending))
+	for name, c := range q.pending {
+		requests[name] = stampRequests(c)
+	}
+	return requests
+}
+
+// FlushPendingSaves writes every pending composite now. files are stat'ed and hashed
+// before mu is taken for the encoding, tags are exported after it is released.
+func FlushPendingSaves() error {
+	mu.Lock()
+	requests := persister.pendingStampRequests()
+	mu.Unlock()
+	for name, reqs := range requests {
+		refreshStamps(name, reqs)
+	}
+
+	mu.Lock()
+	encoded := persister.takePending()
+	mu.Unlock()
+	err := persister.write(encoded)
+
+	mu.Lock()
+	recordTagExports(encoded)
+	mu.Unlock()
+	return err
+}
+
+// flushPendingSavesLocked is FlushPendingSaves for callers that already hold mu
+func flushPendingSavesLocked() error {
+	for name, reqs := range persister.pendingStampRequests() {
+		refreshStamps(name, reqs)
+	}
+	encoded := persister.takePending()
+	err := persister.write(encoded)
+	recordTagExports(encoded)
+	return err
+}
+
+// startPersistenceWorker switches handlers to write-behind mode
+func startPersistenceWorker(interval time.Duration) {
+	persister.mu.Lock()
+	if persister.running {
+		persister.mu.Unlock()
+		return
+	}
+	persister.running = true
+	persister.stop = make(chan struct{})
+	persister.done = make(chan struct{})
+	stop, done := persister.stop, persister.done
+	persister.mu.Unlock()
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				FlushPendingSaves()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// stopPersistenceWorker stops the worker and does a final flush, used on shutdown
+func stopPersistenceWorker() error {
+	persister.mu.Lock()
+	if !persister.running {
+		persister.mu.Unlock()
+		return nil
+	}
+	persister.running = false
+	close(persister.stop)
+	done := persister.done
+	persister.mu.Unlock()
+
+	<-done
+	return FlushPendingSaves()
+}
+
+func (q *persistenceQueue) status() PersistenceStatus {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	st := PersistenceStatus{
+		Running:   q.running,
+		Pending:   []string{},
+		Errors:    make(map[string]string, len(q.lastErrors)),
+		LastFlush: q.lastFlush,
+		Writes:    q.writes,
+	}
+	for name := range q.pending {
+		st.Pending = append(st.Pending, name)
+	}
+	sort.Strings(st.Pending)
+	for name, msg := range q.lastErrors {
+		st.Errors[name] = msg
+	}
+	return st
+}
+
+func persistenceStatusHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(persister.status()); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,159 @@
+package filesystem
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// startTestWorker runs the write-behind worker with an interval long enough that only explicit flushes write
+func startTestWorker(t *testing.T) {
+	t.Helper()
+	startPersistenceWorker(time.Hour)
+	t.Cleanup(func() { stopPersistenceWorker() })
+}
+
+func readStoredTree(t *testing.T, name string) DirectoryTreeJson {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("storage", name+".json"))
+	if err != nil {
+		t.Fatalf("read stored tree: %v", err)
+	}
+	var tree DirectoryTreeJson
+	if err := json.Unmarshal(data, &tree); err != nil {
+		t.Fatalf("unmarshal stored tree: %v", err)
+	}
+	return tree
+}
+
+func TestPersistQueue_CoalescesBurstIntoOneWrite(t *testing.T) {
+	tmp := chdirTemp(t)
+	startTestWorker(t)
+
+	comp := &Folder{Name: "burst", Path: tmp}
+	for i := 0; i < 500; i++ {
+		p := filepath.Join(tmp, "f"+string(rune('a'+i%26))+".txt")
+		if comp.GetFile(p) == nil {
+			comp.AddFile(&File{Name: filepath.Base(p), Path: p})
+		}
+		comp.AddTagToFile(p, "bulk")
+		queueCompositeSave(comp)
+	}
+
+	if _, err := os.Stat(filepath.Join("storage", "burst.json")); !os.IsNotExist(err) {
+		t.Fatalf("nothing should be written before a flush")
+	}
+
+	before := persister.status().Writes
+	if err := FlushPendingSaves(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	if got := persister.status().Writes - before; got != 1 {
+		t.Fatalf("expected one coalesced write, got %d", got)
+	}
+
+	tree := readStoredTree(t, "burst")
+	if len(tree.Children) != 26 || len(tree.Children[0].Tags) != 1 {
+		t.Fatalf("flushed tree incomplete: %d children", len(tree.Children))
+	}
+}
+
+func TestPersistQueue_ReportsAndRetriesFailedFlush(t *testing.T) {
+	chdirTemp(t)
+	startTestWorker(t)
+
+	// storage being a plain file makes every write fail
+	if err := os.WriteFile("storage", []byte("not a dir"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	comp := &Folder{Name: "broken"}
+	queueCompositeSave(comp)
+	if err := FlushPendingSaves(); err == nil {
+		t.Fatalf("expected flush error")
+	}
+
+	st := persister.status()
+	if st.Errors["broken"] == "" {
+		t.Fatalf("expected error to be reported for 'broken', got %v", st.Errors)
+	}
+	if len(st.Pending) != 1 || st.Pending[0] != "broken" {
+		t.Fatalf("failed composite should be re-queued, pending=%v", st.Pending)
+	}
+
+	// once storage is usable again the retry succeeds and clears the error
+	os.Remove("storage")
+	if err := FlushPendingSaves(); err != nil {
+		t.Fatalf("retry flush: %v", err)
+	}
+	if msg, ok := persister.status().Errors["broken"]; ok {
+		t.Fatalf("error should be cleared after a successful flush, got %q", msg)
+	}
+}
+
+func TestPersistQueue_StopFlushesPending(t *testing.T) {
+	tmp := chdirTemp(t)
+	startPersistenceWorker(time.Hour)
+
+	comp := &Folder{Name: "shutdown", Path: tmp, Tags: []string{}}
+	queueCompositeSave(comp)
+	if err := stopPersistenceWorker(); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	readStoredTree(t, "shutdown")
+}
+
+func TestPersistQueue_OlderEncodingNeverOverwritesNewer(t *testing.T) {
+	chdirTemp(t)
+
+	old := persister.nextGeneration()
+	newer := persister.nextGeneration()
+	if err := writeCompositeFile("gen", []byte(`{"name":"gen","rootPath":"new"}`), newer); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeCompositeFile("gen", []byte(`{"name":"gen","rootPath":"old"}`), old); err != nil {
+		t.Fatal(err)
+	}
+	if tree := readStoredTree(t, "gen"); tree.RootPath != "new" {
+		t.Fatalf("stale write replaced newer data: %q", tree.RootPath)
+	}
+}
+
+func TestPersistQueue_SynchronousWithoutWorker(t *testing.T) {
+	tmp := chdirTemp(t)
+
+	queueCompositeSave(&Folder{Name: "direct", Path: tmp})
+	readStoredTree(t, "direct")
+}
+
+func TestPersistQueue_ExportsTagsOnFlush(t *testing.T) {
+	tmp := chdirTemp(t)
+	startTestWorker(t)
+
+	photo := filepath.Join(tmp, "photo.jpg")
+	os.WriteFile(photo, []byte("x"), 0644)
+	comp := &Folder{Name: "exported", Path: tmp, XmpSync: &TagSyncSettings{Enabled: true}}
+	comp.AddFile(&File{Name: "photo.jpg", Path: photo, Tags: []string{"holiday"}})
+	queueCompositeSave(comp)
+
+	mu.Lock()
+	encoded := persister.takePending()
+	mu.Unlock()
+	if _, err := os.Stat(photo + xmpExt); !os.IsNotExist(err) {
+		t.Fatalf("the sidecar must not be written while mu is held")
+	}
+	if err := persister.write(encoded); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	recordTagExports(encoded)
+
+	data, _ := os.ReadFile(photo + xmpExt)
+	if tags, _ := parseXmpSubjects(data); len(tags) != 1 || tags[0] != "holiday" {
+		t.Fatalf("sidecar not written on flush: %v", tags)
+	}
+	if again := planXmpExport(comp); len(again) != 0 {
+		t.Fatalf("a recorded export must not be planned again, got %d", len(again))
+	}
+}
@@ -0,0 +1,556 @@
+package filesystem
+
+// a small query language for /query. terms are combined with AND (also implied by a
+// space), OR and NOT (or a leading "-"), parentheses group. a term is one of
+//
+//	tag:finance        the tag or one of its descendants, own or inherited
+//	type:pdf           extension, or category (type:documents)
+//	kw:invoice         a stored keyword
+//	path:clients/      part of the path relative to the manager, globs allowed
+//	name:report        part of the file name
+//	size>5MB           size compared with <, <=, >, >= or =, units B KB MB GB TB
+//	modified<30d       age (h d w m y) or date (2006-01-02)
+//	"annual report"    free text, matched fuzzily against the name
+//
+// the query is parsed into a predicate tree and evaluated per file. free text terms
+// that are not negated also rank the hits by their LevenshteinDist to the name.
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// queryFile is what a predicate sees, stat is only called for size and date terms
+type queryFile struct {
+	c         *Folder
+	file      *File
+	inherited []string
+	stat      func() os.FileInfo
+	now       time.Time
+}
+
+type queryNode interface {
+	eval(f *queryFile) bool
+	String() string
+}
+
+type andNode struct{ children []queryNode }
+type orNode struct{ children []queryNode }
+type notNode struct{ child queryNode }
+
+// termNode is a leaf, text is set for free text terms
+type termNode struct {
+	field string
+	cmp   string
+	value string
+	text  string
+	match func(f *queryFile) bool
+}
+
+func (n *andNode) eval(f *queryFile) bool {
+	for _, c := range n.children {
+		if !c.eval(f) {
+			return false
+		}
+	}
+	return true
+}
+
+func (n *orNode) eval(f *queryFile) bool {
+	for _, c := range n.children {
+		if c.eval(f) {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *notNode) eval(f *queryFile) bool  { return !n.child.eval(f) }
+func (n *termNode) eval(f *queryFile) bool { return n.match(f) }
+
+func joinNodes(op string, nodes []queryNode) string {
+	parts := make([]string, len(nodes))
+	for i, n := range nodes {
+		parts[i] = n.String()
+	}
+	return "(" + strings.Join(parts, " "+op+" ") + ")"
+}
+
+func (n *andNode) String() string { return joinNodes("AND", n.children) }
+func (n *orNode) String() string  { return joinNodes("OR", n.children) }
+func (n *notNode) String() string { return "NOT " + n.child.String() }
+func (n *termNode) String() string {
+	if n.text != "" {
+		return strconv.Quote(n.text)
+	}
+	return n.field + n.cmp + n.value
+}
+
+// Query is a parsed query, rankTerms are the free text terms that are not negated
+type Query struct {
+	root      queryNode
+	rankTerms []string
+}
+
+// -------------------- tokenizer --------------------
+
+type queryToken struct {
+	kind  string // "(", ")", "word", "phrase"
+	value string
+}
+
+func tokenizeQuery(input string) ([]queryToken, error) {
+	var tokens []queryToken
+	var word strings.Builder
+	flush := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, queryToken{kind: "word", value: word.String()})
+			word.Reset()
+		}
+	}
+
+	runes := []rune(input)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, fmt.Errorf("unterminated quote at position %d", i)
+			}
+			quoted := string(runes[i+1 : end])
+			if word.Len() > 0 {
+				// field:"quoted value"
+				word.WriteString(quoted)
+				flush()
+			} else {
+				tokens = append(tokens, queryToken{kind: "phrase", value: quoted})
+			}
+			i = end
+		case r == '(' || r == ')':
+			flush()
+			tokens = append(tokens, queryToken{kind: string(r)})
+		case unicode.IsSpace(r):
+			flush()
+		default:
+			word.WriteRune(r)
+		}
+	}
+	flush()
+	return tokens, nil
+}
+
+// -------------------- parser --------------------
+
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+	rank   []string
+}
+
+func (p *queryParser) peek() *queryToken {
+	if p.pos < len(p.tokens) {
+		return &p.tokens[p.pos]
+	}
+	return nil
+}
+
+func (p *queryParser) isKeyword(word string) bool {
+	t := p.peek()
+	return t != nil && t.kind == "word" && t.value == word
+}
+
+// ParseQuery turns the query text into a predicate tree
+func ParseQuery(input string) (*Query, error) {
+	tokens, err := tokenizeQuery(input)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("query is empty")
+	}
+	p := &queryParser{tokens: tokens}
+	root, err := p.parseOr(false)
+	if err != nil {
+		return nil, err
+	}
+	if p.peek() != nil {
+		// parseOr only stops early at a closing parenthesis
+		return nil, fmt.Errorf("unexpected )")
+	}
+	return &Query{root: root, rankTerms: p.rank}, nil
+}
+
+func (p *queryParser) parseOr(negated bool) (queryNode, error) {
+	first, err := p.parseAnd(negated)
+	if err != nil {
+		return nil, err
+	}
+	children := []queryNode{first}
+	for p.isKeyword("OR") {
+		p.pos++
+		next, err := p.parseAnd(negated)
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, next)
+	}
+	if len(children) == 1 {
+		return first, nil
+	}
+	return &orNode{children: children}, nil
+}
+
+func (p *queryParser) parseAnd(negated bool) (queryNode, error) {
+	var children []queryNode
+	for {
+		t := p.peek()
+		if t == nil || t.kind == ")" || p.isKeyword("OR") {
+			break
+		}
+		if p.isKeyword("AND") {
+			p.pos++
+			continue
+		}
+		node, err := p.parseUnary(negated)
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, node)
+	}
+	switch len(children) {
+	case 0:
+		return nil, fmt.Errorf("expected a term")
+	case 1:
+		return children[0], nil
+	}
+	return &andNode{children: children}, nil
+}
+
+func (p *queryParser) parseUnary(negated bool) (queryNode, error) {
+	t := p.peek()
+	if t == nil {
+		return nil, fmt.Errorf("expected a term after NOT")
+	}
+	if p.isKeyword("NOT") {
+		p.pos++
+		child, err := p.parseUnary(!negated)
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{child: child}, nil
+	}
+	if t.kind == "word" && strings.HasPrefix(t.value, "-") {
+		// "-draft" negates the term, a lone "-" the group that follows
+		if t.value = t.value[1:]; t.value == "" {
+			p.pos++
+		}
+		child, err := p.parseUnary(!negated)
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{child: child}, nil
+	}
+	if t.kind == "(" {
+		p.pos++
+		inner, err := p.parseOr(negated)
+		if err != nil {
+			return nil, err
+		}
+		if t := p.peek(); t == nil || t.kind != ")" {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+		p.pos++
+		return inner, nil
+	}
+	if t.kind == ")" {
+		return nil, fmt.Errorf("unexpected )")
+	}
+
+	p.pos++
+	if t.kind == "phrase" {
+		return p.textTerm(t.value, negated)
+	}
+	return p.term(t.value, negated)
+}
+
+var comparisonTerm = regexp.MustCompile(`^(?i)(size|modified):?(<=|>=|<|>|=)(.+)$`)
+
+func (p *queryParser) term(word string, negated bool) (queryNode, error) {
+	if m := comparisonTerm.FindStringSubmatch(word); m != nil {
+		field := strings.ToLower(m[1])
+		if field == "size" {
+			return sizeTerm(m[2], m[3])
+		}
+		return modifiedTerm(m[2], m[3])
+	}
+
+	field, value, found := strings.Cut(word, ":")
+	if !found {
+		return p.textTerm(word, negated)
+	}
+	if value == "" {
+		return nil, fmt.Errorf("%s: needs a value", field)
+	}
+	field = strings.ToLower(field)
+	lower := strings.ToLower(value)
+	n := &termNode{field: field, cmp: ":", value: value}
+
+	switch field {
+	case "tag":
+		tag := normalizeTag(value)
+		n.match = func(f *queryFile) bool {
+			return hasMatchingTag(f.file.Tags, tag) || hasMatchingTag(f.inherited, tag)
+		}
+	case "type":
+		ext := strings.TrimPrefix(lower, ".")
+		n.match = func(f *queryFile) bool {
+			name := strings.ToLower(f.file.Name)
+			return strings.HasSuffix(name, "."+ext) || strings.EqualFold(GetCategory(f.file.Name), ext)
+		}
+	case "kw", "keyword":
+		n.match = func(f *queryFile) bool {
+			for _, kw := range f.file.Keywords {
+				if strings.Contains(strings.ToLower(kw.GetKeyword()), lower) {
+					return true
+				}
+			}
+			return false
+		}
+	case "path":
+		glob := strings.ContainsAny(value, "*?[")
+		if glob && !validGlob(value) {
+			return nil, fmt.Errorf("invalid path glob %q", value)
+		}
+		// without a glob the value has to start at a path segment, path:clients/ is not myclients/
+		needle := "/" + strings.TrimPrefix(filepath.ToSlash(lower), "/")
+		n.match = func(f *queryFile) bool {
+			rel := relativeToComposite(f.c, f.file.Path)
+			if glob {
+				return matchGlob(value, rel)
+			}
+			return strings.Contains("/"+strings.ToLower(rel), needle)
+		}
+	case "name":
+		n.match = func(f *queryFile) bool {
+			return strings.Contains(strings.ToLower(f.file.Name), lower)
+		}
+	default:
+		return nil, fmt.Errorf("unknown field %q", field)
+	}
+	return n, nil
+}
+
+// textTerm matches the name fuzzily, or a name containing the words in any separator style
+func (p *queryParser) textTerm(text string, negated bool) (queryNode, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, fmt.Errorf("empty phrase")
+	}
+	if !negated {
+		p.rank = append(p.rank, text)
+	}
+	words := foldText(text)
+	return &termNode{text: text, match: func(f *queryFile) bool {
+		if strings.Contains(nameWords(f.file.Name), words) {
+			return true
+		}
+		_, ok := fuzzyNameMatch(text, f.file.Name)
+		return ok
+	}}, nil
+}
+
+// nameWords folds name (see foldText) and turns the usual separators into spaces
+func nameWords(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r == '-' || r == '.' {
+			return ' '
+		}
+		return r
+	}, foldText(name))
+}
+
+var sizeUnits = map[string]float64{"": 1, "b": 1, "kb": 1 << 10, "mb": 1 << 20, "gb": 1 << 30, "tb": 1 << 40}
+
+func parseSize(raw string) (int64, error) {
+	raw = strings.ToLower(strings.TrimSpace(raw))
+	i := strings.IndexFunc(raw, func(r rune) bool { return unicode.IsLetter(r) })
+	number, unit := raw, ""
+	if i >= 0 {
+		number, unit = raw[:i], raw[i:]
+	}
+	mult, ok := sizeUnits[unit]
+	n, err := strconv.ParseFloat(number, 64)
+	if !ok || err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", raw)
+	}
+	return int64(n * mult), nil
+}
+
+func compareInt(cmp string, a, b int64) bool {
+	switch cmp {
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	}
+	return a == b
+}
+
+func sizeTerm(cmp, raw string) (queryNode, error) {
+	size, err := parseSize(raw)
+	if err != nil {
+		return nil, err
+	}
+	return &termNode{field: "size", cmp: cmp, value: raw, match: func(f *queryFile) bool {
+		info := f.stat()
+		return info != nil && compareInt(cmp, info.Size(), size)
+	}}, nil
+}
+
+var ageUnits = map[byte]time.Duration{
+	'h': time.Hour,
+	'd': 24 * time.Hour,
+	'w': 7 * 24 * time.Hour,
+	'm': 30 * 24 * time.Hour,
+	'y': 365 * 24 * time.Hour,
+}
+
+// modifiedTerm compares the age for durations (modified<30d: changed in the last 30 days)
+// and the modification time for dates (modified<2025-01-01: changed before that day)
+func modifiedTerm(cmp, raw string) (queryNode, error) {
+	n := &termNode{field: "modified", cmp: cmp, value: raw}
+	lower := strings.ToLower(raw)
+	if unit, ok := ageUnits[lower[len(lower)-1]]; ok {
+		count, err := strconv.Atoi(lower[:len(lower)-1])
+		if err != nil || count < 0 {
+			return nil, fmt.Errorf("invalid age %q", raw)
+		}
+		if cmp == "=" {
+			return nil, fmt.Errorf("ages can only be compared with < or >")
+		}
+		age := time.Duration(count) * unit
+		n.match = func(f *queryFile) bool {
+			info := f.stat()
+			return info != nil && compareInt(cmp, int64(f.now.Sub(info.ModTime())), int64(age))
+		}
+		return n, nil
+	}
+
+	day, err := time.ParseInLocation("2006-01-02", raw, time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("invalid date %q, expected 2006-01-02 or an age like 30d", raw)
+	}
+	n.match = func(f *queryFile) bool {
+		info := f.stat()
+		if info == nil {
+			return false
+		}
+		mod := info.ModTime()
+		switch cmp {
+		case "<":
+			return mod.Before(day)
+		case "<=":
+			return mod.Before(day.AddDate(0, 0, 1))
+		case ">":
+			return !mod.Before(day.AddDate(0, 0, 1))
+		case ">=":
+			return !mod.Before(day)
+		}
+		return !mod.Before(day) && mod.Before(day.AddDate(0, 0, 1))
+	}
+	return n, nil
+}
+
+// -------------------- evaluation --------------------
+
+// Run evaluates the query over every file of c and ranks the hits
+func (q *Query) Run(c *Folder) []rankedFile {
+	var hits []rankedFile
+	q.each(c, func(file *File) {
+		dist := 0
+		for _, text := range q.rankTerms {
+			if strings.Contains(nameWords(file.Name), foldText(text)) {
+				continue
+			}
+			d, _ := fuzzyNameMatch(text, file.Name)
+			dist += d
+		}
+		hits = append(hits, rankedFile{file: file, distance: dist})
+	})
+	sortRanked(hits)
+	return hits
+}
+
+// each calls visit for every file of c the query matches, in tree order
+func (q *Query) each(c *Folder, visit func(file *File)) {
+	inherited := inheritedFileTags(c)
+	now := time.Now()
+
+	var walk func(f *Folder)
+	walk = func(f *Folder) {
+		for _, file := range f.Files {
+			qf := &queryFile{c: c, file: file, inherited: inherited[file], now: now}
+			var info os.FileInfo
+			statted := false
+			qf.stat = func() os.FileInfo {
+				if !statted {
+					statted = true
+					if fi, err := os.Stat(file.Path); err == nil {
+						info = fi
+					}
+				}
+				return info
+			}
+			if q.root.eval(qf) {
+				visit(file)
+			}
+		}
+		for _, sub := range f.Subfolders {
+			walk(sub)
+		}
+	}
+	walk(c)
+}
+
+// queryHandler runs ?q= over the manager ?name=
+func queryHandler(w http.ResponseWriter, r *http.Request) {
+	q, err := ParseQuery(r.URL.Query().Get("q"))
+	if err != nil {
+		http.Error(w, "Invalid query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	offset, pageLimit, err := searchPageParams(r, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	c := findComposite(r.URL.Query().Get("name"))
+	if c == nil {
+		http.Error(w, "No smart manager with that name", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(searchPage(c.Name, q.Run(c), offset, pageLimit)); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
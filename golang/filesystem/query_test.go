@@ -0,0 +1,141 @@
+package filesystem
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	pb "github.com/COS301-SE-2025/Smart-File-Manager/golang/client/protos"
+)
+
+func TestParseQuery_Tree(t *testing.T) {
+	cases := map[string]string{
+		`tag:finance type:pdf`:                     `(tag:finance AND type:pdf)`,
+		`tag:a OR tag:b kw:x`:                      `(tag:a OR (tag:b AND kw:x))`,
+		`(tag:a OR tag:b) AND NOT "annual report"`: `((tag:a OR tag:b) AND NOT "annual report")`,
+		`size>=5MB -path:archive/`:                 `(size>=5MB AND NOT path:archive/)`,
+		`-(type:pdf OR type:docx) name:"q1 plan"`:  `(NOT (type:pdf OR type:docx) AND name:q1 plan)`,
+	}
+	for in, want := range cases {
+		q, err := ParseQuery(in)
+		if err != nil {
+			t.Errorf("%s: %v", in, err)
+			continue
+		}
+		if got := q.root.String(); got != want {
+			t.Errorf("%s:\n got %s\nwant %s", in, got, want)
+		}
+	}
+
+	q, _ := ParseQuery(`report NOT draft "annual report"`)
+	if len(q.rankTerms) != 2 || q.rankTerms[0] != "report" || q.rankTerms[1] != "annual report" {
+		t.Errorf("negated text must not rank, got %v", q.rankTerms)
+	}
+}
+
+func TestParseQuery_Errors(t *testing.T) {
+	for _, in := range []string{``, `"open`, `(tag:a`, `tag:a)`, `NOT`, `colour:red`, `size>lots`, `modified=3d`, `modified<yesterday`, `path:[x`, `tag:a OR`} {
+		if _, err := ParseQuery(in); err == nil {
+			t.Errorf("expected %q to be rejected", in)
+		}
+	}
+}
+
+func queryManager(t *testing.T) *Folder {
+	t.Helper()
+	root := t.TempDir()
+	write := func(rel string, size int, age time.Duration) {
+		p := filepath.Join(root, rel)
+		os.MkdirAll(filepath.Dir(p), 0755)
+		os.WriteFile(p, make([]byte, size), 0644)
+		mod := time.Now().Add(-age)
+		os.Chtimes(p, mod, mod)
+	}
+	write("clients/acme/annual_report_2024.pdf", 6<<20, 2*24*time.Hour)
+	write("clients/acme/invoice.pdf", 10, 90*24*time.Hour)
+	write("myclients/notes.txt", 10, time.Hour)
+	write("archive/annual-report-2019.docx", 10, 400*24*time.Hour)
+
+	c, err := ConvertToObject("query", root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acme := c.GetSubfolder(filepath.Join(root, "clients", "acme"))
+	acme.AddTagToSelf("", "finance")
+	acme.SetTagInheritance("finance", true)
+	c.GetFile(filepath.Join(root, "clients", "acme", "invoice.pdf")).Keywords = []*pb.Keyword{{Keyword: "Invoice", Score: 3}}
+	return c
+}
+
+func runQuery(t *testing.T, c *Folder, text string) []string {
+	t.Helper()
+	q, err := ParseQuery(text)
+	if err != nil {
+		t.Fatalf("%s: %v", text, err)
+	}
+	var names []string
+	for _, hit := range q.Run(c) {
+		names = append(names, hit.file.Name)
+	}
+	return names
+}
+
+func TestQuery_Run(t *testing.T) {
+	c := queryManager(t)
+	cases := map[string][]string{
+		`tag:finance type:pdf size>5MB modified<30d`: {"annual_report_2024.pdf"},
+		`kw:invoice path:clients/`:                   {"invoice.pdf"},
+		`path:clients/`:                              {"annual_report_2024.pdf", "invoice.pdf"},
+		`"annual report"`:                            {"annual-report-2019.docx", "annual_report_2024.pdf"},
+		`"annual report" NOT type:documents`:         {},
+		`type:txt OR modified>1y`:                    {"annual-report-2019.docx", "notes.txt"},
+		`path:**/acme/*.pdf -name:invoice`:           {"annual_report_2024.pdf"},
+	}
+	for in, want := range cases {
+		got := runQuery(t, c, in)
+		if len(got) != len(want) {
+			t.Errorf("%s: got %v, want %v", in, got, want)
+			continue
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("%s: got %v, want %v", in, got, want)
+				break
+			}
+		}
+	}
+}
+
+func TestQuery_RanksByNameDistance(t *testing.T) {
+	c := queryManager(t)
+	got := runQuery(t, c, `type:pdf OR type:txt invoce`)
+	if len(got) == 0 || got[0] != "invoice.pdf" {
+		t.Fatalf("closest name should come first, got %v", got)
+	}
+}
+
+func TestQueryHandler(t *testing.T) {
+	orig := Composites
+	defer func() { Composites = orig }()
+	Composites = []*Folder{queryManager(t)}
+
+	rr := httptest.NewRecorder()
+	queryHandler(rr, httptest.NewRequest("GET", "/query?name=query&q="+url.QueryEscape(`tag:finance kw:invoice`), nil))
+	var res DirectoryTreeJson
+	if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Children) != 1 || res.Children[0].Name != "invoice.pdf" {
+		t.Fatalf("unexpected result %+v", res.Children)
+	}
+
+	rr = httptest.NewRecorder()
+	queryHandler(rr, httptest.NewRequest("GET", "/query?name=query&q="+url.QueryEscape(`(tag:finance`), nil))
+	if rr.Code != 400 {
+		t.Fatalf("expected 400 for a bad query, got %d", rr.Code)
+	}
+}
@@ -3,6 +3,7 @@ package filesystem
 import (
 	"encoding/json"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
 	"sort"
@@ -11,24 +12,45 @@ import (
 
 // uses load tree struct directoryTreeJson
 
-func saveCompositeDetails(c *Folder) {
+// saveCompositeDetails writes the composite straight away. handlers should use
+// queueCompositeSave so bursts of changes become a single write.
+func saveCompositeDetails(c *Folder) error {
 
 	if c == nil {
-		return
+		return nil
 	}
-	children := compositeToJsonStorageFormat(c)
+	persister.forget(c.Name)
+	exportExternalTags(c)
+	refreshStamps(c.Name, stampRequests(c))
 
-	root := DirectoryTreeJson{
-		Name:     c.Name,
-		IsFolder: true,
-		RootPath: c.Path,
-		Children: children,
+	if err := saveCompositeDetailsToFile(compositeStorageTree(c)); err != nil {
+		log.Printf("saving %s failed: %v", c.Name, err)
+		return err
 	}
+	return nil
+}
 
-	saveCompositeDetailsToFile(root)
+// compositeStorageTree builds the stored representation of a composite. it does not
+// touch the disk, file stamps come from the last refreshStamps.
+func compositeStorageTree(c *Folder) DirectoryTreeJson {
+	children := compositeToJsonStorageFormat(c, storedStampsOf(c.Name))
+
+	return DirectoryTreeJson{
+		Name:         c.Name,
+		IsFolder:     true,
+		RootPath:     c.Path,
+		Children:     children,
+		TagRegistry:  c.TagDefinitions,
+		TagRules:     c.TagRules,
+		XattrSync:    c.XattrSync,
+		XmpSync:      c.XmpSync,
+		LockPolicies: c.LockPolicies,
+		SmartFolders: c.SmartFolders,
+		WriteProtect: c.WriteProtect,
+	}
 }
 
-func compositeToJsonStorageFormat(folder *Folder) []FileNode {
+func compositeToJsonStorageFormat(folder *Folder, stamps map[string]fileStampRecord) []FileNode {
 	if folder == nil {
 		return nil
 	}
@@ -37,27 +59,40 @@ func compositeToJsonStorageFormat(folder *Folder) []FileNode {
 	for _, file := range folder.Files {
 		tags := file.Tags
 
-		nodes = append(nodes, FileNode{
-			Name:     file.Name,
-			Path:     file.Path,
-			IsFolder: false,
-			Keywords: file.Keywords,
-			Tags:     tags,
-			Locked:   file.Locked,
-		})
+		node := FileNode{
+			Name:         file.Name,
+			Path:         file.Path,
+			IsFolder:     false,
+			Keywords:     file.Keywords,
+			Tags:         tags,
+			Locked:       file.Locked,
+			Lock:         file.LockInfo,
+			OriginalMode: file.OriginalMode,
+			Identity:     file.Identity,
+			RuleTags:     file.RuleTags,
+		}
+		// only files with user metadata need the (expensive) hash fallback
+		if storedNodeHasMetadata(node) {
+			stamp := stampOf(file, stamps)
+			node.Size, node.ModTime, node.ContentHash = stamp.size, stamp.modTime, stamp.hash
+		}
+		nodes = append(nodes, node)
 	}
 
 	for _, sub := range folder.Subfolders {
 		// recurse first
-		childNodes := compositeToJsonStorageFormat(sub)
+		childNodes := compositeToJsonStorageFormat(sub, stamps)
 
 		nodes = append(nodes, FileNode{
-			Name:     sub.Name,
-			Path:     sub.Path,
-			IsFolder: true,
-			Tags:     sub.Tags,
-			Children: childNodes,
-			Locked:   sub.Locked,
+			Name:         sub.Name,
+			Path:         sub.Path,
+			IsFolder:     true,
+			Tags:         sub.Tags,
+			InheritTags:  sub.InheritTags,
+			Children:     childNodes,
+			Locked:       sub.Locked,
+			Lock:         sub.LockInfo,
+			OriginalMode: sub.OriginalMode,
 		})
 	}
 
@@ -66,15 +101,27 @@ func compositeToJsonStorageFormat(folder *Folder) []FileNode {
 
 // uses temp files to prevent races / overwritting a file that is being read
 func saveCompositeDetailsToFile(comp DirectoryTreeJson) error {
-	filePath := filepath.Join("storage", comp.Name+".json")
-	dir := filepath.Dir(filePath)
-
-	if err := os.MkdirAll(dir, 0755); err != nil {
+	out, err := json.MarshalIndent(comp, "", "  ")
+	if err != nil {
 		return err
 	}
+	return writeCompositeFile(comp.Name, out, persister.nextGeneration())
+}
 
-	out, err := json.MarshalIndent(comp, "", "  ")
-	if err != nil {
+// writeCompositeFile atomically replaces storage/<name>.json. generation orders
+// writers that encoded outside of each other, an older encoding never replaces a newer one.
+func writeCompositeFile(name string, out []byte, generation uint64) error {
+	persister.fileMu.Lock()
+	defer persister.fileMu.Unlock()
+
+	if generation < persister.written[name] {
+		return nil
+	}
+
+	filePath := filepath.Join("storage", name+".json")
+	dir := filepath.Dir(filePath)
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
 		return err
 	}
 
@@ -114,6 +161,7 @@ func saveCompositeDetailsToFile(comp DirectoryTreeJson) error {
 		_ = d.Close()
 	}
 
+	persister.written[name] = generation
 	return nil
 }
 
@@ -141,53 +189,90 @@ func populateKeywordsFromStoredJsonFile(comp *Folder) {
 
 }
 
+// mergeDirectoryTreeToComposite restores stored metadata by path, then re-attaches
+// whatever was left over to files that were renamed or moved outside the app
 func mergeDirectoryTreeToComposite(comp *Folder, directory *DirectoryTreeJson) {
-	for _, node := range directory.Children {
-		if !node.IsFolder {
-			// fmt.Println(node.Name)
-			path := node.Path
-
-			compositeFile := comp.GetFile(path)
-			if compositeFile != nil {
-				compositeFile.Keywords = node.Keywords
-				compositeFile.Tags = node.Tags
-				compositeFile.Locked = node.Locked
-			}
+	claimed := make(map[string]struct{})
+	var orphans []FileNode
 
-			// fmt.Println("is locked for file : " + compositeFile.Name)
-			// fmt.Println(strconv.FormatBool(compositeFile.Locked))
-			// fmt.Println("\n ====")
+	if directory.TagRegistry != nil {
+		comp.TagDefinitions = directory.TagRegistry
+	}
+	if directory.TagRules != nil {
+		comp.TagRules = directory.TagRules
+	}
+	if directory.XattrSync != nil {
+		comp.XattrSync = directory.XattrSync
+	}
+	if directory.XmpSync != nil {
+		comp.XmpSync = directory.XmpSync
+	}
+	if directory.LockPolicies != nil {
+		comp.LockPolicies = directory.LockPolicies
+	}
+	if directory.SmartFolders != nil {
+		comp.SmartFolders = directory.SmartFolders
+	}
+	if directory.WriteProtect {
+		comp.WriteProtect = true
+	}
 
+	for _, node := range directory.Children {
+		if !node.IsFolder {
+			mergeStoredFileNode(comp, node, claimed, &orphans)
 		} else {
-			helperMergeDirectoryTreeToComposite(comp, &node)
+			helperMergeDirectoryTreeToComposite(comp, &node, claimed, &orphans)
 		}
 	}
-	// fmt.Println("======END OFmergeDirectoryTreeToComposite========")
-
-	// PrettyPrintFolder(comp, "")
 
+	if n := reattachOrphanedMetadata(comp, orphans, claimed); n > 0 {
+		fmt.Printf("re-attached stored metadata for %d moved file(s) in %s\n", n, comp.Name)
+	}
+	// the stored keywords replaced the ones the index was built from
+	dropKeywordIndex(comp)
 }
 
-func helperMergeDirectoryTreeToComposite(comp *Folder, fileNode *FileNode) {
+func helperMergeDirectoryTreeToComposite(comp *Folder, fileNode *FileNode, claimed map[string]struct{}, orphans *[]FileNode) {
+	// folders carry their own tags and lock just like files
+	if compositeFolder := comp.GetSubfolder(fileNode.Path); compositeFolder != nil && compositeFolder != comp {
+		applyStoredFolderNode(compositeFolder, *fileNode)
+	}
+
 	for _, node := range fileNode.Children {
 		if !node.IsFolder {
-			path := node.Path
-
-			compositeFile := comp.GetFile(path)
-			if compositeFile != nil {
-				compositeFile.Keywords = node.Keywords
-				compositeFile.Tags = node.Tags
-				compositeFile.Locked = node.Locked
-			}
-			// fmt.Println("path : " + compositeFile.Path)
-
+			mergeStoredFileNode(comp, node, claimed, orphans)
 		} else {
-			helperMergeDirectoryTreeToComposite(comp, &node)
+			helperMergeDirectoryTreeToComposite(comp, &node, claimed, orphans)
 		}
 	}
 
 }
 
+// applyStoredFolderNode copies persisted folder metadata onto a composite folder
+func applyStoredFolderNode(folder *Folder, node FileNode) {
+	folder.Tags = node.Tags
+	folder.InheritTags = node.InheritTags
+	folder.Locked = node.Locked
+	folder.LockInfo = node.Lock
+	// a node saved without protection says nothing about the mode on disk now
+	if node.OriginalMode != nil {
+		folder.OriginalMode = node.OriginalMode
+	}
+}
+
+// mergeStoredFileNode applies a stored file node by path, or records it as an orphan
+func mergeStoredFileNode(comp *Folder, node FileNode, claimed map[string]struct{}, orphans *[]FileNode) {
+	compositeFile := comp.GetFile(node.Path)
+	if compositeFile != nil {
+		applyStoredFileNode(compositeFile, node)
+		claimed[node.Path] = struct{}{}
+		return
+	}
+	if storedNodeHasMetadata(node) {
+		*orphans = append(*orphans, node)
+	}
+}
+
 func deleteCompositeDetailsFile(compName string) error {
 	filePath := filepath.Join("storage", compName+".json")
 	if err := os.Remove(filePath); err != nil {
@@ -0,0 +1,111 @@
+package filesystem
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	pb "github.com/COS301-SE-2025/Smart-File-Manager/golang/client/protos"
+)
+
+func paginationFolder(n int) *Folder {
+	c := &Folder{Name: "pages", Path: "/p"}
+	sub := &Folder{Name: "sub", Path: "/p/sub"}
+	c.Subfolders = []*Folder{sub}
+	for i := 0; i < n; i++ {
+		// spread over two folders so results arrive from several goroutines
+		target := c
+		if i%2 == 1 {
+			target = sub
+		}
+		target.Files = append(target.Files, &File{
+			Name:     fmt.Sprintf("report_%02d.txt", i),
+			Path:     fmt.Sprintf("%s/report_%02d.txt", target.Path, i),
+			Keywords: []*pb.Keyword{{Keyword: "budget", Score: 1}},
+		})
+	}
+	return c
+}
+
+func decodePage(t *testing.T, url string, handler func(*httptest.ResponseRecorder)) SearchResponse {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	handler(rr)
+	if rr.Code != 200 {
+		t.Fatalf("%s: status %d: %s", url, rr.Code, rr.Body.String())
+	}
+	var res SearchResponse
+	if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestSearchHandler_PagesThroughAllMatches(t *testing.T) {
+	orig := Composites
+	defer func() { Composites = orig }()
+	Composites = []*Folder{paginationFolder(30)}
+
+	get := func(url string) SearchResponse {
+		return decodePage(t, url, func(rr *httptest.ResponseRecorder) {
+			SearchHandler(rr, httptest.NewRequest("GET", url, nil))
+		})
+	}
+
+	first := get("/search?compositeName=pages&searchText=report")
+	if first.Total != 30 || len(first.Children) != limit || first.Limit != limit {
+		t.Fatalf("expected the default page of %d out of 30, got %d of %d", limit, len(first.Children), first.Total)
+	}
+	rest := get("/search?compositeName=pages&searchText=report&offset=25")
+	if rest.Total != 30 || len(rest.Children) != 5 {
+		t.Fatalf("expected the last 5, got %d", len(rest.Children))
+	}
+
+	// pages are stable and do not overlap
+	seen := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		page := get(fmt.Sprintf("/search?compositeName=pages&searchText=report&offset=%d&limit=10", i*10))
+		for j, node := range page.Children {
+			if want := fmt.Sprintf("report_%02d.txt", i*10+j); node.Name != want {
+				t.Fatalf("page %d item %d = %s, want %s", i, j, node.Name, want)
+			}
+			seen[node.Path] = true
+		}
+	}
+	if len(seen) != 30 {
+		t.Fatalf("expected 30 distinct results over the pages, got %d", len(seen))
+	}
+
+	for _, q := range []string{"limit=0", "limit=100000", "offset=-1", "offset=x"} {
+		rr := httptest.NewRecorder()
+		SearchHandler(rr, httptest.NewRequest("GET", "/search?compositeName=pages&searchText=report&"+q, nil))
+		if rr.Code != 400 {
+			t.Errorf("%s: expected 400, got %d", q, rr.Code)
+		}
+	}
+}
+
+func TestKeywordSearchHandler_Pagination(t *testing.T) {
+	orig := Composites
+	defer func() { Composites = orig }()
+	Composites = []*Folder{paginationFolder(20)}
+
+	get := func(url string) SearchResponse {
+		return decodePage(t, url, func(rr *httptest.ResponseRecorder) {
+			KeywordSearchHadler(rr, httptest.NewRequest("GET", url, nil))
+		})
+	}
+	first := get("/keywordSearch?compositeName=pages&searchText=budget")
+	if first.Total != 20 || len(first.Children) != limitKeywordSearch {
+		t.Fatalf("expected %d of 20, got %d of %d", limitKeywordSearch, len(first.Children), first.Total)
+	}
+	all := get("/keywordSearch?compositeName=pages&searchText=budget&limit=50")
+	if len(all.Children) != 20 || all.Children[19].Name != "report_19.txt" {
+		t.Fatalf("expected every match in name order, got %d", len(all.Children))
+	}
+	past := get("/keywordSearch?compositeName=pages&searchText=budget&offset=40")
+	if past.Total != 20 || len(past.Children) != 0 {
+		t.Fatalf("an offset past the end should give an empty page")
+	}
+}
@@ -0,0 +1,136 @@
+package filesystem
+
+// /search and /keywordSearch stream with stream=true: the response is newline delimited
+// json with a match record for every hit as soon as a search goroutine finds it, in no
+// particular order, followed by one summary record holding the ranked page exactly like
+// the normal response. cancelling the request stops the traversal through its context.
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+)
+
+// searchRun ties a search to its request. found, when set, sees every match as soon as
+// it is found. a nil run searches to the end without reporting anything.
+type searchRun struct {
+	ctx   context.Context
+	found func(rankedFile)
+}
+
+// stopped reports whether the request went away
+func (run *searchRun) stopped() bool {
+	return run != nil && run.ctx.Err() != nil
+}
+
+// done is closed once the request goes away, it never is for a nil run
+func (run *searchRun) done() <-chan struct{} {
+	if run == nil {
+		return nil
+	}
+	return run.ctx.Done()
+}
+
+func (run *searchRun) emit(rf rankedFile) {
+	if run != nil && run.found != nil {
+		run.found(rf)
+	}
+}
+
+// forManager passes the matches of one manager on to run, each path only once over all
+// managers and labelled with the manager label names for it. seen is shared between
+// the managers of one search.
+func (run *searchRun) forManager(label func(path string) string, seen map[string]struct{}) *searchRun {
+	if run == nil || run.found == nil {
+		return run
+	}
+	return &searchRun{ctx: run.ctx, found: func(rf rankedFile) {
+		key := filepath.Clean(rf.file.Path)
+		if _, ok := seen[key]; ok {
+			return
+		}
+		seen[key] = struct{}{}
+		rf.manager = label(rf.file.Path)
+		run.found(rf)
+	}}
+}
+
+// SearchStreamRecord is one line of a streamed search, type is match or summary
+type SearchStreamRecord struct {
+	Type    string          `json:"type"`
+	Match   *FileNode       `json:"match,omitempty"`
+	Summary *SearchResponse `json:"summary,omitempty"`
+}
+
+// searchStream writes the records of a streamed search, flushing after each one
+type searchStream struct {
+	w   http.ResponseWriter
+	enc *json.Encoder
+}
+
+func newSearchStream(w http.ResponseWriter) *searchStream {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	return &searchStream{w: w, enc: json.NewEncoder(w)}
+}
+
+func (s *searchStream) write(rec SearchStreamRecord) {
+	if s.enc.Encode(rec) != nil {
+		return
+	}
+	if f, ok := s.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (s *searchStream) match(rf rankedFile) {
+	node := searchNode(rf)
+	s.write(SearchStreamRecord{Type: "match", Match: &node})
+}
+
+func (s *searchStream) summary(res SearchResponse) {
+	s.write(SearchStreamRecord{Type: "summary", Summary: &res})
+}
+
+// wantsStream reports whether the search should be streamed as ndjson
+func wantsStream(r *http.Request) bool {
+	return r.URL.Query().Get("stream") == "true"
+}
+
+// respondSearch runs search on the manager ?compositeName= (every manager for all=true)
+// and answers with the requested page, streamed when asked to
+func respondSearch(w http.ResponseWriter, r *http.Request, offset, pageLimit int, search func(run *searchRun, c *Folder) *safeResults) {
+	run := &searchRun{ctx: r.Context()}
+	var stream *searchStream
+	if wantsStream(r) {
+		stream = newSearchStream(w)
+		run.found = stream.match
+	}
+	respond := func(res SearchResponse) {
+		if run.stopped() {
+			// nobody is listening anymore and the ranking is incomplete
+			return
+		}
+		if stream != nil {
+			stream.summary(res)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(res)
+	}
+
+	if wantsAllManagers(r) {
+		respond(searchPage(allManagersName, searchAllManagers(run, search), offset, pageLimit))
+		return
+	}
+
+	name := r.URL.Query().Get("compositeName")
+	for _, c := range Composites {
+		if c.Name == name {
+			sr := search(run, c)
+			respond(searchPage(sr.Name, sr.rankedFiles, offset, pageLimit))
+			return
+		}
+	}
+	http.Error(w, "No smart manager with that name", http.StatusBadRequest)
+}
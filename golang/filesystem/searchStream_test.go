@@ -0,0 +1,128 @@
+package filesystem
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// streamRecords runs handler and decodes every ndjson line of its response
+func streamRecords(t *testing.T, handler http.HandlerFunc, req *http.Request) []SearchStreamRecord {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	if rr.Code != 200 || rr.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("status %d, content type %q: %s", rr.Code, rr.Header().Get("Content-Type"), rr.Body.String())
+	}
+	var records []SearchStreamRecord
+	scanner := bufio.NewScanner(rr.Body)
+	for scanner.Scan() {
+		var rec SearchStreamRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatalf("bad line %q: %v", scanner.Text(), err)
+		}
+		records = append(records, rec)
+	}
+	return records
+}
+
+// checkStream checks that every match was streamed once before the summary
+func checkStream(t *testing.T, records []SearchStreamRecord) *SearchResponse {
+	t.Helper()
+	if len(records) == 0 || records[len(records)-1].Type != "summary" {
+		t.Fatalf("the stream should end with a summary, got %+v", records)
+	}
+	summary := records[len(records)-1].Summary
+	seen := map[string]bool{}
+	for _, rec := range records[:len(records)-1] {
+		if rec.Type != "match" || rec.Match == nil || seen[rec.Match.Path] {
+			t.Fatalf("expected distinct match records, got %+v", rec)
+		}
+		seen[rec.Match.Path] = true
+	}
+	if len(seen) != summary.Total {
+		t.Fatalf("streamed %d matches, the summary counts %d", len(seen), summary.Total)
+	}
+	return summary
+}
+
+func TestSearchHandler_Stream(t *testing.T) {
+	orig := Composites
+	defer func() { Composites = orig }()
+	scan := paginationFolder(30)
+	indexed := paginationFolder(30)
+	indexed.Name = "indexed"
+	indexed.nameIndex = buildNameIndex(indexed)
+	Composites = []*Folder{scan, indexed}
+
+	for url, first := range map[string]string{
+		"/search?compositeName=pages&searchText=report&stream=true&limit=10":     "report_00.txt",
+		"/search?compositeName=indexed&searchText=report&stream=true&limit=10":   "report_00.txt",
+		"/search?compositeName=pages&searchText=report_1*&mode=glob&stream=true": "report_10.txt",
+		"/keywordSearch?compositeName=pages&searchText=budget&stream=true":       "report_00.txt",
+	} {
+		handler := SearchHandler
+		if url[1] == 'k' {
+			handler = KeywordSearchHadler
+		}
+		summary := checkStream(t, streamRecords(t, handler, httptest.NewRequest("GET", url, nil)))
+		if len(summary.Children) == 0 || summary.Children[0].Name != first {
+			t.Fatalf("%s: the summary should hold the ranked page, got %+v", url, summary)
+		}
+	}
+}
+
+func TestSearchHandlers_StreamAllManagers(t *testing.T) {
+	orig := Composites
+	defer func() { Composites = orig }()
+	Composites = crossManagers()
+
+	records := streamRecords(t, SearchHandler, httptest.NewRequest("GET", "/search?all=true&searchText=holiday&stream=true", nil))
+	summary := checkStream(t, records)
+	if summary.Total != 1 || records[0].Match.Manager != "photos" || summary.Children[0].Manager != "photos" {
+		t.Fatalf("a file of nested managers should be streamed once, got %+v", records)
+	}
+
+	records = streamRecords(t, KeywordSearchHadler, httptest.NewRequest("GET", "/keywordSearch?all=true&searchText=tax&stream=true", nil))
+	if summary = checkStream(t, records); summary.Total != 2 || summary.Children[0].Manager != "work" {
+		t.Fatalf("unexpected summary %+v", summary)
+	}
+}
+
+func TestSearch_StopsWhenRequestGoesAway(t *testing.T) {
+	c := &Folder{Name: "big", Path: "/big"}
+	for i := 0; i < 100; i++ {
+		sub := &Folder{Name: fmt.Sprint(i), Path: fmt.Sprintf("/big/%d", i)}
+		for j := 0; j < 20; j++ {
+			sub.Files = append(sub.Files, &File{Name: fmt.Sprintf("report_%d.txt", j), Path: fmt.Sprintf("%s/report_%d.txt", sub.Path, j)})
+		}
+		c.Subfolders = append(c.Subfolders, sub)
+	}
+
+	// cancelling after the first match stops the traversal
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	found := 0
+	run := &searchRun{ctx: ctx, found: func(rankedFile) {
+		found++
+		cancel()
+	}}
+	if got := getMatches(run, "report", c, nil).rankedFiles; len(got) == 2000 || found != len(got) {
+		t.Fatalf("expected the search to stop early, got %d of 2000 (%d streamed)", len(got), found)
+	}
+
+	orig := Composites
+	defer func() { Composites = orig }()
+	Composites = []*Folder{c}
+	for _, url := range []string{"/search?compositeName=big&searchText=report", "/search?compositeName=big&searchText=report&stream=true"} {
+		rr := httptest.NewRecorder()
+		SearchHandler(rr, httptest.NewRequest("GET", url, nil).WithContext(ctx))
+		if rr.Body.Len() != 0 {
+			t.Fatalf("%s: nothing should be written for a cancelled request, got %q", url, rr.Body.String())
+		}
+	}
+}
@@ -3,14 +3,18 @@ package filesystem
 import (
 	// "encoding/json"
 	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
 	"sync"
+	"syscall"
+	"time"
 )
 
 var (
@@ -19,6 +23,9 @@ var (
 	mu         sync.Mutex
 )
 
+// how long in-flight requests get to finish after a shutdown signal
+const shutdownTimeout = 10 * time.Second
+
 // savePortToEnv updates or creates the GO_PORT entry in server.env
 func savePortToEnv(port int) error {
 	// Get the current working directory
@@ -202,7 +209,7 @@ func addTagHandler(w http.ResponseWriter, r *http.Request) {
 		if item != nil {
 			c.AddTagToFile(convertedPath, tag)
 			c.Display(0)
-			saveCompositeDetails(c)
+			queueCompositeSave(c)
 			w.Write([]byte("true"))
 			return
 		}
@@ -224,17 +231,24 @@ func removeTagHandler(w http.ResponseWriter, r *http.Request) {
 	for _, c := range Composites {
 		// Check file
 		if file := c.GetFile(convertedPath); file != nil {
+			if !guardLocks(w, r, "remove tag", lockBlockers(c, []string{convertedPath}, false)) {
+				return
+			}
 			if file.RemoveTag(tag) {
 				// fmt.Printf("Removed tag '%s' from file: %s\n", tag, convertedPath)
-				saveCompositeDetails(c)
+				queueCompositeSave(c)
 				w.Write([]byte("true"))
 				return
 			}
 		}
 		// Csheck folder
 		if folder := c.GetSubfolder(convertedPath); folder != nil {
+			if !guardLocks(w, r, "remove tag", lockBlockers(c, []string{convertedPath}, false)) {
+				return
+			}
 			if folder.RemoveTag(tag) {
 				// fmt.Printf("Removed tag '%s' from folder: %s\n", tag, convertedPath)
+				queueCompositeSave(c)
 				w.Write([]byte("true"))
 				return
 			}
@@ -253,13 +267,21 @@ func lockHandler(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("Parameter missing"))
 		return
 	}
+	// optional reason, owner and expiresAt / duration
+	info, err := lockInfoFromRequest(r, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	mu.Lock()
 	defer mu.Unlock()
 
 	for _, c := range Composites {
 		if c.Name == name {
-			c.LockByPath(path)
-			saveCompositeDetails(c)
+			if !lockPathWithInfo(c, path, info) {
+				break
+			}
+			queueCompositeSave(c)
 			w.Write([]byte("true"))
 			return
 		}
@@ -282,7 +304,7 @@ func unlockHandler(w http.ResponseWriter, r *http.Request) {
 	for _, c := range Composites {
 		if c.Name == name {
 			c.UnlockByPath(path)
-			saveCompositeDetails(c)
+			queueCompositeSave(c)
 			w.Write([]byte("true"))
 			return
 		}
@@ -291,8 +313,32 @@ func unlockHandler(w http.ResponseWriter, r *http.Request) {
 
 }
 
-func deleteFileHandler(w http.ResponseWriter, r *http.Request) {
+// deletePath reads ?path= and cleans it the way paths are stored in the tree, so
+// "dir/" or "dir/./x" cannot slip past the lock check under another spelling
+func deletePath(r *http.Request) string {
 	path := r.URL.Query().Get("path")
+	if path == "" {
+		return ""
+	}
+	return filepath.Clean(ConvertToWSLPath(path))
+}
+
+// writeTree answers with the directory tree of c
+func writeTree(w http.ResponseWriter, c *Folder) {
+	root := DirectoryTreeJson{
+		Name:     c.Name,
+		IsFolder: true,
+		RootPath: c.Path,
+		Children: GoSidecreateDirectoryJSONStructure(c),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(root); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+func deleteFileHandler(w http.ResponseWriter, r *http.Request) {
+	path := deletePath(r)
 	name := r.URL.Query().Get("name")
 	mu.Lock()
 	defer mu.Unlock()
@@ -302,26 +348,35 @@ func deleteFileHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	for _, c := range Composites {
 		if c.Name == name {
+			file := c.GetFile(path)
+			if file == nil {
+				http.Error(w, "File not found in this smart manager", http.StatusNotFound)
+				return
+			}
+			sidecar := file.Sidecar
+			if !guardLocks(w, r, "delete file", lockBlockers(c, []string{path}, true)) {
+				return
+			}
+			// the disk goes first, a file that could not be removed keeps its place,
+			// tags and lock in the tree. a forced delete of a protected file needs its
+			// write bits back first
+			reprotect := unprotectForDelete(c, path)
 			err := os.RemoveAll(path)
-			if err == nil {
-				c.RemoveFile(path)
-			} else {
-				fmt.Println("Error removing folder:", path, "Error:", err)
+			reprotect()
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Failed to remove file %s: %v", path, err), http.StatusInternalServerError)
+				return
 			}
-			children := GoSidecreateDirectoryJSONStructure(c)
-
-			root := DirectoryTreeJson{
-				Name:     c.Name,
-				IsFolder: true,
-				RootPath: c.Path,
-				Children: children,
+			if err := c.RemoveFileOrderPreserving(path); err != nil {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
 			}
-			// w.WriteHeader(http.StatusOK)
-			w.Header().Set("Content-Type", "application/json")
-			// Encode the response as JSON
-			if err := json.NewEncoder(w).Encode(root); err != nil {
-				http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+			queueCompositeSave(c)
+			if err := removeSidecar(sidecar); err != nil {
+				http.Error(w, fmt.Sprintf("Failed to remove sidecar %s: %v", sidecar, err), http.StatusInternalServerError)
+				return
 			}
+			writeTree(w, c)
 			return
 		}
 	}
@@ -331,7 +386,7 @@ func deleteFileHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func deleteFolderHandler(w http.ResponseWriter, r *http.Request) {
-	path := r.URL.Query().Get("path")
+	path := deletePath(r)
 	name := r.URL.Query().Get("name")
 	mu.Lock()
 	defer mu.Unlock()
@@ -341,26 +396,32 @@ func deleteFolderHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	for _, c := range Composites {
 		if c.Name == name {
-			err := os.RemoveAll(path)
-			if err == nil {
-				c.RemoveSubfolder(path)
-			} else {
-				fmt.Println("Error removing folder:", path, "Error:", err)
+			folder := c.GetSubfolder(path)
+			if folder == nil {
+				http.Error(w, "Folder not found in this smart manager", http.StatusNotFound)
+				return
 			}
-			children := GoSidecreateDirectoryJSONStructure(c)
-
-			root := DirectoryTreeJson{
-				Name:     c.Name,
-				IsFolder: true,
-				RootPath: c.Path,
-				Children: children,
+			if folder == c {
+				http.Error(w, "The root of a smart manager cannot be deleted, remove the manager instead", http.StatusConflict)
+				return
+			}
+			if !guardLocks(w, r, "delete folder", lockBlockers(c, []string{path}, true)) {
+				return
+			}
+			// the disk goes first, see deleteFileHandler
+			reprotect := unprotectForDelete(c, path)
+			err := os.RemoveAll(path)
+			reprotect()
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Failed to remove folder %s: %v", path, err), http.StatusInternalServerError)
+				return
 			}
-			// w.WriteHeader(http.StatusOK)
-			w.Header().Set("Content-Type", "application/json")
-			// Encode the response as JSON
-			if err := json.NewEncoder(w).Encode(root); err != nil {
-				http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+			if err := c.RemoveSubfolder(path); err != nil {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
 			}
+			queueCompositeSave(c)
+			writeTree(w, c)
 			return
 		}
 	}
@@ -378,6 +439,7 @@ func deleteManagerHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	for i, c := range Composites {
 		if c.Name == name {
+			snapshotBefore("delete manager")
 			// Delete folder
 			// os.RemoveAll(c.Path)
 			// Remove from list of managers
@@ -415,6 +477,7 @@ func deleteManagerHandler(w http.ResponseWriter, r *http.Request) {
 				panic(err)
 			}
 			//remove storage file
+			persister.forget(c.Name)
 			deleteCompositeDetailsFile(c.Name)
 			// fmt.Println("Deleted manager")
 			w.Write([]byte("true"))
@@ -462,6 +525,23 @@ func HandleRequests() {
 
 	http.Handle("/addTag", secretMiddleware(http.HandlerFunc(addTagHandler)))
 	http.Handle("/removeTag", secretMiddleware(http.HandlerFunc(removeTagHandler)))
+	http.Handle("/tagTree", secretMiddleware(http.HandlerFunc(tagTreeHandler)))
+	http.Handle("/filesByTag", secretMiddleware(http.HandlerFunc(filesByTagHandler)))
+	http.Handle("/addFolderTag", secretMiddleware(http.HandlerFunc(addFolderTagHandler)))
+	http.Handle("/removeFolderTag", secretMiddleware(http.HandlerFunc(removeFolderTagHandler)))
+	http.Handle("/tagRules", secretMiddleware(http.HandlerFunc(tagRulesHandler)))
+	http.Handle("/addTagRule", secretMiddleware(http.HandlerFunc(addTagRuleHandler)))
+	http.Handle("/removeTagRule", secretMiddleware(http.HandlerFunc(removeTagRuleHandler)))
+	http.Handle("/applyTagRules", secretMiddleware(http.HandlerFunc(applyTagRulesHandler)))
+	http.Handle("/xattrSync", secretMiddleware(http.HandlerFunc(xattrSyncHandler)))
+	http.Handle("/xmpSync", secretMiddleware(http.HandlerFunc(xmpSyncHandler)))
+	http.Handle("/suggestTags", secretMiddleware(http.HandlerFunc(suggestTagsHandler)))
+	http.Handle("/bulkSuggestTags", secretMiddleware(http.HandlerFunc(bulkSuggestTagsHandler)))
+	http.Handle("/renameTag", secretMiddleware(http.HandlerFunc(renameTagHandler)))
+	http.Handle("/tags", secretMiddleware(http.HandlerFunc(listTagsHandler)))
+	http.Handle("/defineTag", secretMiddleware(http.HandlerFunc(defineTagHandler)))
+	http.Handle("/mergeTags", secretMiddleware(http.HandlerFunc(mergeTagsHandler)))
+	http.Handle("/deleteTag", secretMiddleware(http.HandlerFunc(deleteTagHandler)))
 
 	http.Handle("/loadTreeData", secretMiddleware(http.HandlerFunc(loadTreeDataHandlerGoOnly)))
 
@@ -470,8 +550,20 @@ func HandleRequests() {
 
 	http.Handle("/lock", secretMiddleware(http.HandlerFunc(lockHandler)))
 	http.Handle("/unlock", secretMiddleware(http.HandlerFunc(unlockHandler)))
+	http.Handle("/locks", secretMiddleware(http.HandlerFunc(locksHandler)))
+	http.Handle("/lockPolicies", secretMiddleware(http.HandlerFunc(lockPoliciesHandler)))
+	http.Handle("/addLockPolicy", secretMiddleware(http.HandlerFunc(addLockPolicyHandler)))
+	http.Handle("/updateLockPolicy", secretMiddleware(http.HandlerFunc(updateLockPolicyHandler)))
+	http.Handle("/removeLockPolicy", secretMiddleware(http.HandlerFunc(removeLockPolicyHandler)))
+	http.Handle("/smartFolders", secretMiddleware(http.HandlerFunc(smartFoldersHandler)))
+	http.Handle("/addSmartFolder", secretMiddleware(http.HandlerFunc(addSmartFolderHandler)))
+	http.Handle("/updateSmartFolder", secretMiddleware(http.HandlerFunc(updateSmartFolderHandler)))
+	http.Handle("/removeSmartFolder", secretMiddleware(http.HandlerFunc(removeSmartFolderHandler)))
+	http.Handle("/writeProtection", secretMiddleware(http.HandlerFunc(writeProtectionHandler)))
 
 	http.Handle("/search", secretMiddleware(http.HandlerFunc(SearchHandler)))
+	http.Handle("/query", secretMiddleware(http.HandlerFunc(queryHandler)))
+	http.Handle("/contentSearch", secretMiddleware(http.HandlerFunc(contentSearchHandler)))
 
 	http.Handle("/keywordSearch", secretMiddleware(http.HandlerFunc(KeywordSearchHadler)))
 	http.Handle("/isKeywordSearchReady", secretMiddleware(http.HandlerFunc(IsKeywordSearchReadyHander)))
@@ -493,11 +585,38 @@ func HandleRequests() {
 
 	http.Handle("/returnStats", secretMiddleware(http.HandlerFunc(StatHandler)))
 
+	http.Handle("/snapshots", secretMiddleware(http.HandlerFunc(listSnapshotsHandler)))
+	http.Handle("/restoreSnapshot", secretMiddleware(http.HandlerFunc(restoreSnapshotHandler)))
+
+	http.Handle("/persistenceStatus", secretMiddleware(http.HandlerFunc(persistenceStatusHandler)))
+
+	startDailySnapshots()
+	startPersistenceWorker(defaultFlushInterval)
+	startLockExpiry()
+
 	addr := fmt.Sprintf("0.0.0.0:%d", port)
-	if err := http.ListenAndServe(addr, nil); err != nil {
+	srv := &http.Server{Addr: addr}
+
+	// a signal stops the server, HandleRequests then returns to main
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			fmt.Printf("Server shutdown failed: %v\n", err)
+		}
+	}()
+
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		fmt.Printf("Server failed to start: %v\n", err)
 	}
 
+	// flush pending writes before the process goes away
+	if err := stopPersistenceWorker(); err != nil {
+		fmt.Printf("Final flush failed: %v\n", err)
+	}
 }
 
 // Getter for main.go
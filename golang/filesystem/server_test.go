@@ -386,6 +386,21 @@ func TestAPI_RemoveTagHandler_FolderTags(t *testing.T) {
 		t.Error("Expected folder tag to be removed")
 	}
 
+	// Removal must be persisted, not only applied in memory
+	data, err := os.ReadFile(filepath.Join("storage", "tagTest.json"))
+	if err != nil {
+		t.Fatalf("expected storage to be written after folder tag removal: %v", err)
+	}
+	var stored DirectoryTreeJson
+	if err := json.Unmarshal(data, &stored); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range stored.Children {
+		if n.Path == subDir && len(n.Tags) != 0 {
+			t.Errorf("Expected stored folder tags to be empty, got %v", n.Tags)
+		}
+	}
+
 	// Test removing non-existent tag
 	req = httptest.NewRequest("GET", "/removeTag?path="+subDir+"&tag=nonexistenttag", nil)
 	w = httptest.NewRecorder()
@@ -495,7 +510,15 @@ func TestAPI_JSONEncodingError(t *testing.T) {
 	w := httptest.NewRecorder()
 	deleteFileHandler(w, req)
 
-	// The handler should attempt to encode JSON even on error
+	// paths the manager does not know are refused before disk is touched
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a path outside the tree, got %d", w.Code)
+	}
+
+	os.WriteFile(filepath.Join(tmp, "known.txt"), []byte("x"), 0644)
+	testFolder.Files = []*File{{Name: "known.txt", Path: filepath.Join(tmp, "known.txt")}}
+	w = httptest.NewRecorder()
+	deleteFileHandler(w, httptest.NewRequest("GET", "/deleteFile?name=jsonTest&path="+filepath.Join(tmp, "known.txt"), nil))
 	contentType := w.Header().Get("Content-Type")
 	if !strings.Contains(contentType, "application/json") {
 		t.Errorf("Expected JSON content type, got %s", contentType)
@@ -0,0 +1,313 @@
+package filesystem
+
+// smart folders are saved searches. each one is stored with its manager and shows up in
+// the smartFolderNodes of /loadTreeData as a virtual folder (smartFolder set, no path)
+// holding the files that currently match, so it follows the tree without being updated
+// itself. they are kept out of children, so clients walking the real tree never meet a
+// folder without a path. the conditions are compiled into the same predicates /query uses.
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SmartFolder matches the files meeting all of its non-empty conditions.
+// NameGlob is matched against the file name ignoring case, Tags must all be present
+// (own or inherited, descendants count), Type is an extension or a category and every
+// keyword has to be among the file's keywords. ModifiedSince takes today, this week,
+// this month, this year, an age (30d) or a date (2006-01-02), ModifiedBefore an age or
+// a date.
+type SmartFolder struct {
+	ID             string   `json:"id"`
+	Name           string   `json:"name"`
+	NameGlob       string   `json:"nameGlob,omitempty"`
+	Tags           []string `json:"tags,omitempty"`
+	Untagged       bool     `json:"untagged,omitempty"`
+	Type           string   `json:"type,omitempty"`
+	Keywords       []string `json:"keywords,omitempty"`
+	ModifiedSince  string   `json:"modifiedSince,omitempty"`
+	ModifiedBefore string   `json:"modifiedBefore,omitempty"`
+}
+
+// periodStart returns where a calendar period containing now begins
+func periodStart(period string, now time.Time) (time.Time, bool) {
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch period {
+	case "today":
+		return day, true
+	case "this week":
+		// weeks start on monday
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7)), true
+	case "this month":
+		return day.AddDate(0, 0, 1-day.Day()), true
+	case "this year":
+		return time.Date(now.Year(), 1, 1, 0, 0, 0, 0, now.Location()), true
+	}
+	return time.Time{}, false
+}
+
+// compile turns the conditions into a query, it fails for invalid or missing conditions
+func (s *SmartFolder) compile() (*Query, error) {
+	var nodes []queryNode
+	p := &queryParser{}
+	add := func(word string) error {
+		n, err := p.term(word, false)
+		if err != nil {
+			return err
+		}
+		nodes = append(nodes, n)
+		return nil
+	}
+
+	if s.NameGlob != "" {
+		glob := strings.ToLower(s.NameGlob)
+		if _, err := path.Match(glob, ""); err != nil || strings.Contains(glob, "/") {
+			return nil, fmt.Errorf("invalid name pattern %q", s.NameGlob)
+		}
+		nodes = append(nodes, &termNode{field: "name", cmp: ":", value: s.NameGlob, match: func(f *queryFile) bool {
+			ok, _ := path.Match(glob, strings.ToLower(f.file.Name))
+			return ok
+		}})
+	}
+	for _, tag := range s.Tags {
+		if err := add("tag:" + tag); err != nil {
+			return nil, err
+		}
+	}
+	if s.Untagged {
+		if len(s.Tags) > 0 {
+			return nil, fmt.Errorf("untagged cannot be combined with tags")
+		}
+		nodes = append(nodes, &termNode{field: "untagged", match: func(f *queryFile) bool {
+			return len(f.file.Tags) == 0 && len(f.inherited) == 0
+		}})
+	}
+	if s.Type != "" {
+		if err := add("type:" + s.Type); err != nil {
+			return nil, err
+		}
+	}
+	for _, kw := range s.Keywords {
+		if err := add("kw:" + kw); err != nil {
+			return nil, err
+		}
+	}
+	if since := strings.ToLower(strings.TrimSpace(s.ModifiedSince)); since != "" {
+		if _, ok := periodStart(since, time.Now()); ok {
+			nodes = append(nodes, &termNode{field: "modified", cmp: ">=", value: since, match: func(f *queryFile) bool {
+				start, _ := periodStart(since, f.now)
+				info := f.stat()
+				return info != nil && !info.ModTime().Before(start)
+			}})
+		} else if err := s.addModified(&nodes, since, "<", ">="); err != nil {
+			return nil, err
+		}
+	}
+	if before := strings.ToLower(strings.TrimSpace(s.ModifiedBefore)); before != "" {
+		if err := s.addModified(&nodes, before, ">", "<"); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("smart folder has no conditions")
+	}
+	return &Query{root: &andNode{children: nodes}}, nil
+}
+
+// addModified adds a modified term, ages and dates compare the other way round
+func (s *SmartFolder) addModified(nodes *[]queryNode, raw, ageCmp, dateCmp string) error {
+	cmp := dateCmp
+	if _, err := time.Parse("2006-01-02", raw); err != nil {
+		cmp = ageCmp
+	}
+	n, err := modifiedTerm(cmp, raw)
+	if err != nil {
+		return err
+	}
+	*nodes = append(*nodes, n)
+	return nil
+}
+
+func (s *SmartFolder) validate(c *Folder) error {
+	s.Name = strings.TrimSpace(s.Name)
+	if s.Name == "" {
+		return fmt.Errorf("smart folder needs a name")
+	}
+	for _, other := range c.SmartFolders {
+		if other.ID != s.ID && strings.EqualFold(other.Name, s.Name) {
+			return fmt.Errorf("a smart folder called %q already exists", other.Name)
+		}
+	}
+	// shown beside the top level of the tree, a real folder of that name would be ambiguous
+	for _, sub := range c.Subfolders {
+		if strings.EqualFold(sub.Name, s.Name) {
+			return fmt.Errorf("the manager already has a folder called %q", sub.Name)
+		}
+	}
+	_, err := s.compile()
+	return err
+}
+
+// files returns the matching files of c sorted by name
+func (s *SmartFolder) files(c *Folder) []*File {
+	q, err := s.compile()
+	if err != nil {
+		return nil
+	}
+	var found []*File
+	q.each(c, func(file *File) {
+		found = append(found, file)
+	})
+	sort.SliceStable(found, func(i, j int) bool {
+		a, b := strings.ToLower(found[i].Name), strings.ToLower(found[j].Name)
+		if a != b {
+			return a < b
+		}
+		return found[i].Path < found[j].Path
+	})
+	return found
+}
+
+// smartFolderNodes builds the virtual folders of c for the tree response
+func smartFolderNodes(c *Folder) []FileNode {
+	var nodes []FileNode
+	for _, s := range c.SmartFolders {
+		nodes = append(nodes, FileNode{
+			Name:        s.Name,
+			IsFolder:    true,
+			Metadata:    &Metadata{},
+			Children:    GoSidecreateDirectoryJSONStructure(&Folder{Files: s.files(c)}),
+			SmartFolder: s.ID,
+		})
+	}
+	return nodes
+}
+
+func findSmartFolder(c *Folder, id string) int {
+	for i, s := range c.SmartFolders {
+		if s.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// addSmartFolder validates s, gives it an id and appends it to the manager
+func addSmartFolder(c *Folder, s *SmartFolder) error {
+	s.ID = ""
+	if err := s.validate(c); err != nil {
+		return err
+	}
+	highest := 0
+	for _, existing := range c.SmartFolders {
+		if n, err := strconv.Atoi(existing.ID); err == nil && n > highest {
+			highest = n
+		}
+	}
+	s.ID = strconv.Itoa(highest + 1)
+	c.SmartFolders = append(c.SmartFolders, s)
+	return nil
+}
+
+// updateSmartFolder replaces smart folder id, keeping the id
+func updateSmartFolder(c *Folder, id string, s *SmartFolder) error {
+	i := findSmartFolder(c, id)
+	if i < 0 {
+		return fmt.Errorf("no smart folder with id %q", id)
+	}
+	s.ID = id
+	if err := s.validate(c); err != nil {
+		return err
+	}
+	c.SmartFolders[i] = s
+	return nil
+}
+
+func removeSmartFolder(c *Folder, id string) bool {
+	i := findSmartFolder(c, id)
+	if i < 0 {
+		return false
+	}
+	c.SmartFolders = append(c.SmartFolders[:i], c.SmartFolders[i+1:]...)
+	return true
+}
+
+func smartFoldersHandler(w http.ResponseWriter, r *http.Request) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	c := findComposite(r.URL.Query().Get("name"))
+	if c == nil {
+		http.Error(w, "No smart manager with that name", http.StatusBadRequest)
+		return
+	}
+	folders := c.SmartFolders
+	if folders == nil {
+		folders = []*SmartFolder{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(folders); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// smartFolderOperation decodes the smart folder body and runs op
+func smartFolderOperation(w http.ResponseWriter, r *http.Request, op func(c *Folder, s *SmartFolder) error) {
+	var folder SmartFolder
+	if err := json.NewDecoder(r.Body).Decode(&folder); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	c := findComposite(r.URL.Query().Get("name"))
+	if c == nil {
+		http.Error(w, "No smart manager with that name", http.StatusBadRequest)
+		return
+	}
+	if err := op(c, &folder); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	queueCompositeSave(c)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(folder); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// addSmartFolderHandler takes the smart folder as json body
+func addSmartFolderHandler(w http.ResponseWriter, r *http.Request) {
+	smartFolderOperation(w, r, addSmartFolder)
+}
+
+// updateSmartFolderHandler replaces the smart folder ?id= with the json body
+func updateSmartFolderHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	smartFolderOperation(w, r, func(c *Folder, s *SmartFolder) error {
+		return updateSmartFolder(c, id, s)
+	})
+}
+
+func removeSmartFolderHandler(w http.ResponseWriter, r *http.Request) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	c := findComposite(r.URL.Query().Get("name"))
+	if c == nil || !removeSmartFolder(c, r.URL.Query().Get("id")) {
+		w.Write([]byte("false"))
+		return
+	}
+	queueCompositeSave(c)
+	w.Write([]byte("true"))
+}
@@ -0,0 +1,181 @@
+package filesystem
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/COS301-SE-2025/Smart-File-Manager/golang/client/protos"
+)
+
+func smartManager(t *testing.T) (*Folder, string) {
+	t.Helper()
+	tmp := chdirTemp(t)
+	root := filepath.Join(tmp, "smart")
+	write := func(rel string, mod time.Time) {
+		p := filepath.Join(root, rel)
+		os.MkdirAll(filepath.Dir(p), 0755)
+		os.WriteFile(p, []byte("x"), 0644)
+		os.Chtimes(p, mod, mod)
+	}
+	now := time.Now()
+	write("scans/receipt.pdf", now)
+	write("scans/old.pdf", now.AddDate(-1, 0, 0))
+	write("tax/return.PDF", now)
+	write("notes.txt", now)
+
+	c, err := ConvertToObject("smart", root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tax := c.GetSubfolder(filepath.Join(root, "tax"))
+	tax.AddTagToSelf("", "finance")
+	tax.SetTagInheritance("finance", true)
+	c.GetFile(filepath.Join(root, "notes.txt")).Keywords = []*pb.Keyword{{Keyword: "meeting", Score: 2}}
+	return c, root
+}
+
+func smartFolderNames(c *Folder, s *SmartFolder) []string {
+	var names []string
+	for _, f := range s.files(c) {
+		names = append(names, f.Name)
+	}
+	return names
+}
+
+func TestSmartFolder_Conditions(t *testing.T) {
+	c, _ := smartManager(t)
+	cases := []struct {
+		folder SmartFolder
+		want   string
+	}{
+		{SmartFolder{Untagged: true, Type: "pdf", ModifiedSince: "this month"}, "receipt.pdf"},
+		{SmartFolder{NameGlob: "*.pdf"}, "old.pdf receipt.pdf return.PDF"},
+		{SmartFolder{Tags: []string{"finance"}}, "return.PDF"},
+		{SmartFolder{Keywords: []string{"meet"}}, "notes.txt"},
+		{SmartFolder{Type: "pdf", ModifiedBefore: "30d"}, "old.pdf"},
+		{SmartFolder{Type: "documents", ModifiedSince: "2000-01-01"}, "notes.txt old.pdf receipt.pdf return.PDF"},
+	}
+	for _, tc := range cases {
+		if got := strings.Join(smartFolderNames(c, &tc.folder), " "); got != tc.want {
+			t.Errorf("%+v: got %q, want %q", tc.folder, got, tc.want)
+		}
+	}
+}
+
+func TestSmartFolder_Validate(t *testing.T) {
+	c, _ := smartManager(t)
+	addSmartFolder(c, &SmartFolder{Name: "PDFs", Type: "pdf"})
+	for _, s := range []SmartFolder{
+		{Name: "empty"},
+		{Type: "pdf"},
+		{Name: "pdfs", Type: "pdf"},
+		{Name: "Scans", Type: "pdf"},
+		{Name: "bad", NameGlob: "[x"},
+		{Name: "bad", ModifiedSince: "last tuesday"},
+		{Name: "bad", Untagged: true, Tags: []string{"finance"}},
+	} {
+		if err := s.validate(c); err == nil {
+			t.Errorf("expected %+v to be rejected", s)
+		}
+	}
+}
+
+func TestPeriodStart(t *testing.T) {
+	now := time.Date(2025, 3, 13, 15, 4, 0, 0, time.UTC) // a thursday
+	for period, want := range map[string]string{"today": "2025-03-13", "this week": "2025-03-10", "this month": "2025-03-01", "this year": "2025-01-01"} {
+		start, ok := periodStart(period, now)
+		if !ok || start.Format("2006-01-02") != want {
+			t.Errorf("%s: got %v, want %s", period, start, want)
+		}
+	}
+}
+
+func TestSmartFolderNodes_FollowTree(t *testing.T) {
+	c, root := smartManager(t)
+	addSmartFolder(c, &SmartFolder{Name: "Untagged PDFs this month", Untagged: true, Type: "pdf", ModifiedSince: "this month"})
+
+	nodes := smartFolderNodes(c)
+	if len(nodes) != 1 || !nodes[0].IsFolder || nodes[0].SmartFolder != "1" || nodes[0].Path != "" {
+		t.Fatalf("unexpected virtual folder %+v", nodes)
+	}
+	if len(nodes[0].Children) != 1 || nodes[0].Children[0].Path != filepath.Join(root, "scans", "receipt.pdf") {
+		t.Fatalf("unexpected contents %+v", nodes[0].Children)
+	}
+
+	// tagging the file takes it out, a new file comes in
+	receipt := c.GetFile(filepath.Join(root, "scans", "receipt.pdf"))
+	receipt.Tags = append(receipt.Tags, "paid")
+	os.WriteFile(filepath.Join(root, "invoice.pdf"), []byte("x"), 0644)
+	c.AddFile(&File{Name: "invoice.pdf", Path: filepath.Join(root, "invoice.pdf")})
+	nodes = smartFolderNodes(c)
+	if len(nodes[0].Children) != 1 || nodes[0].Children[0].Name != "invoice.pdf" {
+		t.Fatalf("smart folder should follow the tree, got %+v", nodes[0].Children)
+	}
+}
+
+func TestSmartFolder_FollowsTagRenameAndDelete(t *testing.T) {
+	c, _ := smartManager(t)
+	addSmartFolder(c, &SmartFolder{Name: "Finance", Tags: []string{"finance"}})
+	addSmartFolder(c, &SmartFolder{Name: "Finance PDFs", Tags: []string{"finance"}, Type: "pdf"})
+
+	renameTagPrefix(c, "finance", "money")
+	if got := strings.Join(smartFolderNames(c, c.SmartFolders[0]), " "); got != "return.PDF" || c.SmartFolders[1].Tags[0] != "money" {
+		t.Fatalf("smart folders should follow the rename, got %q %v", got, c.SmartFolders[1].Tags)
+	}
+
+	// the tag only folder has nothing left to filter on, the other keeps its type
+	deleteTag(c, "money")
+	if len(c.SmartFolders) != 1 || c.SmartFolders[0].Name != "Finance PDFs" || len(c.SmartFolders[0].Tags) != 0 {
+		t.Fatalf("unexpected smart folders after delete %+v", c.SmartFolders)
+	}
+}
+
+func TestSmartFolderHandlers_PersistUpdateRemove(t *testing.T) {
+	c, root := smartManager(t)
+	orig := Composites
+	defer func() { Composites = orig }()
+	Composites = []*Folder{c}
+
+	rr := httptest.NewRecorder()
+	addSmartFolderHandler(rr, httptest.NewRequest("POST", "/addSmartFolder?name=smart", strings.NewReader(`{"name":"Daily","untagged":true,"type":"pdf","modifiedSince":"this month"}`)))
+	var added SmartFolder
+	if err := json.NewDecoder(rr.Body).Decode(&added); err != nil || added.ID != "1" {
+		t.Fatalf("unexpected add response %+v %v", added, err)
+	}
+
+	rr = httptest.NewRecorder()
+	updateSmartFolderHandler(rr, httptest.NewRequest("POST", "/updateSmartFolder?name=smart&id=1", strings.NewReader(`{"name":"Finance","tags":["finance"]}`)))
+	if rr.Code != 200 || c.SmartFolders[0].Name != "Finance" || c.SmartFolders[0].ID != "1" {
+		t.Fatalf("update failed: %d %s", rr.Code, rr.Body.String())
+	}
+
+	saveCompositeDetails(c)
+	stored := readStoredTree(t, "smart")
+	fresh, _ := ConvertToObject("smart", root)
+	mergeDirectoryTreeToComposite(fresh, &stored)
+	if len(fresh.SmartFolders) != 1 || fresh.SmartFolders[0].Tags[0] != "finance" {
+		t.Fatalf("smart folders not restored: %+v", fresh.SmartFolders)
+	}
+	for _, n := range stored.Children {
+		if n.SmartFolder != "" {
+			t.Fatalf("virtual folders must not be stored as tree nodes")
+		}
+	}
+
+	rr = httptest.NewRecorder()
+	updateSmartFolderHandler(rr, httptest.NewRequest("POST", "/updateSmartFolder?name=smart&id=1", strings.NewReader(`{"name":"Finance"}`)))
+	if rr.Code != 400 {
+		t.Fatalf("expected 400 for a smart folder without conditions, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	removeSmartFolderHandler(rr, httptest.NewRequest("POST", "/removeSmartFolder?name=smart&id=1", nil))
+	if rr.Body.String() != "true" || len(c.SmartFolders) != 0 {
+		t.Fatalf("remove failed: %s", rr.Body.String())
+	}
+}
@@ -0,0 +1,338 @@
+package filesystem
+
+// snapshots are rotating copies of the manager records and every composite's stored
+// metadata (tags, locks, keywords). one is taken before moves, bulk deletes and
+// manager deletion, and once a day. /restoreSnapshot puts a manager's metadata back.
+// each reason rotates on its own, so frequent moves never push out the snapshot
+// taken before a manager was deleted.
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// snapshots kept per reason
+const maxSnapshots = 20
+const dailySnapshotInterval = 24 * time.Hour
+
+var snapshotsDir = filepath.Join("storage", "snapshots")
+
+const snapshotManifestName = "manifest.json"
+const snapshotRecordsName = "managers.json"
+
+type SnapshotInfo struct {
+	ID        string    `json:"id"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"createdAt"`
+	Managers  []string  `json:"managers"`
+}
+
+// createSnapshot copies the current on-disk state into a new snapshot folder and rotates old ones
+func createSnapshot(reason string) (SnapshotInfo, error) {
+	now := time.Now().UTC()
+	info := SnapshotInfo{
+		ID:        now.Format("20060102T150405.000000000") + "-" + sanitizeSnapshotReason(reason),
+		Reason:    reason,
+		CreatedAt: now,
+	}
+
+	dir := filepath.Join(snapshotsDir, info.ID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return info, err
+	}
+
+	// read the records raw, loadManagerRecords deletes the file if it is corrupt
+	var recs []ManagerRecord
+	data, err := os.ReadFile(managersFilePath)
+	if err == nil {
+		if err := json.Unmarshal(data, &recs); err != nil {
+			return info, fmt.Errorf("manager records are not valid json: %w", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, snapshotRecordsName), data, 0644); err != nil {
+			return info, err
+		}
+	} else if !os.IsNotExist(err) {
+		return info, err
+	}
+
+	for _, rec := range recs {
+		src := filepath.Join("storage", rec.Name+".json")
+		compData, err := os.ReadFile(src)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return info, err
+		}
+		if err := os.WriteFile(filepath.Join(dir, rec.Name+".json"), compData, 0644); err != nil {
+			return info, err
+		}
+		info.Managers = append(info.Managers, rec.Name)
+	}
+
+	out, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return info, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, snapshotManifestName), out, 0644); err != nil {
+		return info, err
+	}
+
+	if err := rotateSnapshots(reason, maxSnapshots); err != nil {
+		log.Printf("rotating %s snapshots failed: %v", reason, err)
+	}
+	return info, nil
+}
+
+// snapshotBefore is the best-effort variant used ahead of destructive operations
+func snapshotBefore(reason string) {
+	// the snapshot copies what is on disk, so pending writes go first (caller holds mu)
+	if err := flushPendingSavesLocked(); err != nil {
+		log.Printf("flush before %s snapshot failed: %v", reason, err)
+	}
+	if _, err := createSnapshot(reason); err != nil {
+		log.Printf("snapshot before %s failed: %v", reason, err)
+	}
+}
+
+func sanitizeSnapshotReason(reason string) string {
+	reason = strings.ToLower(strings.TrimSpace(reason))
+	var b strings.Builder
+	for _, r := range reason {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+	if b.Len() == 0 {
+		return "manual"
+	}
+	return b.String()
+}
+
+// listSnapshots returns the snapshots on disk, newest first
+func listSnapshots() ([]SnapshotInfo, error) {
+	entries, err := os.ReadDir(snapshotsDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var snaps []SnapshotInfo
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(snapshotsDir, e.Name(), snapshotManifestName))
+		if err != nil {
+			continue // half written or foreign folder
+		}
+		var info SnapshotInfo
+		if err := json.Unmarshal(data, &info); err != nil {
+			continue
+		}
+		snaps = append(snaps, info)
+	}
+
+	sort.Slice(snaps, func(i, j int) bool {
+		return snaps[i].ID > snaps[j].ID
+	})
+	return snaps, nil
+}
+
+// rotateSnapshots removes all but the newest keep snapshots taken for reason
+func rotateSnapshots(reason string, keep int) error {
+	snaps, err := listSnapshots()
+	if err != nil {
+		return err
+	}
+	var firstErr error
+	kept := 0
+	for _, snap := range snaps {
+		if snap.Reason != reason {
+			continue
+		}
+		if kept < keep {
+			kept++
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(snapshotsDir, snap.ID)); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// snapshotPathPart reports whether s can be used as one path element inside a snapshot
+func snapshotPathPart(s string) bool {
+	return s != "" && s == filepath.Base(s) && !strings.HasPrefix(s, ".")
+}
+
+// loadSnapshotComposite reads one manager's stored tree and record out of a snapshot,
+// only managers the snapshot has a record for can be read
+func loadSnapshotComposite(id, name string) (*DirectoryTreeJson, *ManagerRecord, error) {
+	// ids and names come from the query string, keep them inside the snapshots folder
+	if !snapshotPathPart(id) {
+		return nil, nil, fmt.Errorf("invalid snapshot id %q", id)
+	}
+	if !snapshotPathPart(name) {
+		return nil, nil, fmt.Errorf("invalid manager name %q", name)
+	}
+	dir := filepath.Join(snapshotsDir, id)
+
+	var rec *ManagerRecord
+	if recData, err := os.ReadFile(filepath.Join(dir, snapshotRecordsName)); err == nil {
+		var recs []ManagerRecord
+		if err := json.Unmarshal(recData, &recs); err == nil {
+			for i := range recs {
+				if recs[i].Name == name {
+					rec = &recs[i]
+					break
+				}
+			}
+		}
+	}
+	if rec == nil {
+		return nil, nil, fmt.Errorf("snapshot %s has no manager %s", id, name)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, name+".json"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("snapshot %s has no data for manager %s", id, name)
+	}
+	var tree DirectoryTreeJson
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return nil, nil, err
+	}
+	return &tree, rec, nil
+}
+
+// restoreFromSnapshot re-applies a manager's tags, locks and keywords from a snapshot.
+// a deleted manager is re-created from the snapshot's record first. caller holds mu.
+func restoreFromSnapshot(id, name string) (*Folder, error) {
+	tree, rec, err := loadSnapshotComposite(id, name)
+	if err != nil {
+		return nil, err
+	}
+
+	// keep the current state so the restore itself can be undone
+	snapshotBefore("restore")
+
+	var comp *Folder
+	for _, c := range Composites {
+		if c.Name == name {
+			comp = c
+			break
+		}
+	}
+	if comp == nil {
+		if err := AddManager(rec.Name, rec.Path); err != nil {
+			return nil, fmt.Errorf("could not re-create manager %s: %w", name, err)
+		}
+		comp = Composites[len(Composites)-1]
+	}
+
+	mergeDirectoryTreeToComposite(comp, tree)
+	reconcileWriteProtection(comp)
+	saveCompositeDetails(comp)
+	return comp, nil
+}
+
+// startDailySnapshots takes a snapshot when the newest one is older than a day
+func startDailySnapshots() {
+	check := func() {
+		snaps, err := listSnapshots()
+		if err != nil {
+			log.Printf("daily snapshot check failed: %v", err)
+			return
+		}
+		for _, s := range snaps {
+			if s.Reason == "daily" {
+				if time.Since(s.CreatedAt) < dailySnapshotInterval {
+					return
+				}
+				break
+			}
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		snapshotBefore("daily")
+	}
+
+	go func() {
+		check()
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			check()
+		}
+	}()
+}
+
+func listSnapshotsHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+
+	snaps, err := listSnapshots()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to list snapshots: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	result := []SnapshotInfo{}
+	for _, s := range snaps {
+		if name == "" {
+			result = append(result, s)
+			continue
+		}
+		for _, m := range s.Managers {
+			if m == name {
+				result = append(result, s)
+				break
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+func restoreSnapshotHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	name := r.URL.Query().Get("name")
+	if id == "" || name == "" {
+		http.Error(w, "Missing 'id' or 'name' parameter", http.StatusBadRequest)
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	comp, err := restoreFromSnapshot(id, name)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to restore snapshot: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	children := GoSidecreateDirectoryJSONStructure(comp)
+	root := DirectoryTreeJson{
+		Name:     comp.Name,
+		IsFolder: true,
+		RootPath: comp.Path,
+		Children: children,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(root); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
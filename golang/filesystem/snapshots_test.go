@@ -0,0 +1,206 @@
+package filesystem
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// setupSnapshotManager creates a real manager with one tagged file inside a temp cwd
+func setupSnapshotManager(t *testing.T) (*Folder, string) {
+	t.Helper()
+	tmp := chdirTemp(t)
+
+	origRecords := managersFilePath
+	origComposites := Composites
+	SetManagersFilePath(filepath.Join("storage", "startUpStorageFile.json"))
+	Composites = nil
+	t.Cleanup(func() {
+		SetManagersFilePath(origRecords)
+		Composites = origComposites
+	})
+
+	root := filepath.Join(tmp, "docs")
+	if err := os.MkdirAll(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	filePath := filepath.Join(root, "invoice.txt")
+	if err := os.WriteFile(filePath, []byte("vat"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddManager("snap", root); err != nil {
+		t.Fatalf("AddManager: %v", err)
+	}
+	comp := Composites[0]
+	comp.AddTagToFile(filePath, "finance")
+	comp.LockByPath(filePath)
+	saveCompositeDetails(comp)
+	return comp, filePath
+}
+
+func TestSnapshot_RestoreBringsBackTagsAndLocks(t *testing.T) {
+	comp, filePath := setupSnapshotManager(t)
+
+	snap, err := createSnapshot("manual")
+	if err != nil {
+		t.Fatalf("createSnapshot: %v", err)
+	}
+	if len(snap.Managers) != 1 || snap.Managers[0] != "snap" {
+		t.Fatalf("expected snapshot to contain manager 'snap', got %v", snap.Managers)
+	}
+
+	// simulate a bad bulk removal
+	file := comp.GetFile(filePath)
+	file.RemoveTag("finance")
+	file.Unlock()
+	saveCompositeDetails(comp)
+
+	req := httptest.NewRequest("GET", "/restoreSnapshot?id="+snap.ID+"&name=snap", nil)
+	rr := httptest.NewRecorder()
+	restoreSnapshotHandler(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	file = comp.GetFile(filePath)
+	if len(file.Tags) != 1 || file.Tags[0] != "finance" || !file.Locked {
+		t.Fatalf("restore did not bring back metadata: tags=%v locked=%v", file.Tags, file.Locked)
+	}
+}
+
+func TestSnapshot_RestoreReconcilesWriteProtection(t *testing.T) {
+	comp, filePath := setupSnapshotManager(t)
+	file := comp.GetFile(filePath)
+	file.Unlock()
+	saveCompositeDetails(comp)
+	unlocked, err := createSnapshot("manual")
+	if err != nil {
+		t.Fatalf("createSnapshot: %v", err)
+	}
+
+	setWriteProtection(comp, true)
+	lockPathWithInfo(comp, filePath, &LockInfo{Owner: "ana", LockedAt: time.Now()})
+	saveCompositeDetails(comp)
+	locked, err := createSnapshot("manual")
+	if err != nil {
+		t.Fatalf("createSnapshot: %v", err)
+	}
+	mode := func() os.FileMode {
+		info, err := os.Stat(filePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info.Mode().Perm()
+	}
+	if mode()&writeBits != 0 {
+		t.Fatalf("the locked file should be read-only, got %v", mode())
+	}
+
+	// back to the unlocked state, the file has to become writable again
+	if _, err := restoreFromSnapshot(unlocked.ID, "snap"); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	file = comp.GetFile(filePath)
+	if file.Locked || file.OriginalMode != nil || mode() != 0644 {
+		t.Fatalf("expected an unlocked writable file, got locked=%v original=%v mode=%v", file.Locked, file.OriginalMode, mode())
+	}
+
+	// the snapshot remembers the original mode of a file that is writable now
+	if _, err := restoreFromSnapshot(locked.ID, "snap"); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	file = comp.GetFile(filePath)
+	if !file.Locked || file.OriginalMode == nil || mode()&writeBits != 0 {
+		t.Fatalf("expected a protected file, got locked=%v original=%v mode=%v", file.Locked, file.OriginalMode, mode())
+	}
+	if drift := checkWriteProtection(comp); len(drift) != 0 {
+		t.Fatalf("unexpected drift %+v", drift)
+	}
+}
+
+func TestSnapshot_RestoreRecreatesDeletedManager(t *testing.T) {
+	_, filePath := setupSnapshotManager(t)
+
+	req := httptest.NewRequest("GET", "/deleteManager?name=snap", nil)
+	rr := httptest.NewRecorder()
+	deleteManagerHandler(rr, req)
+	if len(Composites) != 0 {
+		t.Fatalf("expected manager to be deleted")
+	}
+
+	snaps, err := listSnapshots()
+	if err != nil || len(snaps) == 0 {
+		t.Fatalf("expected a snapshot taken before delete, got %v (err %v)", snaps, err)
+	}
+
+	req = httptest.NewRequest("GET", "/restoreSnapshot?id="+snaps[0].ID+"&name=snap", nil)
+	rr = httptest.NewRecorder()
+	restoreSnapshotHandler(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if len(Composites) != 1 {
+		t.Fatalf("expected manager to be re-created, got %d composites", len(Composites))
+	}
+	if tags := Composites[0].GetFile(filePath).Tags; len(tags) != 1 || tags[0] != "finance" {
+		t.Fatalf("expected tags to be restored, got %v", tags)
+	}
+}
+
+func TestSnapshot_ListAndRotate(t *testing.T) {
+	setupSnapshotManager(t)
+
+	deleted, err := createSnapshot("delete manager")
+	if err != nil {
+		t.Fatalf("createSnapshot: %v", err)
+	}
+	for i := 0; i < maxSnapshots+3; i++ {
+		if _, err := createSnapshot("daily"); err != nil {
+			t.Fatalf("createSnapshot: %v", err)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	listSnapshotsHandler(rr, httptest.NewRequest("GET", "/snapshots?name=snap", nil))
+	var snaps []SnapshotInfo
+	if err := json.NewDecoder(rr.Body).Decode(&snaps); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(snaps) != maxSnapshots+1 {
+		t.Fatalf("expected %d daily snapshots and the delete snapshot after rotation, got %d", maxSnapshots, len(snaps))
+	}
+	if snaps[len(snaps)-1].ID != deleted.ID {
+		t.Fatalf("the delete manager snapshot must not be rotated away by daily ones")
+	}
+	for i := 1; i < len(snaps); i++ {
+		if snaps[i-1].ID < snaps[i].ID {
+			t.Fatalf("snapshots not sorted newest first")
+		}
+	}
+}
+
+func TestSnapshot_RejectsPathInID(t *testing.T) {
+	setupSnapshotManager(t)
+
+	if _, err := restoreFromSnapshot("../storage", "snap"); err == nil {
+		t.Fatalf("expected an error for an id outside the snapshots folder")
+	}
+
+	snap, err := createSnapshot("manual")
+	if err != nil {
+		t.Fatalf("createSnapshot: %v", err)
+	}
+	// the manifest and records sit next to the manager files, neither is a manager
+	for _, name := range []string{"../../startUpStorageFile", "manifest", "managers", ".hidden", ""} {
+		if _, err := restoreFromSnapshot(snap.ID, name); err == nil {
+			t.Fatalf("expected an error restoring %q", name)
+		}
+	}
+	if len(Composites) != 1 {
+		t.Fatalf("a failed restore should not add managers, got %d", len(Composites))
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"sync"
+	"time"
 )
 
 type ManagerRecord struct {
@@ -21,6 +22,8 @@ type ManagerRecord struct {
 type startUpResponse struct {
 	ResponseMessage string   `json:"responseMessage"`
 	ManagerNames    []string `json:"managerNames"`
+	// write protected items whose permissions changed behind the app's back, per manager
+	PermissionDrift map[string][]PermissionDrift `json:"permissionDrift,omitempty"`
 }
 
 var managersFilePath = filepath.Join("storage", "startUpStorageFile.json")
@@ -33,6 +36,11 @@ func SetManagersFilePath(p string) {
 // api entry
 func startUpHandler(w http.ResponseWriter, r *http.Request) {
 
+	// composites are rebuilt from storage, unsaved changes must reach it first
+	if err := FlushPendingSaves(); err != nil {
+		fmt.Printf("flush before startUp failed: %v\n", err)
+	}
+
 	Composites = nil
 
 	recs, err := loadManagerRecords()
@@ -51,6 +59,7 @@ func startUpHandler(w http.ResponseWriter, r *http.Request) {
 
 	var (
 		managerNames []string
+		drift        = map[string][]PermissionDrift{}
 		mu           sync.Mutex
 		wg           sync.WaitGroup
 	)
@@ -67,8 +76,28 @@ func startUpHandler(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 
+			// restore tags/locks, following files that moved since the last run
+			populateKeywordsFromStoredJsonFile(composite)
+
+			// tags set by other tools, then rule tags for files that appeared while the app was closed
+			imported := importExternalTags(composite)
+			released := releaseExpiredLocks(composite, time.Now())
+			policed := applyLockPolicies(composite, time.Now())
+			if len(applyTagRules(composite, false)) > 0 || imported || released > 0 || policed > 0 {
+				queueCompositeSave(composite)
+			}
+			// files changed while the app was closed are searchable without a tree load
+			refreshTextIndexInBackground(composite)
+			changedOnDisk := checkWriteProtection(composite)
+			for _, d := range changedOnDisk {
+				fmt.Printf("permission drift in %s: %s %s\n", composite.Name, d.Path, d.Problem)
+			}
+
 			mu.Lock()
 			Composites = append(Composites, composite)
+			if len(changedOnDisk) > 0 {
+				drift[composite.Name] = changedOnDisk
+			}
 
 			managerNames = append(managerNames, composite.Name)
 			mu.Unlock()
@@ -82,6 +111,7 @@ func startUpHandler(w http.ResponseWriter, r *http.Request) {
 	res := startUpResponse{
 		ResponseMessage: "Request successful!, Composites: " + strconv.Itoa(len(managerNames)),
 		ManagerNames:    managerNames,
+		PermissionDrift: drift,
 	}
 	if err := json.NewEncoder(w).Encode(res); err != nil {
 		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
@@ -172,12 +202,15 @@ func RemoveManager(path string) error {
 }
 
 func cleanupOrphanCompositeJSONs(recs []ManagerRecord) error {
+	// the content indexes live in their own directory, they go even when this one is missing
+	indexErr := cleanupOrphanTextIndexes(recs)
+
 	dir := filepath.Dir(managersFilePath)
 
 	entries, err := os.ReadDir(dir)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil
+			return indexErr
 		}
 		return err
 	}
@@ -210,5 +243,9 @@ func cleanupOrphanCompositeJSONs(recs []ManagerRecord) error {
 			}
 		}
 	}
+
+	if firstErr == nil {
+		firstErr = indexErr
+	}
 	return firstErr
 }
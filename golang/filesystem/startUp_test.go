@@ -262,3 +262,39 @@ func TestStartUpHandler_EncodeError(t *testing.T) {
 		t.Errorf("body = %q; want fallback error", w.body.String())
 	}
 }
+
+// Folder tags and locks must survive a restart through /startUp
+func TestStartUpHandler_RestoresFolderMetadata(t *testing.T) {
+	chdirTemp(t)
+	dir := t.TempDir()
+	resetState(t, dir)
+
+	root := t.TempDir()
+	subPath := filepath.Join(root, "contracts")
+	if err := os.MkdirAll(subPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddManager("restart", root); err != nil {
+		t.Fatal(err)
+	}
+	sub := Composites[0].GetSubfolder(subPath)
+	sub.AddTagToSelf("", "legal")
+	Composites[0].LockByPath(subPath)
+	saveCompositeDetails(Composites[0])
+
+	// simulate an app restart
+	Composites = nil
+	rr := httptest.NewRecorder()
+	startUpHandler(rr, httptest.NewRequest(http.MethodGet, "/startUp", nil))
+	if rr.Code != http.StatusOK || len(Composites) != 1 {
+		t.Fatalf("startUp failed: status %d, composites %d", rr.Code, len(Composites))
+	}
+
+	restored := Composites[0].GetSubfolder(subPath)
+	if restored == nil {
+		t.Fatalf("folder missing after restart")
+	}
+	if len(restored.Tags) != 1 || restored.Tags[0] != "legal" || !restored.Locked {
+		t.Fatalf("folder metadata lost after restart: tags=%v locked=%v", restored.Tags, restored.Locked)
+	}
+}
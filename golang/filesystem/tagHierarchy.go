@@ -0,0 +1,255 @@
+package filesystem
+
+// tags can be hierarchical, segments are separated by "/" (client/acme/invoices).
+// a query for a tag matches the tag itself and every descendant of it.
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const tagSeparator = "/"
+
+// TagTreeNode is one segment of the tag hierarchy. Count is the number of files
+// tagged with this tag or any descendant, Direct only counts the exact tag.
+type TagTreeNode struct {
+	Name     string         `json:"name"`
+	Tag      string         `json:"tag"`
+	Count    int            `json:"count"`
+	Direct   int            `json:"direct"`
+	Children []*TagTreeNode `json:"children,omitempty"`
+}
+
+// normalizeTag trims every segment and drops empty ones, "client//acme/" -> "client/acme"
+func normalizeTag(tag string) string {
+	parts := strings.Split(strings.TrimSpace(tag), tagSeparator)
+	cleaned := parts[:0]
+	for _, p := range parts {
+		p = strings.TrimSpace(p)
+		if p != "" {
+			cleaned = append(cleaned, p)
+		}
+	}
+	return strings.Join(cleaned, tagSeparator)
+}
+
+// tagMatches reports whether tag is query or one of its descendants
+func tagMatches(tag, query string) bool {
+	tag = normalizeTag(tag)
+	query = normalizeTag(query)
+	if query == "" {
+		return false
+	}
+	return tag == query || strings.HasPrefix(tag, query+tagSeparator)
+}
+
+// hasMatchingTag reports whether any of tags matches query hierarchically
+func hasMatchingTag(tags []string, query string) bool {
+	for _, t := range tags {
+		if tagMatches(t, query) {
+			return true
+		}
+	}
+	return false
+}
+
+// tagFilter returns a search filter for the optional tag parameter, nil means no filtering.
+// tags inherited from folders count as well.
+func tagFilter(c *Folder, query string) func(*File) bool {
+	query = normalizeTag(query)
+	if query == "" {
+		return nil
+	}
+	inherited := inheritedFileTags(c)
+	return func(f *File) bool {
+		return hasMatchingTag(f.Tags, query) || hasMatchingTag(inherited[f], query)
+	}
+}
+
+// findFilesByTag returns every file carrying query or a descendant of it, directly or inherited
+func findFilesByTag(c *Folder, query string) []*File {
+	filter := tagFilter(c, query)
+	if filter == nil {
+		return nil
+	}
+	var found []*File
+	var walk func(f *Folder)
+	walk = func(f *Folder) {
+		for _, file := range f.Files {
+			if filter(file) {
+				found = append(found, file)
+			}
+		}
+		for _, sub := range f.Subfolders {
+			walk(sub)
+		}
+	}
+	walk(c)
+	return found
+}
+
+// buildTagTree groups every file tag in the composite into a hierarchy with counts
+func buildTagTree(c *Folder) []*TagTreeNode {
+	root := &TagTreeNode{}
+	index := map[string]*TagTreeNode{}
+
+	var walk func(f *Folder)
+	walk = func(f *Folder) {
+		for _, file := range f.Files {
+			// a file counts once per node even if several of its tags share a prefix
+			counted := map[string]struct{}{}
+			for _, raw := range file.Tags {
+				tag := normalizeTag(raw)
+				if tag == "" {
+					continue
+				}
+				segments := strings.Split(tag, tagSeparator)
+				parent := root
+				for i := range segments {
+					full := strings.Join(segments[:i+1], tagSeparator)
+					node, ok := index[full]
+					if !ok {
+						node = &TagTreeNode{Name: segments[i], Tag: full}
+						index[full] = node
+						parent.Children = append(parent.Children, node)
+					}
+					if _, seen := counted[full]; !seen {
+						node.Count++
+						counted[full] = struct{}{}
+					}
+					parent = node
+				}
+				parent.Direct++
+			}
+		}
+		for _, sub := range f.Subfolders {
+			walk(sub)
+		}
+	}
+	walk(c)
+
+	sortTagTree(root.Children)
+	return root.Children
+}
+
+func sortTagTree(nodes []*TagTreeNode) {
+	sort.Slice(nodes, func(i, j int) bool {
+		return strings.ToLower(nodes[i].Name) < strings.ToLower(nodes[j].Name)
+	})
+	for _, n := range nodes {
+		sortTagTree(n.Children)
+	}
+}
+
+// renameTagInList applies a prefix rename to one tag list, keeping it free of duplicates
+func renameTagInList(tags []string, from, to string) ([]string, bool) {
+	changed := false
+	out := make([]string, 0, len(tags))
+	seen := make(map[string]struct{}, len(tags))
+	for _, t := range tags {
+		if tagMatches(t, from) {
+			t = to + normalizeTag(t)[len(from):]
+			changed = true
+		}
+		if _, dup := seen[t]; dup {
+			continue
+		}
+		seen[t] = struct{}{}
+		out = append(out, t)
+	}
+	return out, changed
+}
+
+// renameTagPrefix renames from to to on every file and folder, descendants included
+// (client/acme -> clients/acme also turns client/acme/invoices into clients/acme/invoices)
+func renameTagPrefix(c *Folder, from, to string) int {
+	from = normalizeTag(from)
+	to = normalizeTag(to)
+	if from == "" || to == "" || from == to {
+		return 0
+	}
+
+	changed := 0
+	var walk func(f *Folder)
+	walk = func(f *Folder) {
+		if tags, ok := renameTagInList(f.Tags, from, to); ok {
+			f.Tags = tags
+			changed++
+		}
+		// inheritance is kept per tag name, it follows the rename
+		f.InheritTags, _ = renameTagInList(f.InheritTags, from, to)
+		for _, file := range f.Files {
+			if tags, ok := renameTagInList(file.Tags, from, to); ok {
+				file.Tags = tags
+				changed++
+			}
+			file.RuleTags, _ = renameTagInList(file.RuleTags, from, to)
+		}
+		for _, sub := range f.Subfolders {
+			walk(sub)
+		}
+	}
+	walk(c)
+
+	// rules keep tagging and smart folders keep filtering under the new name
+	for _, rule := range c.TagRules {
+		if tags, ok := renameTagInList([]string{rule.Tag}, from, to); ok {
+			rule.Tag = tags[0]
+		}
+	}
+	for _, sf := range c.SmartFolders {
+		sf.Tags, _ = renameTagInList(sf.Tags, from, to)
+	}
+	return changed
+}
+
+func tagTreeHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	mu.Lock()
+	defer mu.Unlock()
+
+	for _, c := range Composites {
+		if c.Name == name {
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(buildTagTree(c)); err != nil {
+				http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+			}
+			return
+		}
+	}
+	http.Error(w, "No smart manager with that name", http.StatusBadRequest)
+}
+
+func filesByTagHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	tag := r.URL.Query().Get("tag")
+	if name == "" || normalizeTag(tag) == "" {
+		http.Error(w, "Missing 'name' or 'tag' parameter", http.StatusBadRequest)
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+
+	for _, c := range Composites {
+		if c.Name == name {
+			returnList := []returnStruct{}
+			inherited := inheritedFileTags(c)
+			for _, file := range findFilesByTag(c, tag) {
+				returnList = append(returnList, returnStruct{
+					FilePath:      file.Path,
+					FileName:      file.Name,
+					FileTags:      file.Tags,
+					InheritedTags: inherited[file],
+				})
+			}
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(returnList); err != nil {
+				http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+			}
+			return
+		}
+	}
+	http.Error(w, "No smart manager with that name", http.StatusBadRequest)
+}
@@ -0,0 +1,167 @@
+package filesystem
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func hierarchyFolder() *Folder {
+	return &Folder{
+		Name: "tags",
+		Path: "/tags",
+		Files: []*File{
+			{Name: "inv1.pdf", Path: "/tags/inv1.pdf", Tags: []string{"client/acme/invoices"}},
+			{Name: "inv2.pdf", Path: "/tags/inv2.pdf", Tags: []string{"client/acme/invoices", "client/acme/contracts"}},
+		},
+		Subfolders: []*Folder{
+			{
+				Name: "other",
+				Path: "/tags/other",
+				Tags: []string{"client/acme"},
+				Files: []*File{
+					{Name: "beta.doc", Path: "/tags/other/beta.doc", Tags: []string{"client/beta"}},
+					{Name: "acmeish.doc", Path: "/tags/other/acmeish.doc", Tags: []string{"client/acmeish"}},
+				},
+			},
+		},
+	}
+}
+
+func TestNormalizeTag(t *testing.T) {
+	cases := map[string]string{
+		"client/acme":         "client/acme",
+		" client // acme / ":  "client/acme",
+		"/leading/and/trail/": "leading/and/trail",
+		"flat":                "flat",
+		"///":                 "",
+	}
+	for in, want := range cases {
+		if got := normalizeTag(in); got != want {
+			t.Errorf("normalizeTag(%q) = %q; want %q", in, got, want)
+		}
+	}
+}
+
+func TestTagMatches_PrefixIsSegmentAware(t *testing.T) {
+	if !tagMatches("client/acme/invoices", "client/acme") {
+		t.Errorf("descendant should match")
+	}
+	if !tagMatches("client/acme", "client/acme") {
+		t.Errorf("exact tag should match")
+	}
+	if tagMatches("client/acmeish", "client/acme") {
+		t.Errorf("partial segment must not match")
+	}
+	if tagMatches("client", "client/acme") {
+		t.Errorf("ancestor must not match a more specific query")
+	}
+}
+
+func TestFindFilesByTag_IncludesDescendants(t *testing.T) {
+	files := findFilesByTag(hierarchyFolder(), "client/acme")
+	if len(files) != 2 {
+		t.Fatalf("expected 2 files under client/acme, got %d", len(files))
+	}
+}
+
+func TestBuildTagTree_CountsFilesOncePerNode(t *testing.T) {
+	tree := buildTagTree(hierarchyFolder())
+	if len(tree) != 1 || tree[0].Tag != "client" {
+		t.Fatalf("expected single root 'client', got %+v", tree)
+	}
+	client := tree[0]
+	if client.Count != 4 {
+		t.Errorf("expected 4 files under client, got %d", client.Count)
+	}
+
+	var acme *TagTreeNode
+	for _, c := range client.Children {
+		if c.Tag == "client/acme" {
+			acme = c
+		}
+	}
+	if acme == nil {
+		t.Fatalf("missing client/acme node")
+	}
+	// inv2 has two acme tags but is one file
+	if acme.Count != 2 || acme.Direct != 0 {
+		t.Errorf("client/acme: count=%d direct=%d; want 2 and 0", acme.Count, acme.Direct)
+	}
+	if len(acme.Children) != 2 || acme.Children[0].Name != "contracts" {
+		t.Errorf("expected sorted children contracts, invoices; got %+v", acme.Children)
+	}
+}
+
+func TestRenameTagPrefix_Cascades(t *testing.T) {
+	f := hierarchyFolder()
+	// an item already holding the target tag must not end up with a duplicate
+	f.Files[0].Tags = append(f.Files[0].Tags, "customers/acme/invoices")
+
+	changed := renameTagPrefix(f, "client/acme", "customers/acme")
+	if changed != 3 {
+		t.Fatalf("expected 3 changed items (2 files + 1 folder), got %d", changed)
+	}
+	if got := f.Files[0].Tags; len(got) != 1 || got[0] != "customers/acme/invoices" {
+		t.Errorf("unexpected tags after rename: %v", got)
+	}
+	if got := f.Subfolders[0].Tags; got[0] != "customers/acme" {
+		t.Errorf("folder tag not renamed: %v", got)
+	}
+	if got := f.Subfolders[0].Files[1].Tags; got[0] != "client/acmeish" {
+		t.Errorf("sibling prefix must be untouched: %v", got)
+	}
+}
+
+func TestBulkAddTags_NormalisesAndKeepsImpliedTags(t *testing.T) {
+	f := hierarchyFolder()
+	err := BulkAddTags(f, []TagsStruct{{
+		FilePath: "/tags/inv1.pdf",
+		Tags:     []string{"client/acme", " finance // vat ", "client/acme/invoices"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := f.Files[0].Tags
+	if strings.Join(got, " ") != "client/acme/invoices client/acme finance/vat" {
+		t.Fatalf("expected the parent tag stored and the new tag normalised, got %v", got)
+	}
+
+	// the explicit parent outlives the specific tag, the tree still counts the file once
+	for _, node := range buildTagTree(f) {
+		if node.Tag == "client" && node.Children[0].Count != 2 {
+			t.Fatalf("client/acme should count inv1.pdf once, got %+v", node.Children[0])
+		}
+	}
+	f.Files[0].RemoveTag("client/acme/invoices")
+	if !hasMatchingTag(f.Files[0].Tags, "client/acme") {
+		t.Fatalf("removing the specific tag must keep the explicit parent, got %v", f.Files[0].Tags)
+	}
+}
+
+func TestSearchHandler_TagFilterUsesHierarchy(t *testing.T) {
+	orig := Composites
+	defer func() { Composites = orig }()
+	Composites = []*Folder{hierarchyFolder()}
+
+	rr := httptest.NewRecorder()
+	SearchHandler(rr, httptest.NewRequest("GET", "/search?compositeName=tags&searchText=inv&tag=client/acme", nil))
+	var resp DirectoryTreeJson
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Children) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(resp.Children))
+	}
+
+	rr = httptest.NewRecorder()
+	SearchHandler(rr, httptest.NewRequest("GET", "/search?compositeName=tags&searchText=inv&tag=client/beta", nil))
+	resp = DirectoryTreeJson{}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Children) != 0 {
+		t.Fatalf("expected no results for client/beta, got %d", len(resp.Children))
+	}
+}
@@ -0,0 +1,344 @@
+package filesystem
+
+// every composite keeps a registry of its tag vocabulary (colour, description). usage
+// counts are derived from the tree so they can never drift. rename, merge and delete
+// change the tree and the registry together and are written in one save.
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+type TagDefinition struct {
+	Name        string `json:"name"`
+	Colour      string `json:"colour,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+type TagUsage struct {
+	Name        string `json:"name"`
+	Count       int    `json:"count"`
+	Colour      string `json:"colour,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+var tagColourPattern = regexp.MustCompile(`^#([0-9a-fA-F]{6}|[0-9a-fA-F]{3})$`)
+
+// findTagDefinition returns the registry entry for tag, or nil
+func (f *Folder) findTagDefinition(tag string) *TagDefinition {
+	for _, def := range f.TagDefinitions {
+		if def.Name == tag {
+			return def
+		}
+	}
+	return nil
+}
+
+// defineTag creates or updates a registry entry
+func defineTag(c *Folder, tag, colour, description string) (*TagDefinition, error) {
+	tag = normalizeTag(tag)
+	if tag == "" {
+		return nil, fmt.Errorf("tag name is empty")
+	}
+	if colour != "" && !tagColourPattern.MatchString(colour) {
+		return nil, fmt.Errorf("invalid colour %q, expected #RRGGBB", colour)
+	}
+	def := c.findTagDefinition(tag)
+	if def == nil {
+		def = &TagDefinition{Name: tag}
+		c.TagDefinitions = append(c.TagDefinitions, def)
+	}
+	def.Colour = colour
+	def.Description = description
+	return def, nil
+}
+
+// tagUsage lists every tag in use or defined, with the number of files and folders carrying it
+func tagUsage(c *Folder) []TagUsage {
+	counts := map[string]int{}
+	var walk func(f *Folder, isRoot bool)
+	walk = func(f *Folder, isRoot bool) {
+		if !isRoot {
+			for _, t := range f.Tags {
+				counts[normalizeTag(t)]++
+			}
+		}
+		for _, file := range f.Files {
+			for _, t := range file.Tags {
+				counts[normalizeTag(t)]++
+			}
+		}
+		for _, sub := range f.Subfolders {
+			walk(sub, false)
+		}
+	}
+	walk(c, true)
+
+	for _, def := range c.TagDefinitions {
+		if _, ok := counts[def.Name]; !ok {
+			counts[def.Name] = 0
+		}
+	}
+
+	usage := make([]TagUsage, 0, len(counts))
+	for name, n := range counts {
+		if name == "" {
+			continue
+		}
+		u := TagUsage{Name: name, Count: n}
+		if def := c.findTagDefinition(name); def != nil {
+			u.Colour = def.Colour
+			u.Description = def.Description
+		}
+		usage = append(usage, u)
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		return strings.ToLower(usage[i].Name) < strings.ToLower(usage[j].Name)
+	})
+	return usage
+}
+
+// renameRegistryPrefix moves registry entries under from to to, an existing entry at the target wins
+func renameRegistryPrefix(c *Folder, from, to string) {
+	kept := c.TagDefinitions[:0]
+	seen := map[string]struct{}{}
+	for _, def := range c.TagDefinitions {
+		if !tagMatches(def.Name, from) {
+			seen[def.Name] = struct{}{}
+		}
+	}
+	for _, def := range c.TagDefinitions {
+		if tagMatches(def.Name, from) {
+			renamed := to + def.Name[len(from):]
+			if _, exists := seen[renamed]; exists {
+				continue
+			}
+			def.Name = renamed
+			seen[renamed] = struct{}{}
+		}
+		kept = append(kept, def)
+	}
+	c.TagDefinitions = kept
+}
+
+// renameTag renames a tag (and its descendants) everywhere. the target must not exist yet, use mergeTags for that.
+func renameTag(c *Folder, from, to string) (int, error) {
+	from = normalizeTag(from)
+	to = normalizeTag(to)
+	if from == "" || to == "" {
+		return 0, fmt.Errorf("tag name is empty")
+	}
+	if from == to {
+		return 0, nil
+	}
+	if tagMatches(to, from) {
+		return 0, fmt.Errorf("cannot rename %q into its own descendant %q", from, to)
+	}
+	for _, u := range tagUsage(c) {
+		if u.Name == to {
+			return 0, fmt.Errorf("tag %q already exists, merge the tags instead", to)
+		}
+	}
+
+	changed := renameTagPrefix(c, from, to)
+	renameRegistryPrefix(c, from, to)
+	return changed, nil
+}
+
+// mergeTags folds from (and its descendants) into into, keeping into's registry entry
+func mergeTags(c *Folder, from, into string) (int, error) {
+	from = normalizeTag(from)
+	into = normalizeTag(into)
+	if from == "" || into == "" {
+		return 0, fmt.Errorf("tag name is empty")
+	}
+	if from == into {
+		return 0, nil
+	}
+	if tagMatches(into, from) {
+		return 0, fmt.Errorf("cannot merge %q into its own descendant %q", from, into)
+	}
+
+	changed := renameTagPrefix(c, from, into)
+	renameRegistryPrefix(c, from, into)
+	return changed, nil
+}
+
+// deleteTag removes a tag and its descendants from every file, folder and the registry
+func deleteTag(c *Folder, tag string) (int, error) {
+	tag = normalizeTag(tag)
+	if tag == "" {
+		return 0, fmt.Errorf("tag name is empty")
+	}
+
+	strip := func(tags []string) ([]string, bool) {
+		out := tags[:0]
+		removed := false
+		for _, t := range tags {
+			if tagMatches(t, tag) {
+				removed = true
+				continue
+			}
+			out = append(out, t)
+		}
+		return out, removed
+	}
+
+	changed := 0
+	var walk func(f *Folder)
+	walk = func(f *Folder) {
+		if tags, ok := strip(f.Tags); ok {
+			f.Tags = tags
+			changed++
+		}
+		f.InheritTags, _ = strip(f.InheritTags)
+		for _, file := range f.Files {
+			if tags, ok := strip(file.Tags); ok {
+				file.Tags = tags
+				changed++
+			}
+			file.RuleTags, _ = strip(file.RuleTags)
+		}
+		for _, sub := range f.Subfolders {
+			walk(sub)
+		}
+	}
+	walk(c)
+
+	kept := c.TagDefinitions[:0]
+	for _, def := range c.TagDefinitions {
+		if !tagMatches(def.Name, tag) {
+			kept = append(kept, def)
+		}
+	}
+	c.TagDefinitions = kept
+
+	// a rule would bring the deleted tag straight back
+	rules := c.TagRules[:0]
+	for _, rule := range c.TagRules {
+		if !tagMatches(rule.Tag, tag) {
+			rules = append(rules, rule)
+		}
+	}
+	c.TagRules = rules
+
+	// smart folders stop filtering on the tag, one left without conditions goes
+	folders := c.SmartFolders[:0]
+	for _, sf := range c.SmartFolders {
+		if tags, ok := strip(sf.Tags); ok {
+			sf.Tags = tags
+			if _, err := sf.compile(); err != nil {
+				continue
+			}
+		}
+		folders = append(folders, sf)
+	}
+	c.SmartFolders = folders
+	return changed, nil
+}
+
+// findComposite returns the composite with the given name, caller holds mu
+func findComposite(name string) *Folder {
+	for _, c := range Composites {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func listTagsHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	mu.Lock()
+	defer mu.Unlock()
+
+	c := findComposite(name)
+	if c == nil {
+		http.Error(w, "No smart manager with that name", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(tagUsage(c)); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+func defineTagHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	mu.Lock()
+	defer mu.Unlock()
+
+	c := findComposite(q.Get("name"))
+	if c == nil {
+		http.Error(w, "No smart manager with that name", http.StatusBadRequest)
+		return
+	}
+	def, err := defineTag(c, q.Get("tag"), q.Get("colour"), q.Get("description"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := saveCompositeDetails(c); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to save tag registry: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(def); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// tagRegistryOperation runs a registry wide change and writes tree and registry in one save.
+// locked items carrying tag refuse the change unless force=true.
+func tagRegistryOperation(w http.ResponseWriter, r *http.Request, tag string, op func(c *Folder) (int, error)) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	c := findComposite(r.URL.Query().Get("name"))
+	if c == nil {
+		http.Error(w, "No smart manager with that name", http.StatusBadRequest)
+		return
+	}
+	if !guardLocks(w, r, "tag change", lockedCarryingTag(c, tag)) {
+		return
+	}
+	changed, err := op(c)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := saveCompositeDetails(c); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to save tags: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Changed int        `json:"changed"`
+		Tags    []TagUsage `json:"tags"`
+	}{changed, tagUsage(c)})
+}
+
+func renameTagHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	tagRegistryOperation(w, r, q.Get("from"), func(c *Folder) (int, error) {
+		return renameTag(c, q.Get("from"), q.Get("to"))
+	})
+}
+
+func mergeTagsHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	tagRegistryOperation(w, r, q.Get("from"), func(c *Folder) (int, error) {
+		return mergeTags(c, q.Get("from"), q.Get("into"))
+	})
+}
+
+func deleteTagHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	tagRegistryOperation(w, r, q.Get("tag"), func(c *Folder) (int, error) {
+		return deleteTag(c, q.Get("tag"))
+	})
+}
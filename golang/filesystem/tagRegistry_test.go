@@ -0,0 +1,196 @@
+package filesystem
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func usageCount(usage []TagUsage, name string) (int, bool) {
+	for _, u := range usage {
+		if u.Name == name {
+			return u.Count, true
+		}
+	}
+	return 0, false
+}
+
+func TestTagUsage_CountsFilesFoldersAndDefinitions(t *testing.T) {
+	f := hierarchyFolder()
+	if _, err := defineTag(f, "archive", "#aabbcc", "old stuff"); err != nil {
+		t.Fatal(err)
+	}
+
+	usage := tagUsage(f)
+	if n, _ := usageCount(usage, "client/acme/invoices"); n != 2 {
+		t.Errorf("client/acme/invoices: expected 2, got %d", n)
+	}
+	if n, _ := usageCount(usage, "client/acme"); n != 1 {
+		t.Errorf("client/acme (folder tag): expected 1, got %d", n)
+	}
+	if n, ok := usageCount(usage, "archive"); !ok || n != 0 {
+		t.Errorf("defined but unused tag should be listed with 0, got %d (listed %v)", n, ok)
+	}
+}
+
+func TestDefineTag_RejectsInvalidColour(t *testing.T) {
+	f := hierarchyFolder()
+	if _, err := defineTag(f, "x", "red", ""); err == nil {
+		t.Fatal("expected invalid colour to be rejected")
+	}
+	if _, err := defineTag(f, " / ", "", ""); err == nil {
+		t.Fatal("expected empty tag to be rejected")
+	}
+	def, err := defineTag(f, "x", "#fff", "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := defineTag(f, "x", "#000", "second"); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.TagDefinitions) != 1 || def.Colour != "#000" || def.Description != "second" {
+		t.Fatalf("redefining should update in place, got %+v", f.TagDefinitions)
+	}
+}
+
+func TestRenameTag_RefusesExistingTarget(t *testing.T) {
+	f := hierarchyFolder()
+	if _, err := renameTag(f, "client/acme/invoices", "client/beta"); err == nil {
+		t.Fatal("expected rename onto an existing tag to fail")
+	}
+	if _, err := renameTag(f, "client", "client/sub"); err == nil {
+		t.Fatal("expected rename into own descendant to fail")
+	}
+}
+
+func TestRenameTag_MovesRegistryEntries(t *testing.T) {
+	f := hierarchyFolder()
+	defineTag(f, "client/acme", "#123456", "acme corp")
+	defineTag(f, "client/acme/invoices", "#654321", "")
+
+	if _, err := renameTag(f, "client/acme", "customers/acme"); err != nil {
+		t.Fatal(err)
+	}
+	if f.findTagDefinition("customers/acme") == nil || f.findTagDefinition("customers/acme/invoices") == nil {
+		t.Fatalf("registry entries should follow the rename, got %+v", f.TagDefinitions)
+	}
+	if f.findTagDefinition("client/acme") != nil {
+		t.Fatal("old registry entry should be gone")
+	}
+	if f.Files[0].Tags[0] != "customers/acme/invoices" {
+		t.Fatalf("file tag not renamed: %v", f.Files[0].Tags)
+	}
+}
+
+func TestMergeTags_TargetDefinitionWins(t *testing.T) {
+	f := hierarchyFolder()
+	defineTag(f, "client/acmeish", "#111111", "typo")
+	defineTag(f, "client/acme", "#222222", "real")
+
+	changed, err := mergeTags(f, "client/acmeish", "client/acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed != 1 {
+		t.Fatalf("expected 1 item changed, got %d", changed)
+	}
+	if len(f.TagDefinitions) != 1 || f.TagDefinitions[0].Colour != "#222222" {
+		t.Fatalf("expected only the target definition to remain, got %+v", f.TagDefinitions)
+	}
+	if n, _ := usageCount(tagUsage(f), "client/acme"); n != 2 {
+		t.Fatalf("expected merged usage of 2, got %d", n)
+	}
+}
+
+func TestDeleteTag_RemovesDescendantsEverywhere(t *testing.T) {
+	f := hierarchyFolder()
+	defineTag(f, "client/acme/contracts", "", "")
+
+	changed, err := deleteTag(f, "client/acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed != 3 {
+		t.Fatalf("expected 2 files and 1 folder changed, got %d", changed)
+	}
+	if len(f.TagDefinitions) != 0 {
+		t.Fatalf("registry entry should be deleted, got %+v", f.TagDefinitions)
+	}
+	if len(f.Subfolders[0].Files[0].Tags) != 1 {
+		t.Fatalf("unrelated tags must stay, got %v", f.Subfolders[0].Files[0].Tags)
+	}
+}
+
+func TestTagRegistry_PersistsAcrossReload(t *testing.T) {
+	tmp := chdirTemp(t)
+	comp := &Folder{Name: "reg", Path: tmp}
+	defineTag(comp, "finance", "#00ff00", "money")
+	if err := saveCompositeDetails(comp); err != nil {
+		t.Fatal(err)
+	}
+
+	stored := readStoredTree(t, "reg")
+	fresh := &Folder{Name: "reg", Path: tmp}
+	mergeDirectoryTreeToComposite(fresh, &stored)
+	def := fresh.findTagDefinition("finance")
+	if def == nil || def.Colour != "#00ff00" || def.Description != "money" {
+		t.Fatalf("registry not restored, got %+v", fresh.TagDefinitions)
+	}
+}
+
+func TestRenameTagHandler_ConflictIsBadRequest(t *testing.T) {
+	chdirTemp(t)
+	orig := Composites
+	defer func() { Composites = orig }()
+	Composites = []*Folder{hierarchyFolder()}
+
+	rr := httptest.NewRecorder()
+	renameTagHandler(rr, httptest.NewRequest("GET", "/renameTag?name=tags&from=client/acmeish&to=client/beta", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	renameTagHandler(rr, httptest.NewRequest("GET", "/renameTag?name=tags&from=client/acmeish&to=client/acme2", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp struct {
+		Changed int        `json:"changed"`
+		Tags    []TagUsage `json:"tags"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Changed != 1 {
+		t.Fatalf("expected 1 change, got %d", resp.Changed)
+	}
+	if _, ok := usageCount(resp.Tags, "client/acme2"); !ok {
+		t.Fatalf("renamed tag missing from response: %+v", resp.Tags)
+	}
+}
+
+func TestRenameAndDeleteTag_FollowInheritance(t *testing.T) {
+	f := hierarchyFolder()
+	other := f.Subfolders[0]
+	other.SetTagInheritance("client/acme", true)
+	beta := other.Files[0]
+
+	if _, err := renameTag(f, "client", "customer"); err != nil {
+		t.Fatal(err)
+	}
+	if len(other.InheritTags) != 1 || other.InheritTags[0] != "customer/acme" {
+		t.Fatalf("inheritance should follow the rename, got %v", other.InheritTags)
+	}
+	if got := inheritedFileTags(f)[beta]; len(got) != 1 || got[0] != "customer/acme" {
+		t.Fatalf("files should inherit the renamed tag, got %v", got)
+	}
+
+	if _, err := deleteTag(f, "customer/acme"); err != nil {
+		t.Fatal(err)
+	}
+	if len(other.InheritTags) != 0 || len(inheritedFileTags(f)[beta]) != 0 {
+		t.Fatalf("a deleted tag must not be inherited anymore, got %v", other.InheritTags)
+	}
+}
@@ -0,0 +1,236 @@
+package filesystem
+
+// tag suggestions come from three places: existing tags whose name matches one of the
+// file's keywords, tags on other files that share keywords with it, and the strongest
+// keywords themselves as new tags. keyword scores weight all three.
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const defaultSuggestionLimit = 5
+
+// suggestion sources
+const (
+	suggestFromVocabulary = "vocabulary"
+	suggestFromSimilar    = "similar"
+	suggestFromKeyword    = "keyword"
+)
+
+type TagSuggestion struct {
+	Tag     string   `json:"tag"`
+	Score   float64  `json:"score"`
+	Sources []string `json:"sources"`
+}
+
+type FileSuggestions struct {
+	FilePath    string          `json:"file_path"`
+	FileName    string          `json:"file_name"`
+	Suggestions []TagSuggestion `json:"suggestions"`
+}
+
+// tagSuggester holds the indexes built once per request
+type tagSuggester struct {
+	// lower case tag, and lower case last segment, to the tag
+	vocabulary map[string][]string
+	// lower case keyword to the tagged files carrying it
+	byKeyword map[string][]*File
+	inherited map[*File][]string
+}
+
+func newTagSuggester(c *Folder) *tagSuggester {
+	s := &tagSuggester{
+		vocabulary: map[string][]string{},
+		byKeyword:  map[string][]*File{},
+		inherited:  inheritedFileTags(c),
+	}
+	for _, u := range tagUsage(c) {
+		whole := strings.ToLower(u.Name)
+		s.vocabulary[whole] = append(s.vocabulary[whole], u.Name)
+		segments := strings.Split(whole, tagSeparator)
+		if last := segments[len(segments)-1]; last != whole {
+			s.vocabulary[last] = append(s.vocabulary[last], u.Name)
+		}
+	}
+
+	var walk func(f *Folder)
+	walk = func(f *Folder) {
+		for _, file := range f.Files {
+			if len(file.Tags) == 0 {
+				continue
+			}
+			for kw := range keywordSet(file) {
+				s.byKeyword[kw] = append(s.byKeyword[kw], file)
+			}
+		}
+		for _, sub := range f.Subfolders {
+			walk(sub)
+		}
+	}
+	walk(c)
+	return s
+}
+
+// keywordSet maps a file's lower case keywords to their score relative to its best keyword
+func keywordSet(file *File) map[string]float64 {
+	var best float32
+	for _, kw := range file.Keywords {
+		if kw.GetScore() > best {
+			best = kw.GetScore()
+		}
+	}
+	set := make(map[string]float64, len(file.Keywords))
+	for _, kw := range file.Keywords {
+		word := strings.ToLower(strings.TrimSpace(kw.GetKeyword()))
+		if word == "" {
+			continue
+		}
+		weight := 1.0
+		if best > 0 {
+			weight = float64(kw.GetScore() / best)
+		}
+		if weight > set[word] {
+			set[word] = weight
+		}
+	}
+	return set
+}
+
+func (s *tagSuggester) suggest(file *File, limit int) []TagSuggestion {
+	scores := map[string]*TagSuggestion{}
+	add := func(tag string, score float64, source string) {
+		if hasMatchingTag(file.Tags, tag) || hasMatchingTag(s.inherited[file], tag) {
+			return
+		}
+		sg, ok := scores[tag]
+		if !ok {
+			sg = &TagSuggestion{Tag: tag}
+			scores[tag] = sg
+		}
+		sg.Score += score
+		if !containsString(sg.Sources, source) {
+			sg.Sources = append(sg.Sources, source)
+		}
+	}
+
+	keywords := keywordSet(file)
+	overlap := map[*File]float64{}
+	for kw, weight := range keywords {
+		if tags, ok := s.vocabulary[kw]; ok {
+			for _, tag := range tags {
+				add(tag, weight, suggestFromVocabulary)
+			}
+		} else {
+			// a strong keyword nobody uses as a tag yet
+			add(kw, weight*0.5, suggestFromKeyword)
+		}
+		for _, other := range s.byKeyword[kw] {
+			if other != file {
+				overlap[other] += weight
+			}
+		}
+	}
+
+	for other, shared := range overlap {
+		// share of the keywords the two files have in common
+		similarity := shared / float64(len(keywords)+len(other.Keywords))
+		for _, tag := range other.Tags {
+			add(tag, similarity, suggestFromSimilar)
+		}
+	}
+
+	result := make([]TagSuggestion, 0, len(scores))
+	for _, sg := range scores {
+		result = append(result, *sg)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Score != result[j].Score {
+			return result[i].Score > result[j].Score
+		}
+		return result[i].Tag < result[j].Tag
+	})
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
+
+// suggestForUntagged proposes tags for every file without own or inherited tags
+func (s *tagSuggester) suggestForUntagged(c *Folder, limit int) []FileSuggestions {
+	out := []FileSuggestions{}
+	var walk func(f *Folder)
+	walk = func(f *Folder) {
+		for _, file := range f.Files {
+			if len(file.Tags) > 0 || len(s.inherited[file]) > 0 {
+				continue
+			}
+			if sg := s.suggest(file, limit); len(sg) > 0 {
+				out = append(out, FileSuggestions{FilePath: file.Path, FileName: file.Name, Suggestions: sg})
+			}
+		}
+		for _, sub := range f.Subfolders {
+			walk(sub)
+		}
+	}
+	walk(c)
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].FilePath < out[j].FilePath
+	})
+	return out
+}
+
+func suggestionLimit(r *http.Request) int {
+	if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 {
+		return n
+	}
+	return defaultSuggestionLimit
+}
+
+func suggestTagsHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	path := ConvertToWSLPath(r.URL.Query().Get("path"))
+	if name == "" || path == "" {
+		http.Error(w, "Missing 'name' or 'path' parameter", http.StatusBadRequest)
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	c := findComposite(name)
+	if c == nil {
+		http.Error(w, "No smart manager with that name", http.StatusBadRequest)
+		return
+	}
+	file := c.GetFile(path)
+	if file == nil {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(newTagSuggester(c).suggest(file, suggestionLimit(r))); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// bulkSuggestTagsHandler suggests tags for all untagged files of a manager
+func bulkSuggestTagsHandler(w http.ResponseWriter, r *http.Request) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	c := findComposite(r.URL.Query().Get("name"))
+	if c == nil {
+		http.Error(w, "No smart manager with that name", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(newTagSuggester(c).suggestForUntagged(c, suggestionLimit(r))); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,96 @@
+package filesystem
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	pb "github.com/COS301-SE-2025/Smart-File-Manager/golang/client/protos"
+)
+
+func kws(words ...string) []*pb.Keyword {
+	var out []*pb.Keyword
+	for i, w := range words {
+		out = append(out, &pb.Keyword{Keyword: w, Score: float32(len(words) - i)})
+	}
+	return out
+}
+
+func suggestionFolder() *Folder {
+	return &Folder{
+		Name: "suggest",
+		Path: "/s",
+		Files: []*File{
+			{Name: "inv1.pdf", Path: "/s/inv1.pdf", Tags: []string{"finance/invoices"}, Keywords: kws("invoice", "vat", "acme")},
+			{Name: "inv2.pdf", Path: "/s/inv2.pdf", Keywords: kws("vat", "invoice", "total")},
+			{Name: "trip.jpg", Path: "/s/trip.jpg", Keywords: kws("beach", "holiday")},
+			{Name: "vat.txt", Path: "/s/vat.txt", Tags: []string{"vat"}, Keywords: kws("tax")},
+			{Name: "empty.bin", Path: "/s/empty.bin"},
+		},
+	}
+}
+
+func findSuggestion(list []TagSuggestion, tag string) *TagSuggestion {
+	for i := range list {
+		if list[i].Tag == tag {
+			return &list[i]
+		}
+	}
+	return nil
+}
+
+func TestSuggest_UsesSimilarFilesVocabularyAndKeywords(t *testing.T) {
+	c := suggestionFolder()
+	got := newTagSuggester(c).suggest(c.Files[1], 10)
+
+	similar := findSuggestion(got, "finance/invoices")
+	if similar == nil || !containsString(similar.Sources, suggestFromSimilar) {
+		t.Fatalf("expected finance/invoices from a similar file, got %+v", got)
+	}
+	vocab := findSuggestion(got, "vat")
+	if vocab == nil || !containsString(vocab.Sources, suggestFromVocabulary) {
+		t.Fatalf("expected existing tag vat from the vocabulary, got %+v", got)
+	}
+	if kw := findSuggestion(got, "total"); kw == nil || kw.Sources[0] != suggestFromKeyword {
+		t.Fatalf("expected keyword total as a new tag, got %+v", got)
+	}
+	if got[0].Tag != "vat" {
+		t.Fatalf("existing tag matching the strongest keyword should rank first, got %+v", got)
+	}
+}
+
+func TestSuggest_SkipsTagsTheFileAlreadyHas(t *testing.T) {
+	c := suggestionFolder()
+	if s := findSuggestion(newTagSuggester(c).suggest(c.Files[0], 10), "finance/invoices"); s != nil {
+		t.Fatalf("file already carries finance/invoices")
+	}
+	if got := newTagSuggester(c).suggest(c.Files[4], 10); len(got) != 0 {
+		t.Fatalf("file without keywords gets no suggestions, got %+v", got)
+	}
+}
+
+func TestBulkSuggestTagsHandler_OnlyUntagged(t *testing.T) {
+	orig := Composites
+	defer func() { Composites = orig }()
+	Composites = []*Folder{suggestionFolder()}
+
+	rr := httptest.NewRecorder()
+	bulkSuggestTagsHandler(rr, httptest.NewRequest("GET", "/bulkSuggestTags?name=suggest&limit=2", nil))
+	var resp []FileSuggestions
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp) != 2 || resp[0].FileName != "inv2.pdf" || resp[1].FileName != "trip.jpg" {
+		t.Fatalf("expected inv2.pdf and trip.jpg, got %+v", resp)
+	}
+	if len(resp[0].Suggestions) != 2 {
+		t.Fatalf("limit not applied: %+v", resp[0].Suggestions)
+	}
+
+	rr = httptest.NewRecorder()
+	suggestTagsHandler(rr, httptest.NewRequest("GET", "/suggestTags?name=suggest&path=/s/nope.txt", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown file, got %d", rr.Code)
+	}
+}
@@ -212,3 +212,54 @@ func TestPopulateKeywordsFromStoredJsonFile_NoFile(t *testing.T) {
 		)
 	}
 }
+
+func TestSavePopulate_FolderTagsAndLocksRoundTrip(t *testing.T) {
+	tmp := t.TempDir()
+	cwd, _ := os.Getwd()
+	if err := os.Chdir(tmp); err != nil {
+		t.Fatalf("chdir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(cwd) })
+
+	subPath := filepath.Join(tmp, "sub")
+	nestedPath := filepath.Join(subPath, "nested")
+	comp := &filesystem.Folder{
+		Name: "folderMeta",
+		Path: tmp,
+		Subfolders: []*filesystem.Folder{
+			{
+				Name:   "sub",
+				Path:   subPath,
+				Tags:   []string{"clients"},
+				Locked: true,
+				Subfolders: []*filesystem.Folder{
+					{Name: "nested", Path: nestedPath, Tags: []string{"archive", "2024"}},
+				},
+			},
+		},
+	}
+	filesystem.SaveCompositeDetailsForTest(comp)
+
+	// a fresh scan has no folder metadata
+	fresh := &filesystem.Folder{
+		Name: "folderMeta",
+		Path: tmp,
+		Subfolders: []*filesystem.Folder{
+			{
+				Name:       "sub",
+				Path:       subPath,
+				Subfolders: []*filesystem.Folder{{Name: "nested", Path: nestedPath}},
+			},
+		},
+	}
+	filesystem.PopulateKeywordsFromStoredJsonFileForTest(fresh)
+
+	sub := fresh.GetSubfolder(subPath)
+	if len(sub.Tags) != 1 || sub.Tags[0] != "clients" || !sub.Locked {
+		t.Fatalf("folder metadata not restored: tags=%v locked=%v", sub.Tags, sub.Locked)
+	}
+	nested := fresh.GetSubfolder(nestedPath)
+	if len(nested.Tags) != 2 || nested.Locked {
+		t.Fatalf("nested folder metadata not restored: tags=%v locked=%v", nested.Tags, nested.Locked)
+	}
+}
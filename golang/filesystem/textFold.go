@@ -0,0 +1,93 @@
+package filesystem
+
+// name and keyword matching compares folded text: unicode normalised, case folded and,
+// for latin, greek and cyrillic letters, without accents, so "resume" finds "résumé"
+// and a name stored in NFD matches a search typed in NFC. marks on other scripts are
+// kept, dropping the dakuten would turn が into か. distances are counted in runes.
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// foldText returns the form of s that name and keyword search compare
+func foldText(s string) string {
+	if isASCII(s) {
+		return strings.ToLower(s)
+	}
+	var b strings.Builder
+	var base rune
+	for _, r := range norm.NFD.String(s) {
+		if unicode.Is(unicode.Mn, r) {
+			if foldsAccents(base) {
+				continue
+			}
+		} else {
+			base = r
+		}
+		b.WriteRune(r)
+	}
+	// a Caser keeps state, so each call gets its own
+	return norm.NFC.String(cases.Fold().String(b.String()))
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+func foldsAccents(base rune) bool {
+	return unicode.In(base, unicode.Latin, unicode.Greek, unicode.Cyrillic)
+}
+
+// unspacedScript reports whether s is written in a script without spaces between
+// words, where a short search is usually part of a longer name rather than its start
+func unspacedScript(s string) bool {
+	for _, r := range s {
+		if !unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// runeLevenshtein is the edit distance between a and b counted in runes
+func runeLevenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := 0; j <= len(b); j++ {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		ai := a[i-1]
+		for j := 1; j <= len(b); j++ {
+			cost := 0
+			if ai != b[j-1] {
+				cost = 1
+			}
+			sub := prev[j-1] + cost
+			ins := curr[j-1] + 1
+			del := prev[j] + 1
+
+			// take the minimum
+			if ins < sub {
+				sub = ins
+			}
+			if del < sub {
+				sub = del
+			}
+			curr[j] = sub
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,115 @@
+package filesystem
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	pb "github.com/COS301-SE-2025/Smart-File-Manager/golang/client/protos"
+	"golang.org/x/text/unicode/norm"
+)
+
+func TestFoldText(t *testing.T) {
+	cases := map[string]string{
+		"Résumé":                      "resume",
+		norm.NFD.String("Résumé.pdf"): "resume.pdf",
+		"Straße":                      "strasse",
+		"ΚΑΛΗΜΈΡΑ":                    "καλημερα",
+		"Ёлка":                        "елка",
+		"報告書":                         "報告書",
+		// the dakuten is part of the letter, not an accent
+		"がっこう": "がっこう",
+	}
+	for in, want := range cases {
+		if got := foldText(in); got != want {
+			t.Errorf("foldText(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestLevenshteinDist_CountsRunes(t *testing.T) {
+	cases := []struct {
+		search, name string
+		want         int
+	}{
+		{"resume", "résumé.pdf", 0},
+		{norm.NFC.String("café"), norm.NFD.String("café.txt"), 0},
+		{"会議資料", "会議資科.docx", 1},
+		{"отчёт", "отчет_2024.xlsx", 1},
+		{"Привет", "привт.txt", 1},
+		{"", "報告書.pdf", 7},
+	}
+	for _, tc := range cases {
+		if got := LevenshteinDist(tc.search, tc.name); got != tc.want {
+			t.Errorf("LevenshteinDist(%q, %q) = %d, want %d", tc.search, tc.name, got, tc.want)
+		}
+	}
+	if got := LevenshteinDistForKeywords("ÉCOLE", "ecole"); got != 0 {
+		t.Errorf("keywords should fold accents too, got %d", got)
+	}
+	if got := LevenshteinDistForKeywords("東京", "京都"); got != 2 {
+		t.Errorf("expected 2 edits between 東京 and 京都, got %d", got)
+	}
+}
+
+func TestFuzzyNameMatch_NonLatin(t *testing.T) {
+	hits := []struct{ text, name string }{
+		{"resume", "Résumé_2024.pdf"},
+		{"報告", "年度報告書.pdf"},
+		{"会議資料", "会議資科.docx"},
+		{"σημειώσεις", "Σημειωσεις.txt"},
+		{"документы", "Документ.odt"},
+	}
+	for _, h := range hits {
+		if _, ok := fuzzyNameMatch(h.text, h.name); !ok {
+			t.Errorf("%q should find %q", h.text, h.name)
+		}
+	}
+	// folding must not merge distinct kana
+	if dist, ok := fuzzyNameMatch("がっこう", "かっこう.txt"); ok && dist == 0 {
+		t.Errorf("がっこう and かっこう should differ")
+	}
+	if _, ok := fuzzyNameMatch("ab", "xab.txt"); ok {
+		t.Errorf("short latin queries still need a prefix")
+	}
+}
+
+func TestSearch_FoldsNamesAndKeywords(t *testing.T) {
+	orig := Composites
+	defer func() { Composites = orig }()
+	c := &Folder{Name: "intl", Path: "/intl", Files: []*File{
+		{Name: norm.NFD.String("Résumé.pdf"), Path: "/intl/resume.pdf"},
+		{Name: "東京出張.xlsx", Path: "/intl/tokyo.xlsx", Keywords: []*pb.Keyword{{Keyword: "出張", Score: 1}}},
+		{Name: "notes.txt", Path: "/intl/notes.txt", Keywords: []*pb.Keyword{{Keyword: "Café", Score: 1}}},
+	}}
+	c.nameIndex = buildNameIndex(c)
+	Composites = []*Folder{c}
+
+	for q, want := range map[string]string{"resume": "/intl/resume.pdf", norm.NFC.String("résumé"): "/intl/resume.pdf", "東京": "/intl/tokyo.xlsx"} {
+		res := decodePage(t, q, func(rr *httptest.ResponseRecorder) {
+			SearchHandler(rr, httptest.NewRequest("GET", "/search?compositeName=intl&searchText="+q, nil))
+		})
+		if res.Total != 1 || res.Children[0].Path != want {
+			t.Errorf("%q: expected %s, got %+v", q, want, res.Children)
+		}
+	}
+	for q, want := range map[string]string{"cafe": "/intl/notes.txt", "出張": "/intl/tokyo.xlsx"} {
+		res := decodePage(t, q, func(rr *httptest.ResponseRecorder) {
+			KeywordSearchHadler(rr, httptest.NewRequest("GET", "/keywordSearch?compositeName=intl&searchText="+q, nil))
+		})
+		if len(res.Children) == 0 || res.Children[0].Path != want {
+			t.Errorf("keyword %q: expected %s, got %+v", q, want, res.Children)
+		}
+	}
+}
+
+func TestExtractKeywordsFromText_KeepsNonLatinWords(t *testing.T) {
+	found := map[string]bool{}
+	for _, kw := range ExtractKeywordsFromText("Le résumé du café. Привет мир.", 10) {
+		found[kw.Keyword] = true
+	}
+	for _, want := range []string{"résumé", "café", "привет"} {
+		if !found[want] {
+			t.Errorf("expected %q among %v", want, found)
+		}
+	}
+}
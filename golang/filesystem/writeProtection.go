@@ -0,0 +1,322 @@
+package filesystem
+
+// write protection is opt-in per manager. with it on, locking a file or folder also
+// clears its write permission bits on disk so other programs cannot change it, and
+// unlocking puts the original mode back. the original mode is stored with the item so
+// it survives restarts. startUp checks that protected items are still read-only.
+// the app's own writes to protected files, the tag export, lift the protection for
+// the duration of the write.
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+)
+
+const (
+	writeBits      os.FileMode = 0222
+	protectedModes             = os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+)
+
+// PermissionDrift is a protected item whose on-disk mode no longer matches its lock
+type PermissionDrift struct {
+	Path     string `json:"path"`
+	IsFolder bool   `json:"isFolder"`
+	Mode     string `json:"mode,omitempty"`
+	Problem  string `json:"problem"`
+}
+
+// protectMu orders mode changes, the tag export changes modes without holding mu
+var protectMu sync.Mutex
+
+// protectPath clears the write bits of path and returns the mode it had before
+func protectPath(path string) (*os.FileMode, error) {
+	protectMu.Lock()
+	defer protectMu.Unlock()
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	mode := info.Mode() & protectedModes
+	if err := os.Chmod(path, mode&^writeBits); err != nil {
+		return nil, err
+	}
+	return &mode, nil
+}
+
+// restorePath puts original back, a path that is gone needs nothing restored
+func restorePath(path string, original os.FileMode) bool {
+	protectMu.Lock()
+	defer protectMu.Unlock()
+	if err := os.Chmod(path, original); err != nil && !os.IsNotExist(err) {
+		log.Printf("restoring mode of %s failed: %v", path, err)
+		return false
+	}
+	return true
+}
+
+// withWriteBits runs write with the original mode of a protected path back in place and
+// protects the path again afterwards. original is the stored mode, nil when the path
+// was not protected. a path that is writable on disk was unlocked in the meantime and
+// is left writable.
+func withWriteBits(path string, original *os.FileMode, write func() error) error {
+	if original == nil {
+		return write()
+	}
+	protectMu.Lock()
+	defer protectMu.Unlock()
+	info, err := os.Stat(path)
+	if err != nil || info.Mode()&writeBits != 0 {
+		return write()
+	}
+	if err := os.Chmod(path, *original); err != nil {
+		return err
+	}
+	err = write()
+	if cerr := os.Chmod(path, info.Mode()&protectedModes); cerr != nil {
+		log.Printf("write protecting %s failed: %v", path, cerr)
+	}
+	return err
+}
+
+func (f *File) protect() {
+	if f.OriginalMode != nil {
+		return
+	}
+	mode, err := protectPath(f.Path)
+	if err != nil {
+		log.Printf("write protecting %s failed: %v", f.Path, err)
+		return
+	}
+	f.OriginalMode = mode
+}
+
+func (f *File) restoreMode() {
+	if f.OriginalMode != nil && restorePath(f.Path, *f.OriginalMode) {
+		f.OriginalMode = nil
+	}
+}
+
+func (f *Folder) protect() {
+	if f.OriginalMode != nil {
+		return
+	}
+	mode, err := protectPath(f.Path)
+	if err != nil {
+		log.Printf("write protecting %s failed: %v", f.Path, err)
+		return
+	}
+	f.OriginalMode = mode
+}
+
+func (f *Folder) restoreMode() {
+	if f.OriginalMode != nil && restorePath(f.Path, *f.OriginalMode) {
+		f.OriginalMode = nil
+	}
+}
+
+// protectTree write protects the locked items of folder and everything below it
+func protectTree(folder *Folder) {
+	for _, file := range folder.Files {
+		if file.Locked {
+			file.protect()
+		}
+	}
+	for _, sub := range folder.Subfolders {
+		protectTree(sub)
+	}
+	if folder.Locked {
+		folder.protect()
+	}
+}
+
+// setWriteProtection switches the mode for a manager. enabling protects the items that
+// were locked by a user or a policy, the automatic locks on hidden files stay writable.
+// disabling restores every stored mode.
+func setWriteProtection(c *Folder, enabled bool) {
+	c.WriteProtect = enabled
+	var walk func(f *Folder)
+	walk = func(f *Folder) {
+		for _, file := range f.Files {
+			if enabled && file.Locked && file.LockInfo != nil {
+				file.protect()
+			} else if !enabled {
+				file.restoreMode()
+			}
+		}
+		for _, sub := range f.Subfolders {
+			walk(sub)
+		}
+		if enabled && f.Locked && f.LockInfo != nil {
+			f.protect()
+		} else if !enabled {
+			f.restoreMode()
+		}
+	}
+	walk(c)
+}
+
+// reconcileWriteProtection makes the modes on disk follow the lock state after it was
+// replaced wholesale, as by a snapshot restore. unlocked items get their mode back,
+// user and policy locks are protected when the manager asks for it, the automatic
+// locks keep whatever they have.
+func reconcileWriteProtection(c *Folder) {
+	fix := func(path string, locked, byUser bool, original **os.FileMode) {
+		if !c.WriteProtect || !locked {
+			if *original != nil && restorePath(path, **original) {
+				*original = nil
+			}
+			return
+		}
+		if !byUser {
+			return
+		}
+		if *original != nil {
+			if info, err := os.Stat(path); err != nil || info.Mode()&writeBits == 0 {
+				return
+			}
+			// the stored mode came from the snapshot, the item is writable again
+			*original = nil
+		}
+		mode, err := protectPath(path)
+		if err != nil {
+			log.Printf("write protecting %s failed: %v", path, err)
+			return
+		}
+		*original = mode
+	}
+
+	var walk func(f *Folder)
+	walk = func(f *Folder) {
+		for _, file := range f.Files {
+			fix(file.Path, file.Locked, file.LockInfo != nil, &file.OriginalMode)
+		}
+		for _, sub := range f.Subfolders {
+			walk(sub)
+		}
+		fix(f.Path, f.Locked, f.LockInfo != nil, &f.OriginalMode)
+	}
+	walk(c)
+}
+
+// unprotectForDelete gives the write bits back to path, everything below it and the
+// folder it sits in, a protected item cannot be removed otherwise. the returned func
+// protects again whatever is still locked, to be called once the delete is done.
+func unprotectForDelete(c *Folder, path string) func() {
+	file, folder, ancestors := locateItem(c, path, nil)
+	var parent *Folder
+	if len(ancestors) > 0 {
+		parent = ancestors[len(ancestors)-1]
+	}
+	var restore func(f *Folder)
+	restore = func(f *Folder) {
+		for _, file := range f.Files {
+			file.restoreMode()
+		}
+		for _, sub := range f.Subfolders {
+			restore(sub)
+		}
+		f.restoreMode()
+	}
+	switch {
+	case file != nil:
+		file.restoreMode()
+	case folder != nil:
+		restore(folder)
+	}
+	if parent != nil {
+		parent.restoreMode()
+	}
+
+	return func() {
+		if !c.WriteProtect {
+			return
+		}
+		// a failed delete leaves the item on disk, it is locked as before
+		if _, err := os.Lstat(path); err == nil {
+			switch {
+			case file != nil && file.Locked && file.LockInfo != nil:
+				file.protect()
+			case folder != nil:
+				protectTree(folder)
+			}
+		}
+		if parent != nil && parent.Locked && parent.LockInfo != nil {
+			parent.protect()
+		}
+	}
+}
+
+// checkWriteProtection compares the stored records with the disk
+func checkWriteProtection(c *Folder) []PermissionDrift {
+	drift := []PermissionDrift{}
+	check := func(path string, isFolder, locked bool, original *os.FileMode) {
+		if original == nil {
+			return
+		}
+		d := PermissionDrift{Path: path, IsFolder: isFolder}
+		info, err := os.Stat(path)
+		switch {
+		case err != nil:
+			d.Problem = "missing"
+		case !locked:
+			d.Problem = "unlocked but still write protected"
+			d.Mode = info.Mode().Perm().String()
+		case info.Mode()&writeBits != 0:
+			d.Problem = "writable although locked"
+			d.Mode = info.Mode().Perm().String()
+		default:
+			return
+		}
+		drift = append(drift, d)
+	}
+
+	var walk func(f *Folder)
+	walk = func(f *Folder) {
+		check(f.Path, true, f.Locked, f.OriginalMode)
+		for _, file := range f.Files {
+			check(file.Path, false, file.Locked, file.OriginalMode)
+		}
+		for _, sub := range f.Subfolders {
+			walk(sub)
+		}
+	}
+	walk(c)
+	sort.Slice(drift, func(i, j int) bool {
+		return drift[i].Path < drift[j].Path
+	})
+	return drift
+}
+
+// writeProtectionHandler reports the mode and any drift, enabled=true|false switches it
+func writeProtectionHandler(w http.ResponseWriter, r *http.Request) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	c := findComposite(r.URL.Query().Get("name"))
+	if c == nil {
+		http.Error(w, "No smart manager with that name", http.StatusBadRequest)
+		return
+	}
+	switch r.URL.Query().Get("enabled") {
+	case "true":
+		setWriteProtection(c, true)
+		queueCompositeSave(c)
+	case "false":
+		setWriteProtection(c, false)
+		queueCompositeSave(c)
+	case "":
+	default:
+		http.Error(w, "enabled must be true or false", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Enabled bool              `json:"enabled"`
+		Drift   []PermissionDrift `json:"drift"`
+	}{c.WriteProtect, checkWriteProtection(c)})
+}
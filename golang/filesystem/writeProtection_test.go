@@ -0,0 +1,185 @@
+package filesystem
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func protectedManager(t *testing.T) (*Folder, string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("permission bits are not meaningful on windows")
+	}
+	tmp := chdirTemp(t)
+	root := filepath.Join(tmp, "protected")
+	os.MkdirAll(filepath.Join(root, "signed"), 0755)
+	os.WriteFile(filepath.Join(root, "a.txt"), []byte("a"), 0640)
+	os.WriteFile(filepath.Join(root, "signed", "s.pdf"), []byte("s"), 0644)
+	c, err := ConvertToObject("protected", root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// restore everything so t.TempDir can clean up
+	t.Cleanup(func() { setWriteProtection(c, false) })
+	c.WriteProtect = true
+	return c, root
+}
+
+func modeOf(t *testing.T, path string) os.FileMode {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Mode().Perm()
+}
+
+func TestWriteProtection_LockAndUnlockRestoreMode(t *testing.T) {
+	c, root := protectedManager(t)
+	file := filepath.Join(root, "a.txt")
+
+	lockPathWithInfo(c, file, &LockInfo{LockedAt: time.Now()})
+	if got := modeOf(t, file); got != 0440 {
+		t.Fatalf("expected write bits cleared, got %v", got)
+	}
+	c.UnlockByPath(file)
+	if got := modeOf(t, file); got != 0640 {
+		t.Fatalf("expected original mode back, got %v", got)
+	}
+
+	c.LockByPath(filepath.Join(root, "signed"))
+	if modeOf(t, filepath.Join(root, "signed"))&writeBits != 0 || modeOf(t, filepath.Join(root, "signed", "s.pdf")) != 0444 {
+		t.Fatalf("folder lock should protect the folder and its files")
+	}
+	c.UnlockByPath(filepath.Join(root, "signed"))
+	if modeOf(t, filepath.Join(root, "signed")) != 0755 || modeOf(t, filepath.Join(root, "signed", "s.pdf")) != 0644 {
+		t.Fatalf("folder unlock should restore every mode")
+	}
+}
+
+func TestWriteProtection_ExpiryRestoresAndRecordPersists(t *testing.T) {
+	c, root := protectedManager(t)
+	file := filepath.Join(root, "a.txt")
+	past := time.Now().Add(-time.Minute)
+	lockPathWithInfo(c, file, &LockInfo{LockedAt: past.Add(-time.Hour), ExpiresAt: &past})
+
+	saveCompositeDetails(c)
+	stored := readStoredTree(t, "protected")
+	fresh, _ := ConvertToObject("protected", root)
+	mergeDirectoryTreeToComposite(fresh, &stored)
+	if !fresh.WriteProtect || fresh.GetFile(file).OriginalMode == nil || *fresh.GetFile(file).OriginalMode != 0640 {
+		t.Fatalf("write protection record not restored")
+	}
+
+	releaseExpiredLocks(fresh, time.Now())
+	if got := modeOf(t, file); got != 0640 {
+		t.Fatalf("expired lock should restore the mode, got %v", got)
+	}
+}
+
+func TestCheckWriteProtection_ReportsDrift(t *testing.T) {
+	c, root := protectedManager(t)
+	file := filepath.Join(root, "a.txt")
+	lockPathWithInfo(c, file, &LockInfo{LockedAt: time.Now()})
+	if drift := checkWriteProtection(c); len(drift) != 0 {
+		t.Fatalf("expected no drift, got %+v", drift)
+	}
+
+	os.Chmod(file, 0660)
+	drift := checkWriteProtection(c)
+	if len(drift) != 1 || drift[0].Path != file || drift[0].Problem != "writable although locked" {
+		t.Fatalf("expected drift for a.txt, got %+v", drift)
+	}
+}
+
+func TestSetWriteProtection_SkipsAutomaticLocks(t *testing.T) {
+	c, root := protectedManager(t)
+	c.WriteProtect = false
+	auto := c.GetFile(filepath.Join(root, "a.txt"))
+	auto.Lock()
+	lockPathWithInfo(c, filepath.Join(root, "signed", "s.pdf"), &LockInfo{LockedAt: time.Now()})
+
+	setWriteProtection(c, true)
+	if auto.OriginalMode != nil || modeOf(t, auto.Path) != 0640 {
+		t.Fatalf("automatic locks must stay writable")
+	}
+	if modeOf(t, filepath.Join(root, "signed", "s.pdf")) != 0444 {
+		t.Fatalf("existing user lock should be protected when enabling")
+	}
+	setWriteProtection(c, false)
+	if modeOf(t, filepath.Join(root, "signed", "s.pdf")) != 0644 {
+		t.Fatalf("disabling should restore the mode")
+	}
+}
+
+func TestWriteProtection_ForcedDeleteOfProtectedItems(t *testing.T) {
+	c, root := protectedManager(t)
+	orig := Composites
+	defer func() { Composites = orig }()
+	Composites = []*Folder{c}
+	signed := filepath.Join(root, "signed")
+	lockPathWithInfo(c, signed, &LockInfo{LockedAt: time.Now()})
+	os.WriteFile(filepath.Join(signed, "t.pdf"), []byte("t"), 0644)
+	c.GetSubfolder(signed).AddFile(&File{Name: "t.pdf", Path: filepath.Join(signed, "t.pdf"), Locked: true, LockInfo: c.GetSubfolder(signed).LockInfo})
+	c.GetFile(filepath.Join(signed, "t.pdf")).protect()
+
+	rr := httptest.NewRecorder()
+	deleteFileHandler(rr, httptest.NewRequest("GET", "/deleteFile?name=protected&force=true&path="+filepath.Join(signed, "s.pdf"), nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("forced delete of a protected file failed with %d", rr.Code)
+	}
+	if modeOf(t, signed)&writeBits != 0 || c.GetSubfolder(signed).OriginalMode == nil {
+		t.Fatalf("the locked folder of the deleted file should be protected again")
+	}
+	if modeOf(t, filepath.Join(signed, "t.pdf")) != 0444 {
+		t.Fatalf("the other file of the folder should stay protected")
+	}
+
+	rr = httptest.NewRecorder()
+	deleteFolderHandler(rr, httptest.NewRequest("GET", "/deleteFolder?name=protected&force=true&path="+signed, nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("forced delete of a protected folder failed with %d", rr.Code)
+	}
+	if _, err := os.Stat(signed); !os.IsNotExist(err) || c.GetSubfolder(signed) != nil {
+		t.Fatalf("the protected folder should be gone from disk and tree")
+	}
+}
+
+func TestWriteProtection_TagExportLiftsProtection(t *testing.T) {
+	c, root := protectedManager(t)
+	signed := filepath.Join(root, "signed")
+	lockPathWithInfo(c, signed, &LockInfo{LockedAt: time.Now()})
+	c.XmpSync = &TagSyncSettings{Enabled: true}
+	c.GetFile(filepath.Join(signed, "s.pdf")).Tags = []string{"contract"}
+
+	if res := exportXmpTags(c); res.Written != 1 || res.Errors != 0 {
+		t.Fatalf("expected the sidecar in the protected folder written, got %+v", res)
+	}
+	if modeOf(t, signed)&writeBits != 0 {
+		t.Fatalf("the folder should be protected again once the sidecar exists")
+	}
+
+	a := filepath.Join(root, "a.txt")
+	lockPathWithInfo(c, a, &LockInfo{LockedAt: time.Now()})
+	var during os.FileMode
+	err := withWriteBits(a, c.GetFile(a).OriginalMode, func() error {
+		during = modeOf(t, a)
+		return nil
+	})
+	if err != nil || during != 0640 || modeOf(t, a) != 0440 {
+		t.Fatalf("expected 0640 during and 0440 after the write, got %v and %v (%v)", during, modeOf(t, a), err)
+	}
+
+	// unlocked after the export was planned, the file must not be protected again
+	stored := c.GetFile(a).OriginalMode
+	c.UnlockByPath(a)
+	withWriteBits(a, stored, func() error { return nil })
+	if got := modeOf(t, a); got != 0640 {
+		t.Fatalf("an unlocked file should stay writable, got %v", got)
+	}
+}
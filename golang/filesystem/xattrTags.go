@@ -0,0 +1,122 @@
+package filesystem
+
+// optional per-manager sync of file tags with the user.xdg.tags extended attribute
+// (comma separated, the freedesktop convention) so desktop search tools and scripts
+// see the same tags. only files whose tags changed are written.
+
+import (
+	"net/http"
+	"strings"
+)
+
+const xattrTagsName = "user.xdg.tags"
+
+func xattrSyncEnabled(c *Folder) bool {
+	return xattrSupported && c != nil && c.XattrSync.enabled()
+}
+
+func parseXattrTags(value []byte) []string {
+	var tags []string
+	for _, raw := range strings.Split(string(value), ",") {
+		if tag := normalizeTag(raw); tag != "" && !containsString(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+func formatXattrTags(tags []string) string {
+	return strings.Join(tags, ",")
+}
+
+// importXattrTags reads the attribute of every file and resolves it against the app tags
+func importXattrTags(c *Folder) TagSyncResult {
+	var res TagSyncResult
+
+	var walk func(f *Folder)
+	walk = func(f *Folder) {
+		for _, file := range f.Files {
+			value, present, err := readXattr(file.Path, xattrTagsName)
+			if err != nil {
+				res.fail(err)
+				continue
+			}
+			file.xattrKnown = true
+			file.xattrTags = string(value)
+			if present && applyResolvedTags(file, parseXattrTags(value), c.XattrSync.Conflict) {
+				res.Imported++
+			}
+		}
+		for _, sub := range f.Subfolders {
+			walk(sub)
+		}
+	}
+	walk(c)
+	return res
+}
+
+// exportXattrTags writes the tags of every file whose attribute is out of date
+func exportXattrTags(c *Folder) TagSyncResult {
+	writes := planXattrExport(c)
+	for i := range writes {
+		writeXattrExport(&writes[i])
+	}
+	return recordXattrExport(writes)
+}
+
+// planXattrExport lists the files whose attribute is out of date, caller holds mu
+func planXattrExport(c *Folder) []tagWrite {
+	var writes []tagWrite
+
+	var walk func(f *Folder)
+	walk = func(f *Folder) {
+		for _, file := range f.Files {
+			want := formatXattrTags(file.Tags)
+			if want == file.xattrTags && (file.xattrKnown || want == "") {
+				continue
+			}
+			writes = append(writes, tagWrite{file: file, path: file.Path, want: want, protected: file.OriginalMode})
+		}
+		for _, sub := range f.Subfolders {
+			walk(sub)
+		}
+	}
+	walk(c)
+	return writes
+}
+
+// writeXattrExport sets the attribute, it does not touch the tree. a write protected
+// file is made writable for the write, the attribute cannot be set otherwise.
+func writeXattrExport(w *tagWrite) {
+	w.err = withWriteBits(w.path, w.protected, func() error {
+		return writeXattr(w.path, xattrTagsName, []byte(w.want))
+	})
+}
+
+// recordXattrExport remembers what reached the attributes, caller holds mu
+func recordXattrExport(writes []tagWrite) TagSyncResult {
+	var res TagSyncResult
+	for _, w := range writes {
+		if w.err != nil {
+			res.fail(w.err)
+			continue
+		}
+		w.file.xattrKnown = true
+		w.file.xattrTags = w.want
+		res.Written++
+	}
+	return res
+}
+
+func xattrSyncHandler(w http.ResponseWriter, r *http.Request) {
+	unsupported := ""
+	if !xattrSupported {
+		unsupported = "extended attributes are only supported on linux"
+	}
+	tagSyncHandler(w, r, func(c *Folder) **TagSyncSettings { return &c.XattrSync }, unsupported,
+		func(c *Folder) TagSyncResult {
+			res := importXattrTags(c)
+			res.add(exportXattrTags(c))
+			return res
+		})
+}
@@ -0,0 +1,118 @@
+package filesystem
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// xattrManager creates a manager with a.txt and b.txt, skipping when the temp dir has no user xattrs
+func xattrManager(t *testing.T) *Folder {
+	t.Helper()
+	tmp := chdirTemp(t)
+	root := filepath.Join(tmp, "xattr")
+	os.MkdirAll(root, 0755)
+	for _, name := range []string{"a.txt", "b.txt"} {
+		os.WriteFile(filepath.Join(root, name), []byte(name), 0644)
+	}
+	probe := filepath.Join(root, "a.txt")
+	if !xattrSupported || writeXattr(probe, xattrTagsName, []byte("probe")) != nil {
+		t.Skip("user extended attributes not supported here")
+	}
+	writeXattr(probe, xattrTagsName, nil)
+
+	c, err := ConvertToObject("xattr", root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestParseXattrTags(t *testing.T) {
+	got := parseXattrTags([]byte(" work, client//acme ,work,,"))
+	if len(got) != 2 || got[0] != "work" || got[1] != "client/acme" {
+		t.Fatalf("unexpected tags %v", got)
+	}
+}
+
+func TestXattrImport_ConflictModes(t *testing.T) {
+	c := xattrManager(t)
+	a := c.GetFile(filepath.Join(c.Path, "a.txt"))
+	writeXattr(a.Path, xattrTagsName, []byte("external,shared"))
+
+	cases := map[string][]string{
+		tagConflictMerge:    {"app", "shared", "external"},
+		tagConflictApp:      {"app", "shared"},
+		tagConflictExternal: {"external", "shared"},
+	}
+	for mode, want := range cases {
+		a.Tags = []string{"app", "shared"}
+		c.XattrSync = &TagSyncSettings{Enabled: true, Conflict: mode}
+		importXattrTags(c)
+		if formatXattrTags(a.Tags) != formatXattrTags(want) {
+			t.Errorf("%s: expected %v, got %v", mode, want, a.Tags)
+		}
+	}
+}
+
+func TestXattrExport_WritesOnlyChangedFiles(t *testing.T) {
+	c := xattrManager(t)
+	c.XattrSync = &TagSyncSettings{Enabled: true, Conflict: tagConflictMerge}
+	importXattrTags(c)
+
+	a := c.GetFile(filepath.Join(c.Path, "a.txt"))
+	a.Tags = []string{"finance", "client/acme"}
+	if res := exportXattrTags(c); res.Written != 1 || res.Errors != 0 {
+		t.Fatalf("expected one write, got %+v", res)
+	}
+	value, present, err := readXattr(a.Path, xattrTagsName)
+	if err != nil || !present || string(value) != "finance,client/acme" {
+		t.Fatalf("attribute not written: %q %v %v", value, present, err)
+	}
+	if res := exportXattrTags(c); res.Written != 0 {
+		t.Fatalf("unchanged tags must not be rewritten, got %+v", res)
+	}
+
+	// removing the last tag removes the attribute
+	a.Tags = nil
+	exportXattrTags(c)
+	if _, present, _ := readXattr(a.Path, xattrTagsName); present {
+		t.Fatalf("attribute should be removed")
+	}
+}
+
+func TestXattrSync_SaveWritesAndRestartImports(t *testing.T) {
+	c := xattrManager(t)
+	orig := Composites
+	defer func() { Composites = orig }()
+	Composites = []*Folder{c}
+
+	rr := httptest.NewRecorder()
+	xattrSyncHandler(rr, httptest.NewRequest("GET", "/xattrSync?name=xattr&enabled=true&conflict=merge", nil))
+	if rr.Code != 200 {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	path := filepath.Join(c.Path, "b.txt")
+	c.AddTagToFile(path, "review")
+	saveCompositeDetails(c)
+	if value, _, _ := readXattr(path, xattrTagsName); string(value) != "review" {
+		t.Fatalf("save should write the attribute, got %q", value)
+	}
+
+	// another tool adds a tag while the app is closed
+	writeXattr(path, xattrTagsName, []byte("review,urgent"))
+	stored := readStoredTree(t, "xattr")
+	if stored.XattrSync == nil || !stored.XattrSync.Enabled {
+		t.Fatalf("settings not persisted")
+	}
+	fresh, _ := ConvertToObject("xattr", c.Path)
+	mergeDirectoryTreeToComposite(fresh, &stored)
+	if !importExternalTags(fresh) {
+		t.Fatalf("expected import to change tags")
+	}
+	if tags := fresh.GetFile(path).Tags; formatXattrTags(tags) != "review,urgent" {
+		t.Fatalf("expected merged tags, got %v", tags)
+	}
+}
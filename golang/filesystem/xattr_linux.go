@@ -0,0 +1,42 @@
+//go:build linux
+
+package filesystem
+
+import (
+	"errors"
+	"syscall"
+)
+
+const xattrSupported = true
+
+// readXattr returns the raw attribute value, present is false when it is not set
+func readXattr(path, name string) (value []byte, present bool, err error) {
+	size, err := syscall.Getxattr(path, name, nil)
+	if errors.Is(err, syscall.ENODATA) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	buf := make([]byte, size)
+	n, err := syscall.Getxattr(path, name, buf)
+	if errors.Is(err, syscall.ENODATA) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return buf[:n], true, nil
+}
+
+// writeXattr sets the attribute, an empty value removes it
+func writeXattr(path, name string, value []byte) error {
+	if len(value) == 0 {
+		err := syscall.Removexattr(path, name)
+		if errors.Is(err, syscall.ENODATA) {
+			return nil
+		}
+		return err
+	}
+	return syscall.Setxattr(path, name, value, 0)
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+
+package filesystem
+
+import (
+	"errors"
+)
+
+const xattrSupported = false
+
+var errXattrUnsupported = errors.New("extended attributes are only supported on linux")
+
+func readXattr(path, name string) ([]byte, bool, error) {
+	return nil, false, errXattrUnsupported
+}
+
+func writeXattr(path, name string, value []byte) error {
+	return errXattrUnsupported
+}
@@ -0,0 +1,300 @@
+package filesystem
+
+// XMP sidecars (photo.jpg.xmp or photo.xmp) carry tags for photo tools in dc:subject.
+// exploreDown attaches a sidecar to its primary file instead of listing it. when the
+// manager opts in, dc:subject is imported after a scan and written back on save.
+// only the dc:subject element is rewritten, everything else in the sidecar is kept.
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const xmpExt = ".xmp"
+
+var (
+	xmpSubjectPattern     = regexp.MustCompile(`(?s)<dc:subject\b[^>]*?(?:/>|>.*?</dc:subject>)`)
+	xmpListItemPattern    = regexp.MustCompile(`(?s)<rdf:li\b[^>]*>(.*?)</rdf:li>`)
+	xmpDescriptionClose   = regexp.MustCompile(`</rdf:Description>`)
+	xmpDescriptionOpen    = regexp.MustCompile(`(?s)<rdf:Description\b[^>]*?(/?)>`)
+	xmpDublinCoreDeclared = regexp.MustCompile(`xmlns:dc\s*=`)
+)
+
+const xmpDublinCoreNS = `xmlns:dc="http://purl.org/dc/elements/1.1/"`
+
+const xmpTemplate = `<?xpacket begin="" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about="" ` + xmpDublinCoreNS + `>
+%s
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>
+`
+
+// isXmpSidecar reports whether name looks like a sidecar
+func isXmpSidecar(name string) bool {
+	return strings.EqualFold(filepath.Ext(name), xmpExt)
+}
+
+// attachSidecars moves sidecars out of folder.Files onto their primary file.
+// photo.jpg.xmp belongs to photo.jpg, photo.xmp to the first photo.* file.
+// sidecars without a primary stay ordinary files.
+func attachSidecars(folder *Folder) {
+	byName := make(map[string]*File, len(folder.Files))
+	byStem := map[string]*File{}
+	for _, file := range folder.Files {
+		if isXmpSidecar(file.Name) {
+			continue
+		}
+		byName[file.Name] = file
+		stem := strings.TrimSuffix(file.Name, filepath.Ext(file.Name))
+		if _, ok := byStem[stem]; !ok {
+			byStem[stem] = file
+		}
+	}
+
+	kept := folder.Files[:0]
+	for _, file := range folder.Files {
+		if isXmpSidecar(file.Name) {
+			base := strings.TrimSuffix(file.Name, filepath.Ext(file.Name))
+			primary := byName[base]
+			if primary == nil {
+				primary = byStem[base]
+			}
+			if primary != nil && primary.Sidecar == "" {
+				primary.Sidecar = file.Path
+				continue
+			}
+		}
+		kept = append(kept, file)
+	}
+	for i := len(kept); i < len(folder.Files); i++ {
+		folder.Files[i] = nil
+	}
+	folder.Files = kept
+}
+
+// sidecarMovedWith returns where a sidecar goes when its primary moves to newPrimary,
+// keeping the naming style (photo.jpg.xmp vs photo.xmp)
+func sidecarMovedWith(sidecar, oldPrimary, newPrimary string) string {
+	dir := filepath.Dir(newPrimary)
+	if filepath.Base(sidecar) == filepath.Base(oldPrimary)+filepath.Ext(sidecar) {
+		return filepath.Join(dir, filepath.Base(newPrimary)+filepath.Ext(sidecar))
+	}
+	stem := strings.TrimSuffix(filepath.Base(newPrimary), filepath.Ext(newPrimary))
+	return filepath.Join(dir, stem+filepath.Ext(sidecar))
+}
+
+// removeSidecar deletes the sidecar of a deleted file, one that is already gone is fine
+func removeSidecar(sidecar string) error {
+	if sidecar == "" {
+		return nil
+	}
+	if err := os.Remove(sidecar); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// parseXmpSubjects returns the dc:subject entries of a sidecar, present is false without dc:subject
+func parseXmpSubjects(data []byte) (tags []string, present bool) {
+	block := xmpSubjectPattern.Find(data)
+	if block == nil {
+		return nil, false
+	}
+	for _, m := range xmpListItemPattern.FindAllSubmatch(block, -1) {
+		if tag := normalizeTag(html.UnescapeString(string(m[1]))); tag != "" && !containsString(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags, true
+}
+
+func xmpSubjectBlock(tags []string) string {
+	if len(tags) == 0 {
+		return "   <dc:subject/>"
+	}
+	var b strings.Builder
+	b.WriteString("   <dc:subject>\n    <rdf:Bag>\n")
+	for _, t := range tags {
+		fmt.Fprintf(&b, "     <rdf:li>%s</rdf:li>\n", html.EscapeString(t))
+	}
+	b.WriteString("    </rdf:Bag>\n   </dc:subject>")
+	return b.String()
+}
+
+// setXmpSubjects rewrites dc:subject in an existing packet, or builds a new one when data is empty
+func setXmpSubjects(data []byte, tags []string) ([]byte, error) {
+	block := xmpSubjectBlock(tags)
+	if len(data) == 0 {
+		return []byte(fmt.Sprintf(xmpTemplate, block)), nil
+	}
+	if loc := xmpSubjectPattern.FindIndex(data); loc != nil {
+		out := append([]byte{}, data[:loc[0]]...)
+		out = append(out, strings.TrimLeft(block, " ")...)
+		return append(out, data[loc[1]:]...), nil
+	}
+
+	open := xmpDescriptionOpen.FindSubmatchIndex(data)
+	if open == nil {
+		return nil, fmt.Errorf("sidecar has no rdf:Description")
+	}
+	openTag := string(data[open[0]:open[1]])
+	selfClosing := open[3] > open[2]
+	if !xmpDublinCoreDeclared.MatchString(openTag) {
+		end := len(openTag) - 1
+		if selfClosing {
+			end--
+		}
+		openTag = openTag[:end] + " " + xmpDublinCoreNS + openTag[end:]
+	}
+
+	var out []byte
+	out = append(out, data[:open[0]]...)
+	if selfClosing {
+		openTag = strings.TrimSuffix(openTag, "/>") + ">"
+		out = append(out, openTag+"\n"+block+"\n  </rdf:Description>"...)
+		return append(out, data[open[1]:]...), nil
+	}
+	out = append(out, openTag...)
+	rest := data[open[1]:]
+	closeLoc := xmpDescriptionClose.FindIndex(rest)
+	if closeLoc == nil {
+		return nil, fmt.Errorf("sidecar has an unterminated rdf:Description")
+	}
+	out = append(out, rest[:closeLoc[0]]...)
+	out = append(out, block+"\n  "...)
+	return append(out, rest[closeLoc[0]:]...), nil
+}
+
+// xmpEligible decides whether a sidecar may be created for a file that has none
+func xmpEligible(file *File) bool {
+	cat := GetCategory(file.Name)
+	return cat == "Images" || cat == "Documents"
+}
+
+// importXmpTags reads dc:subject from every attached sidecar
+func importXmpTags(c *Folder) TagSyncResult {
+	var res TagSyncResult
+
+	var walk func(f *Folder)
+	walk = func(f *Folder) {
+		for _, file := range f.Files {
+			if file.Sidecar == "" {
+				continue
+			}
+			data, err := os.ReadFile(file.Sidecar)
+			if err != nil {
+				res.fail(err)
+				continue
+			}
+			tags, present := parseXmpSubjects(data)
+			file.sidecarKnown = true
+			file.sidecarTags = formatXattrTags(tags)
+			if present && applyResolvedTags(file, tags, c.XmpSync.Conflict) {
+				res.Imported++
+			}
+		}
+		for _, sub := range f.Subfolders {
+			walk(sub)
+		}
+	}
+	walk(c)
+	return res
+}
+
+// exportXmpTags writes dc:subject for files whose tags differ from their sidecar,
+// creating photo.jpg.xmp for tagged images and documents that have none
+func exportXmpTags(c *Folder) TagSyncResult {
+	writes := planXmpExport(c)
+	for i := range writes {
+		writeXmpExport(&writes[i])
+	}
+	return recordXmpExport(writes)
+}
+
+// planXmpExport lists the sidecars that are out of date, caller holds mu
+func planXmpExport(c *Folder) []tagWrite {
+	var writes []tagWrite
+
+	var walk func(f *Folder)
+	walk = func(f *Folder) {
+		for _, file := range f.Files {
+			want := formatXattrTags(file.Tags)
+			if file.sidecarKnown && want == file.sidecarTags {
+				continue
+			}
+			if file.Sidecar == "" && (len(file.Tags) == 0 || !xmpEligible(file)) {
+				continue
+			}
+
+			path := file.Sidecar
+			if path == "" {
+				path = file.Path + xmpExt
+			}
+			tags := append([]string(nil), file.Tags...)
+			writes = append(writes, tagWrite{file: file, path: path, tags: tags, want: want, protected: f.OriginalMode})
+		}
+		for _, sub := range f.Subfolders {
+			walk(sub)
+		}
+	}
+	walk(c)
+	return writes
+}
+
+// writeXmpExport updates the sidecar keeping the rest of its XMP, it does not touch the
+// tree. a new sidecar in a write protected folder is created with the folder made
+// writable for it.
+func writeXmpExport(w *tagWrite) {
+	existing, err := os.ReadFile(w.path)
+	if err != nil && !os.IsNotExist(err) {
+		w.err = err
+		return
+	}
+	created := err != nil
+	out, err := setXmpSubjects(existing, w.tags)
+	if err == nil {
+		write := func() error { return os.WriteFile(w.path, out, 0644) }
+		if created {
+			err = withWriteBits(filepath.Dir(w.path), w.protected, write)
+		} else {
+			err = write()
+		}
+	}
+	if err != nil {
+		w.err = fmt.Errorf("%s: %w", w.path, err)
+	}
+}
+
+// recordXmpExport remembers which sidecars are current, caller holds mu
+func recordXmpExport(writes []tagWrite) TagSyncResult {
+	var res TagSyncResult
+	for _, w := range writes {
+		if w.err != nil {
+			res.fail(w.err)
+			continue
+		}
+		w.file.Sidecar = w.path
+		w.file.sidecarKnown = true
+		w.file.sidecarTags = w.want
+		res.Written++
+	}
+	return res
+}
+
+func xmpSyncHandler(w http.ResponseWriter, r *http.Request) {
+	tagSyncHandler(w, r, func(c *Folder) **TagSyncSettings { return &c.XmpSync }, "",
+		func(c *Folder) TagSyncResult {
+			res := importXmpTags(c)
+			res.add(exportXmpTags(c))
+			return res
+		})
+}
@@ -0,0 +1,170 @@
+package filesystem
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const lightroomSidecar = `<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about="" xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmlns:dc="http://purl.org/dc/elements/1.1/" xmp:Rating="4">
+   <dc:subject>
+    <rdf:Bag>
+     <rdf:li>holiday</rdf:li>
+     <rdf:li>family &amp; friends</rdf:li>
+    </rdf:Bag>
+   </dc:subject>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>`
+
+func TestExploreDown_AttachesSidecars(t *testing.T) {
+	tmp := t.TempDir()
+	for _, name := range []string{"a.jpg", "a.jpg.xmp", "b.nef", "b.xmp", "lonely.xmp", "c.txt"} {
+		os.WriteFile(filepath.Join(tmp, name), []byte("x"), 0644)
+	}
+	c, err := ConvertToObject("xmp", tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := map[string]*File{}
+	for _, f := range c.Files {
+		names[f.Name] = f
+	}
+	if len(c.Files) != 4 {
+		t.Fatalf("expected a.jpg, b.nef, lonely.xmp and c.txt, got %d files", len(c.Files))
+	}
+	if names["a.jpg"].Sidecar != filepath.Join(tmp, "a.jpg.xmp") {
+		t.Errorf("a.jpg sidecar = %q", names["a.jpg"].Sidecar)
+	}
+	if names["b.nef"].Sidecar != filepath.Join(tmp, "b.xmp") {
+		t.Errorf("b.nef sidecar = %q", names["b.nef"].Sidecar)
+	}
+	if names["lonely.xmp"] == nil {
+		t.Errorf("sidecar without a primary must stay a file")
+	}
+}
+
+func TestDeleteHandlers_RemoveSidecars(t *testing.T) {
+	tmp := chdirTemp(t)
+	for _, name := range []string{"a.jpg", "a.jpg.xmp", "b.nef", "b.xmp", "c.txt"} {
+		os.WriteFile(filepath.Join(tmp, name), []byte("x"), 0644)
+	}
+	c, err := ConvertToObject("xmp", tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig := Composites
+	defer func() { Composites = orig }()
+	Composites = []*Folder{c}
+
+	rr := httptest.NewRecorder()
+	deleteFileHandler(rr, httptest.NewRequest("GET", "/deleteFile?name=xmp&path="+filepath.Join(tmp, "a.jpg"), nil))
+	if rr.Code != 200 {
+		t.Fatalf("single delete: %d %s", rr.Code, rr.Body.String())
+	}
+	body := `[{"file_path":"` + filepath.ToSlash(filepath.Join(tmp, "b.nef")) + `"}]`
+	rr = httptest.NewRecorder()
+	BulkDeleteFileHandler(rr, httptest.NewRequest("POST", "/bulkDeleteFiles?name=xmp", bytes.NewBufferString(body)))
+	if rr.Code != 200 {
+		t.Fatalf("bulk delete: %d %s", rr.Code, rr.Body.String())
+	}
+
+	for _, name := range []string{"a.jpg", "a.jpg.xmp", "b.nef", "b.xmp"} {
+		if _, err := os.Stat(filepath.Join(tmp, name)); !os.IsNotExist(err) {
+			t.Errorf("%s should be deleted with its file", name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(tmp, "c.txt")); err != nil {
+		t.Errorf("c.txt should stay: %v", err)
+	}
+}
+
+func TestSetXmpSubjects_KeepsOtherMetadata(t *testing.T) {
+	tags, present := parseXmpSubjects([]byte(lightroomSidecar))
+	if !present || len(tags) != 2 || tags[1] != "family & friends" {
+		t.Fatalf("unexpected parse %v %v", tags, present)
+	}
+
+	out, err := setXmpSubjects([]byte(lightroomSidecar), []string{"holiday", "beach"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), `xmp:Rating="4"`) {
+		t.Fatalf("other metadata lost:\n%s", out)
+	}
+	tags, _ = parseXmpSubjects(out)
+	if len(tags) != 2 || tags[1] != "beach" {
+		t.Fatalf("expected rewritten subjects, got %v", tags)
+	}
+}
+
+func TestSetXmpSubjects_AddsSubjectToSelfClosingDescription(t *testing.T) {
+	in := `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#"><rdf:Description rdf:about="" xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmp:Rating="2"/></rdf:RDF></x:xmpmeta>`
+	out, err := setXmpSubjects([]byte(in), []string{"new"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), xmpDublinCoreNS) || !strings.Contains(string(out), `xmp:Rating="2"`) {
+		t.Fatalf("expected dc namespace and existing attributes:\n%s", out)
+	}
+	if tags, _ := parseXmpSubjects(out); len(tags) != 1 || tags[0] != "new" {
+		t.Fatalf("expected subject to be added, got %v", tags)
+	}
+
+	fresh, _ := setXmpSubjects(nil, []string{"a"})
+	if tags, _ := parseXmpSubjects(fresh); len(tags) != 1 {
+		t.Fatalf("new sidecar should carry the tag:\n%s", fresh)
+	}
+}
+
+func TestXmpSync_ImportAndExport(t *testing.T) {
+	tmp := t.TempDir()
+	os.WriteFile(filepath.Join(tmp, "photo.jpg"), []byte("x"), 0644)
+	os.WriteFile(filepath.Join(tmp, "photo.jpg.xmp"), []byte(lightroomSidecar), 0644)
+	os.WriteFile(filepath.Join(tmp, "shot.png"), []byte("x"), 0644)
+	os.WriteFile(filepath.Join(tmp, "song.mp3"), []byte("x"), 0644)
+
+	c, _ := ConvertToObject("xmp", tmp)
+	c.XmpSync = &TagSyncSettings{Enabled: true, Conflict: tagConflictMerge}
+	photo := c.GetFile(filepath.Join(tmp, "photo.jpg"))
+	photo.Tags = []string{"edited"}
+
+	if !importExternalTags(c) {
+		t.Fatalf("expected import to change tags")
+	}
+	if formatXattrTags(photo.Tags) != "edited,holiday,family & friends" {
+		t.Fatalf("unexpected merged tags %v", photo.Tags)
+	}
+
+	c.GetFile(filepath.Join(tmp, "shot.png")).Tags = []string{"screenshot"}
+	c.GetFile(filepath.Join(tmp, "song.mp3")).Tags = []string{"music"}
+	res := exportXmpTags(c)
+	if res.Written != 2 || res.Errors != 0 {
+		t.Fatalf("expected photo and shot written, got %+v", res)
+	}
+	if _, err := os.Stat(filepath.Join(tmp, "song.mp3.xmp")); !os.IsNotExist(err) {
+		t.Fatalf("no sidecar should be created for music")
+	}
+	data, _ := os.ReadFile(filepath.Join(tmp, "shot.png.xmp"))
+	if tags, _ := parseXmpSubjects(data); len(tags) != 1 || tags[0] != "screenshot" {
+		t.Fatalf("new sidecar not written correctly: %v", tags)
+	}
+	if again := exportXmpTags(c); again.Written != 0 {
+		t.Fatalf("unchanged files must not be rewritten, got %+v", again)
+	}
+}
+
+func TestSidecarMovedWith(t *testing.T) {
+	if got := sidecarMovedWith("/a/p.jpg.xmp", "/a/p.jpg", "/b/p_(1).jpg"); got != "/b/p_(1).jpg.xmp" {
+		t.Errorf("got %q", got)
+	}
+	if got := sidecarMovedWith("/a/p.xmp", "/a/p.nef", "/b/p.nef"); got != "/b/p.xmp" {
+		t.Errorf("got %q", got)
+	}
+}
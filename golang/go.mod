@@ -3,6 +3,7 @@ module github.com/COS301-SE-2025/Smart-File-Manager/golang
 go 1.24
 
 require (
+	golang.org/x/text v0.22.0
 	google.golang.org/grpc v1.72.1
 	google.golang.org/protobuf v1.36.6
 )
@@ -11,6 +12,5 @@ require (
 	github.com/google/go-cmp v0.7.0 // indirect
 	golang.org/x/net v0.35.0 // indirect
 	golang.org/x/sys v0.30.0 // indirect
-	golang.org/x/text v0.22.0 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20250218202821-56aae31c358a // indirect
 )